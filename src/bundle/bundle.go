@@ -0,0 +1,155 @@
+// Package bundle reads the chains that CAs send in place of a reachable test
+// website, whether as a bundle of PEM certificates or as a PKCS#7 certs-only
+// message, in either PEM or DER.
+package bundle
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// signedDataOID is the content type of a PKCS#7 SignedData message, RFC 2315 section 14.
+var signedDataOID = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData stops at the certificates, as a RawValue matches any element
+// regardless of its tag and so cannot tell the optional fields apart. The
+// CRLs and signer infos that follow are ignored.
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue
+}
+
+// Parse reads every certificate within the bundle, in the order in which they appear.
+func Parse(raw []byte) ([]*x509.Certificate, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, errors.New("the bundle is empty")
+	}
+	if !bytes.Contains(raw, []byte("-----BEGIN")) {
+		// Without any PEM armour, it is either a lone DER certificate or DER PKCS#7.
+		if certs, err := x509.ParseCertificates(raw); err == nil {
+			return certs, nil
+		}
+		return PKCS7(raw)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse certificate %d of the bundle", len(certs)+1)
+			}
+			certs = append(certs, cert)
+		case "PKCS7", "CMS":
+			p7, err := PKCS7(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, p7...)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates were found within the bundle")
+	}
+	return certs, nil
+}
+
+// PKCS7 reads the certificates from a DER encoded PKCS#7 SignedData message,
+// such as a .p7b or .p7c file. Indefinite length BER is not supported.
+func PKCS7(der []byte) ([]*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrap(err, "failed to parse PKCS#7 content info")
+	}
+	if !info.ContentType.Equal(signedDataOID) {
+		return nil, errors.Errorf("PKCS#7 content type %v is not signed data", info.ContentType)
+	}
+	var data signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		return nil, errors.Wrap(err, "failed to parse PKCS#7 signed data")
+	}
+	if data.Certificates.Class != asn1.ClassContextSpecific || data.Certificates.Tag != 0 || len(data.Certificates.Bytes) == 0 {
+		return nil, errors.New("the PKCS#7 message holds no certificates")
+	}
+	certs, err := x509.ParseCertificates(data.Certificates.Bytes)
+	return certs, errors.Wrap(err, "failed to parse the certificates of the PKCS#7 message")
+}
+
+// Order arranges the certificates from the leaf up to the root, or as far
+// towards the root as the certificates go. The leaf is the certificate that
+// issued none of the others. Certificates that are not part of the leaf's
+// chain are dropped.
+func Order(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("there are no certificates to order")
+	}
+	var unique []*x509.Certificate
+	for _, cert := range certs {
+		if !contains(unique, cert) {
+			unique = append(unique, cert)
+		}
+	}
+	certs = unique
+	var leaves []*x509.Certificate
+	for _, cert := range certs {
+		issuer := false
+		for _, other := range certs {
+			if other != cert && issued(cert, other) {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			leaves = append(leaves, cert)
+		}
+	}
+	if len(leaves) != 1 {
+		return nil, errors.Errorf("expected a single leaf within the bundle, found %d", len(leaves))
+	}
+	chain := []*x509.Certificate{leaves[0]}
+	for {
+		current := chain[len(chain)-1]
+		var next *x509.Certificate
+		for _, cert := range certs {
+			if cert != current && !contains(chain, cert) && issued(cert, current) {
+				next = cert
+				break
+			}
+		}
+		if next == nil {
+			return chain, nil
+		}
+		chain = append(chain, next)
+	}
+}
+
+// issued reports whether the issuer signed the certificate.
+func issued(issuer, cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+func contains(chain []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
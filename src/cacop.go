@@ -1,25 +1,49 @@
 package main // import "github.com/christopher-henderson/CACop"
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"encoding/pem"
+	"flag"
 	"fmt"
+	"github.com/christopher-henderson/CACop/constraints"
+	"github.com/christopher-henderson/CACop/ct"
+	"github.com/christopher-henderson/CACop/ev"
 	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/expiration/goverify"
+	"github.com/christopher-henderson/CACop/hostname"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/metrics"
 	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/notify"
 	"github.com/christopher-henderson/CACop/revocation/crl"
 	"github.com/christopher-henderson/CACop/revocation/ocsp"
+	"github.com/christopher-henderson/CACop/starttls"
+	"github.com/christopher-henderson/CACop/store"
+	"github.com/christopher-henderson/CACop/truststore"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"regexp"
+	"time"
 
-	"github.com/christopher-henderson/CACop/validation/certutil"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/sirupsen/logrus"
 )
 
+var trustStore = truststore.New()
+
+// evPolicies are the EV policies for which each root is enabled.
+var evPolicies = ev.New()
+
 func verifyCertificateChain(resp http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
+	f, ok := negotiate(resp, req, resultFormats)
+	if !ok {
+		return
+	}
 	s, ok := req.URL.Query()["subject"]
 	if !ok {
 		resp.WriteHeader(400)
@@ -37,8 +61,7 @@ func verifyCertificateChain(resp http.ResponseWriter, req *http.Request) {
 	cert := NormalizePEM(caCertRaw)
 	block, rest := pem.Decode(cert)
 	if len(rest) != 0 {
-		log.Println("got trailing certificate data for the provided CA")
-		log.Println(string(rest))
+		logging.FromContext(req.Context()).WithField("trailing", string(rest)).Warn("got trailing certificate data for the provided CA")
 	}
 	caCert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
@@ -46,33 +69,20 @@ func verifyCertificateChain(resp http.ResponseWriter, req *http.Request) {
 		resp.Write([]byte("Bad PEM: " + err.Error()))
 		return
 	}
-	chain, err := GatherCertificateChain(string(subject))
+	opts, err := verificationOptions(req)
 	if err != nil {
 		resp.WriteHeader(400)
-		resp.Write([]byte("Could not retrieve certificate chain from " + string(subject) + " because of " + err.Error()))
+		resp.Write([]byte(err.Error()))
 		return
 	}
-	switch chain[len(chain)-1].IsCA {
-	case true:
-		// If the subject website is offering a CA certificate in its chain
-		// then ignore and replace it with the CA provided by the request.
-		chain[len(chain)-1] = caCert
-	case false:
-		// Otherwise, it appears that the subject website has only offered
-		// its leaf and intermediates, thus we can just tack on the target CA.
-		chain = append(chain, caCert)
-	}
-	result := model.TestWebsiteResult{}
-	result.SubjectURL = subject
-	result.Chain = VerifyChain(chain)
-	result.Error = nil
-	encoder := json.NewEncoder(resp)
-	encoder.SetIndent("", "    ")
-	err = encoder.Encode(result)
+	result, err := testWebsite(req.Context(), subject, caCert, opts)
 	if err != nil {
-		resp.WriteHeader(500)
-		fmt.Fprintf(resp, "internal error: %s", err)
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
 	}
+	save(result)
+	respond(resp, f, result)
 	//results := make([]*model.CertificateResultOld, len(chain))
 	//for i, cert := range chain {
 	//	results[i] = model.NewCertificateResult(cert)
@@ -89,6 +99,10 @@ func verifyCertificateChain(resp http.ResponseWriter, req *http.Request) {
 
 func verifyCertificateChainNoCA(resp http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
+	f, ok := negotiate(resp, req, resultFormats)
+	if !ok {
+		return
+	}
 	s, ok := req.URL.Query()["subject"]
 	if !ok {
 		resp.WriteHeader(400)
@@ -96,53 +110,266 @@ func verifyCertificateChainNoCA(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 	subject := s[0]
-	chain, err := GatherCertificateChain(string(subject))
+	opts, err := verificationOptions(req)
 	if err != nil {
 		resp.WriteHeader(400)
-		resp.Write([]byte("Could not retrieve certificate chain from " + string(subject) + " because of " + err.Error()))
+		resp.Write([]byte(err.Error()))
 		return
 	}
+	result, err := testWebsite(req.Context(), subject, nil, opts)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
+	}
+	save(result)
+	respond(resp, f, result)
+}
+
+// options are how a chain is to be verified.
+type options struct {
+	// At is the moment at which the chain is verified, or now if zero.
+	At    time.Time
+	Usage certutil.Usage
+	// Precertificate, if given, is compared with the leaf. PrecertificateSigner
+	// is the precertificate signing certificate that signed it, if any.
+	Precertificate       *x509.Certificate
+	PrecertificateSigner *x509.Certificate
+}
+
+// verificationOptions are the optional 'time' and 'usage' query parameters.
+func verificationOptions(req *http.Request) (options, error) {
+	at, err := verificationTime(req.URL.Query().Get("time"))
+	if err != nil {
+		return options{}, fmt.Errorf("'time' query parameter %s\n", err)
+	}
+	usage, err := certutil.ParseUsage(req.URL.Query().Get("usage"))
+	if err != nil {
+		return options{}, fmt.Errorf("bad 'usage' query parameter: %s\n", err)
+	}
+	return options{At: at, Usage: usage}, nil
+}
+
+// verificationTime parses the time, in RFC 3339, at which the chain ought to
+// be verified, as given by either the 'time' query parameter or the -time
+// flag. The zero time, meaning now, is returned when it is absent.
+func verificationTime(t string) (time.Time, error) {
+	if t == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, t)
+	if err != nil {
+		return at, fmt.Errorf("must be in RFC 3339, eg. 2019-01-02T15:04:05Z: %s", err)
+	}
+	return at, nil
+}
+
+// withRoot replaces, or appends, the root of the chain with the designated CA.
+// A lone certificate is the leaf, so the CA is appended to it even if it is
+// self signed.
+func withRoot(chain []*x509.Certificate, root *x509.Certificate) []*x509.Certificate {
+	switch len(chain) > 1 && certutil.IsSelfSigned(chain[len(chain)-1]) {
+	case true:
+		// If the subject website is offering a root in its chain
+		// then ignore and replace it with the CA provided by the request.
+		chain[len(chain)-1] = root
+	case false:
+		// Otherwise, it appears that the subject website has only offered
+		// its leaf and intermediates, thus we can just tack on the target CA.
+		// Intermediates are CAs too, so IsCA cannot tell the two apart.
+		chain = append(chain, root)
+	}
+	return chain
+}
+
+// testWebsite gathers the chain offered by the subject and verifies it against
+// the given root, or against the chain as offered if the root is nil.
+func testWebsite(ctx context.Context, subject string, root *x509.Certificate, opts options) (model.TestWebsiteResult, error) {
 	result := model.TestWebsiteResult{}
 	result.SubjectURL = subject
-	result.Chain = VerifyChain(chain)
-	result.Error = nil
-	encoder := json.NewEncoder(resp)
-	encoder.SetIndent("", "    ")
-	err = encoder.Encode(result)
+	result.CorrelationID = logging.ID(ctx)
+	state, err := gather(ctx, subject)
 	if err != nil {
-		resp.WriteHeader(500)
-		fmt.Fprintf(resp, "internal error: %s", err)
+		return result, fmt.Errorf("could not retrieve certificate chain from %s because of %s", subject, err)
 	}
+	result.Handshake = model.NewHandshake(state)
+	chain := state.PeerCertificates
+	// The subject was already parsed successfully in order to be gathered.
+	u, _ := url.Parse(subject)
+	match := hostname.Verify(chain[0], u.Hostname())
+	result.Hostname = &match
+	if root != nil {
+		chain = withRoot(chain, root)
+	}
+	result.Chain = VerifyChain(ctx, chain, opts)
+	if len(chain) > 1 {
+		result.Staple = ocsp.VerifyStaple(ctx, state.OCSPResponse, chain[0], chain[1], result.Chain.Leaf.OCSP, opts.At)
+	}
+	return result, nil
 }
 
-func VerifyChain(chain []*x509.Certificate) model.ChainResult {
+// VerifyChain runs every verifier over the chain for the intended usage.
+func VerifyChain(ctx context.Context, chain []*x509.Certificate, opts options) model.ChainResult {
 	result := model.ChainResult{}
-	expirations, err := expiration.VerifyChain(chain)
+	inFlight.With().Inc()
+	defer observeVerification(time.Now(), &result)
+	at := opts.At
+	result.Usage = opts.Usage
+	result.VerificationTime = at
+	if at.IsZero() {
+		result.VerificationTime = time.Now()
+	}
+	ca := len(chain) - 1
+	log := logging.FromContext(ctx)
+	result.Inclusion = trustStore.Lookup(chain[ca], chain[0], purposeOf(opts.Usage))
+	log.WithFields(logrus.Fields{
+		"leaf":              chain[0].Subject.CommonName,
+		"root":              chain[ca].Subject.CommonName,
+		"intermediates":     len(chain) - 2,
+		"inclusion":         result.Inclusion.Status,
+		"verification_time": result.VerificationTime,
+		"usage":             opts.Usage,
+	}).Info("verifying chain")
+	expirations, path, err := expiration.VerifyChain(ctx, chain, rootTrust(result.Inclusion, opts.Usage), opts.Usage, at)
 	if err != nil {
-		log.Panicln(err)
+		// As with a failed OCSP or CRL query, the failure is the result.
+		log.WithError(err).Error("failed to verify the chain with NSS")
+		path.Status, path.Error = certutil.StatusToolFailure, err
+		for i := range expirations {
+			if expirations[i].Error == nil {
+				expirations[i].Status, expirations[i].Error = certutil.StatusToolFailure, err
+			}
+		}
 	}
-	ocsps := ocsp.VerifyChain(chain)
-	crls := crl.VerifyChain(chain)
+	result.PathValidation = path
+	result.GoValidation = goverify.VerifyChain(chain, opts.Usage, at)
+	ocsps := ocsp.VerifyChain(ctx, chain, at)
+	crls := crl.VerifyChain(ctx, chain, at)
 	result.Leaf = model.NewCeritifcateResult(chain[0], ocsps[0], crls[0], expirations[0])
-	result.Intermediates = make([]model.CertificateResult, len(chain[1:len(chain)-1]))
-	log.Println(chain)
-	log.Println(len(chain) - 1)
-	log.Println(len(ocsps))
-	log.Println(len(crls))
+	// A lone certificate is both the leaf and the root, without intermediates.
+	result.Intermediates = make([]model.CertificateResult, 0, len(chain))
 	for i := 1; i < len(chain)-1; i++ {
-		result.Intermediates[i-1] = model.NewCeritifcateResult(chain[i], ocsps[i], crls[i], expirations[i])
+		result.Intermediates = append(result.Intermediates, model.NewCeritifcateResult(chain[i], ocsps[i], crls[i], expirations[i]))
 	}
-	ca := len(chain) - 1
 	result.Root = model.NewCeritifcateResult(chain[ca], ocsps[ca], crls[ca], expirations[ca])
+	// The root is trusted as it is, so whether its revocation is determinable means nothing.
+	result.Root.RevocationDeterminable = nil
+	var violations, evFindings [][]string
+	result.Constraints, violations = constraints.VerifyChain(chain)
+	result.EV, evFindings = evPolicies.Evaluate(chain, result.Constraints.ValidPolicies)
+	ctFindings := ct.Findings(chain)
+	findings := func(i int) []string {
+		return append(append(violations[i], evFindings[i]...), ctFindings[i]...)
+	}
+	result.Leaf.Findings = findings(0)
+	for i := range result.Intermediates {
+		result.Intermediates[i].Findings = findings(i + 1)
+	}
+	result.Root.Findings = findings(ca)
+	if opts.Precertificate != nil {
+		var issuer *x509.Certificate
+		if len(chain) > 1 {
+			issuer = chain[1]
+		}
+		comparison := ct.Compare(chain[0], issuer, opts.Precertificate, opts.PrecertificateSigner)
+		result.Precertificate = &comparison
+	}
 	return result
 }
 
-func GatherCertificateChain(subjectURL string) ([]*x509.Certificate, error) {
-	resp, err := http.DefaultClient.Get(subjectURL)
+// rootTrust decides the NSS trust given to the designated root. Roots that
+// are already included keep the trust bits that Mozilla has granted them and
+// roots that Mozilla distrusts, including those distrusted after a date that
+// precedes the leaf, get none. Any other root is evaluated as though it were
+// trusted for the intended usage.
+func rootTrust(inclusion truststore.Entry, usage certutil.Usage) certutil.Trust {
+	switch {
+	case inclusion.Status == truststore.Distrusted:
+		return certutil.NoTrust
+	case inclusion.Status != truststore.Included || !inclusion.Trust.Any():
+		return usage.Trust()
+	}
+	trust := certutil.NoTrust
+	if inclusion.Trust.Websites {
+		trust.SSL = certutil.TrustedCA
+	}
+	if inclusion.Trust.Email {
+		trust.Email = certutil.TrustedCA
+	}
+	if inclusion.Trust.CodeSigning {
+		trust.ObjectSigning = certutil.TrustedCA
+	}
+	return trust
+}
+
+// purposeOf is the trust store purpose that the usage relies upon.
+func purposeOf(usage certutil.Usage) truststore.Purpose {
+	switch usage {
+	case certutil.SMIME:
+		return truststore.EmailProtection
+	case certutil.CodeSigning:
+		return truststore.CodeSigning
+	default:
+		return truststore.ServerAuth
+	}
+}
+
+// GatherCertificateChain retrieves the chain offered by the subject.
+func GatherCertificateChain(ctx context.Context, subjectURL string) ([]*x509.Certificate, error) {
+	state, err := gather(ctx, subjectURL)
 	if err != nil {
 		return []*x509.Certificate{}, err
 	}
-	return resp.TLS.PeerCertificates, err
+	return state.PeerCertificates, nil
+}
+
+// gatherer does not follow redirects, so that the chain gathered is that of
+// the subject itself rather than of wherever it happens to send visitors.
+var gatherer = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// gather completes a TLS handshake with the subject. https subjects are
+// requested as any browser would, whereas smtp, imap, pop3, ldap and xmpp
+// subjects are first upgraded via their protocol's STARTTLS. Either way the
+// status_request extension is sent, so any stapled OCSP response is kept.
+func gather(ctx context.Context, subjectURL string) (state tls.ConnectionState, err error) {
+	defer func(start time.Time) {
+		observeGather(start, err)
+		log := logging.FromContext(ctx).WithFields(logrus.Fields{
+			"subject":      subjectURL,
+			"certificates": len(state.PeerCertificates),
+			"duration":     time.Since(start).Seconds(),
+		})
+		if err != nil {
+			log.WithError(err).Warn("failed to gather certificate chain")
+			return
+		}
+		log.Debug("gathered certificate chain")
+	}(time.Now())
+	subject, err := url.Parse(subjectURL)
+	if err != nil {
+		return state, err
+	}
+	if starttls.Supported(subject.Scheme) {
+		// As with https, the chain is gathered whether or not it is trusted.
+		return starttls.Handshake(ctx, subject, &tls.Config{InsecureSkipVerify: true})
+	}
+	req, err := http.NewRequest(http.MethodGet, subjectURL, nil)
+	if err != nil {
+		return state, err
+	}
+	resp, err := gatherer.Do(req.WithContext(ctx))
+	if err != nil {
+		return state, err
+	}
+	defer resp.Body.Close()
+	if resp.TLS == nil {
+		return state, fmt.Errorf("%s is not served over TLS", subjectURL)
+	}
+	return *resp.TLS, nil
 }
 
 var pemStripper = regexp.MustCompile(`('|\n|-----BEGIN CERTIFICATE-----|-----END CERTIFICATE-----)`)
@@ -167,22 +394,119 @@ func NormalizePEM(pem []byte) (fmtedPEM []byte) {
 	return append(fmtedPEM, "-----END CERTIFICATE-----"...)
 }
 
+func loadTrustStore(certdata, roots, pending, evTable string) error {
+	if certdata != "" {
+		if err := trustStore.LoadCertdata(certdata); err != nil {
+			return err
+		}
+	}
+	if roots != "" {
+		if err := trustStore.LoadPEMDirectory(roots, truststore.Included); err != nil {
+			return err
+		}
+	}
+	if pending != "" {
+		if err := trustStore.LoadPEMDirectory(pending, truststore.Pending); err != nil {
+			return err
+		}
+	}
+	if evTable != "" {
+		if err := evPolicies.LoadFile(evTable); err != nil {
+			return err
+		}
+	}
+	logging.Logger.WithFields(logrus.Fields{
+		"roots":   trustStore.Len(),
+		"evRoots": evPolicies.Len(),
+	}).Info("loaded the trust store")
+	return nil
+}
+
 const DB = "/Users/chris/Documents/Contracting/mozilla/testWebSites/testdb"
 
 // @TODO I can't seem to get this to fail intentionally, be careful
 const DIST = "/Users/chris/Documents/Contracting/mozilla/testWebSites/dist/Debug"
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	certdata := flag.String("certdata", "", "path to a Mozilla certdata.txt describing the included roots")
+	roots := flag.String("roots", "", "directory of PEM encoded included roots, an alternative to -certdata")
+	pending := flag.String("pending", "", "directory of PEM encoded roots that are pending inclusion")
+	evTable := flag.String("ev", "", "path to a table of root fingerprints and the EV policy OIDs for which each is enabled")
+	db := flag.String("store", "cacop.db", "path to the database of past results, empty to disable")
+	interval := flag.Duration("monitor-interval", time.Hour*6, "how often monitored test websites are verified")
+	jitter := flag.Duration("monitor-jitter", time.Minute*30, "maximum random delay added to each monitoring interval")
+	webhooks := flag.String("webhook", "", "comma separated URLs that are posted to when a monitored test website regresses")
+	secret := flag.String("webhook-secret", "", "key with which webhook payloads are signed, via HMAC-SHA256")
+	spool := flag.String("spool", "", "directory into which an email is written when a monitored test website regresses")
+	from := flag.String("mail-from", "cacop@localhost", "sender of spooled emails")
+	to := flag.String("mail-to", "", "comma separated recipients of spooled emails")
+	level := flag.String("log-level", "info", "least severe level that is logged, one of debug, info, warning or error")
+	flag.Parse()
+	lvl, err := logrus.ParseLevel(*level)
+	if err != nil {
+		logging.Logger.WithError(err).Panic("bad -log-level")
+	}
+	logging.Logger.SetLevel(lvl)
+	// Anything still logging via the standard library ends up as JSON too.
+	log.SetFlags(0)
+	log.SetOutput(logging.Logger.Writer())
+	if err := loadTrustStore(*certdata, *roots, *pending, *evTable); err != nil {
+		logging.Logger.WithError(err).Panic("failed to load the trust store")
+	}
 	// Very mandatory otherwise the HTTP package will vomit on revoked/expired certificates and return an error.
 	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	err := certutil.Init(DIST)
+	if flag.Arg(0) == "simulate" {
+		// The simulated CA needs neither NSS nor a result store.
+		if err := simulate(flag.Args()[1:]); err != nil {
+			logging.Logger.WithError(err).Panic("command failed")
+		}
+		return
+	}
+	err = certutil.Init(DIST)
+	if err != nil {
+		logging.Logger.WithError(err).Panic("failed to find the NSS tools")
+	}
+	if *db != "" {
+		if results, err = store.Open(*db); err != nil {
+			logging.Logger.WithError(err).Panic("failed to open the result store")
+		}
+		defer results.Close()
+	}
+	switch command := flag.Arg(0); command {
+	case "", "serve":
+		var n notify.Notifier
+		if n, err = notifier(*webhooks, *secret, *spool, *from, *to); err == nil {
+			err = serve(*interval, *jitter, n)
+		}
+	case "verify":
+		err = verify(flag.Args()[1:])
+	case "check":
+		err = checkCommand(flag.Args()[1:])
+	case "diff":
+		err = compareRuns(flag.Args()[1:])
+	default:
+		err = fmt.Errorf("unknown command %q, expected one of serve, verify, check, diff or simulate", command)
+	}
 	if err != nil {
-		log.Panicln(err)
+		logging.Logger.WithError(err).Panic("command failed")
 	}
+}
+
+func serve(interval, jitter time.Duration, notifier notify.Notifier) error {
 	http.HandleFunc("/", verifyCertificateChain)
 	http.HandleFunc("/bundledCA", verifyCertificateChainNoCA)
-	if err := http.ListenAndServe("0.0.0.0:8080", nil); err != nil {
-		log.Panicln(err)
+	http.HandleFunc("/check", check)
+	http.HandleFunc("/upload", upload)
+	http.Handle("/metrics", metrics.Handler())
+	if results != nil {
+		http.HandleFunc("/history", history)
+		http.HandleFunc("/run", run)
+		http.HandleFunc("/diff", compare)
+		if err := startMonitor(interval, jitter, notifier); err != nil {
+			return err
+		}
+		defer monitors.Stop()
+		http.HandleFunc("/monitor", monitoring)
 	}
+	return http.ListenAndServe("0.0.0.0:8080", logging.Middleware(http.DefaultServeMux))
 }
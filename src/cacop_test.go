@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/ct"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/monitor"
+	"github.com/christopher-henderson/CACop/pkitest"
+	"github.com/christopher-henderson/CACop/store"
+	"github.com/christopher-henderson/CACop/truststore"
+)
+
+var nss error
+
+func TestMain(m *testing.M) {
+	// As in main, the test websites are not trusted by the system.
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	nss = certutil.Init(os.Getenv("NSS_DIST"))
+	os.Exit(m.Run())
+}
+
+func TestGatherCertificateChain(t *testing.T) {
+	p := pkitest.NewT(t)
+	for _, leaf := range []*pkitest.Leaf{p.Valid, p.Expired, p.Revoked} {
+		site := p.Site(leaf)
+		chain, err := GatherCertificateChain(context.Background(), site.URL)
+		site.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != 2 || !chain[0].Equal(leaf.Certificate) || !chain[1].Equal(p.Intermediate.Certificate) {
+			t.Errorf("%s: expected the leaf and intermediate, got %d certificates", leaf.Certificate.Subject.CommonName, len(chain))
+		}
+	}
+	if _, err := GatherCertificateChain(context.Background(), p.URL()); err == nil {
+		t.Error("expected an error from a website without TLS")
+	}
+}
+
+func TestWithRoot(t *testing.T) {
+	p := pkitest.NewT(t)
+	other, err := p.NewRoot("Another Root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offered := []*x509.Certificate{p.Valid.Certificate, p.Intermediate.Certificate}
+	chain := withRoot(offered, p.Root.Certificate)
+	if len(chain) != 3 || chain[2] != p.Root.Certificate {
+		t.Errorf("expected the root to be appended, got %d certificates", len(chain))
+	}
+	offered = []*x509.Certificate{p.Valid.Certificate, p.Intermediate.Certificate, other.Certificate}
+	chain = withRoot(offered, p.Root.Certificate)
+	if len(chain) != 3 || chain[2] != p.Root.Certificate {
+		t.Errorf("expected the offered root to be replaced, got %d certificates", len(chain))
+	}
+	// A lone self signed certificate is the leaf, not a root to be replaced.
+	chain = withRoot([]*x509.Certificate{other.Certificate}, p.Root.Certificate)
+	if len(chain) != 2 || chain[0] != other.Certificate || chain[1] != p.Root.Certificate {
+		t.Errorf("expected the root to be appended to the lone certificate, got %d certificates", len(chain))
+	}
+}
+
+func TestGatherHandshake(t *testing.T) {
+	p := pkitest.NewT(t)
+	site := p.Site(p.Valid)
+	defer site.Close()
+	state, err := gather(context.Background(), site.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshake := model.NewHandshake(state)
+	if handshake.Version == "" || handshake.CipherSuite == "" {
+		t.Errorf("expected the version and cipher suite to be recorded, got %+v", handshake)
+	}
+	if len(state.OCSPResponse) == 0 {
+		t.Error("expected the stapled OCSP response to be kept")
+	}
+	if _, err := gather(context.Background(), "smtp://127.0.0.1:1"); err == nil {
+		t.Error("expected an error from an unreachable mail server")
+	}
+	redirect := httptest.NewTLSServer(http.RedirectHandler(site.URL, http.StatusFound))
+	defer redirect.Close()
+	state, err = gather(context.Background(), redirect.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.PeerCertificates) == 0 || !state.PeerCertificates[0].Equal(redirect.Certificate()) {
+		t.Error("expected the chain of the subject rather than that of where it redirects to")
+	}
+}
+
+func TestUploadRejects(t *testing.T) {
+	tests := []struct {
+		method string
+		query  string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", "", http.StatusBadRequest},
+		{http.MethodPost, "", "not a certificate", http.StatusBadRequest},
+		{http.MethodPost, "?usage=ipsec", "", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/upload"+test.query, strings.NewReader(test.body))
+		resp := httptest.NewRecorder()
+		upload(resp, req)
+		if resp.Code != test.status {
+			t.Errorf("%s %q with %q: expected %d, got %d", test.method, test.query, test.body, test.status, resp.Code)
+		}
+	}
+}
+
+func TestUploadMultipart(t *testing.T) {
+	p := pkitest.NewT(t)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	chain, _ := form.CreateFormFile("chain", "chain.pem")
+	pem.Encode(chain, &pem.Block{Type: "CERTIFICATE", Bytes: p.Valid.Certificate.Raw})
+	form.WriteField("root", "not a certificate")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rawChain, err := formFile(parseForm(t, req), "chain")
+	if err != nil || len(rawChain) == 0 {
+		t.Fatalf("expected the chain part, got %q %v", rawChain, err)
+	}
+	rawRoot, _ := formFile(req.MultipartForm, "root")
+	if _, err := testUpload(context.Background(), rawChain, rawRoot, options{}); err == nil || !strings.Contains(err.Error(), "bad root") {
+		t.Errorf("expected the root to be rejected, got %v", err)
+	}
+}
+
+func TestUploadBareLeaf(t *testing.T) {
+	p := pkitest.NewT(t)
+	body := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.Valid.Certificate.Raw})
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	upload(resp, req)
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "lone certificate") {
+		t.Errorf("expected a bare leaf to be rejected, got %d %q", resp.Code, resp.Body.String())
+	}
+}
+
+func TestParsePrecertificate(t *testing.T) {
+	p := pkitest.NewT(t)
+	signer, err := p.NewAuthority(p.Intermediate, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "CACop Test Precertificate Signer"},
+		NotBefore:             p.Now.AddDate(-1, 0, 0),
+		NotAfter:              p.Now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{ct.PrecertificateSign},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(certs ...*x509.Certificate) []byte {
+		var b bytes.Buffer
+		for _, cert := range certs {
+			pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		return b.Bytes()
+	}
+	// The signer may come either before or after the precertificate.
+	precert, precertSigner, err := parsePrecertificate(encode(signer.Certificate, p.Valid.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if precert == nil || !precert.Equal(p.Valid.Certificate) || precertSigner == nil || !precertSigner.Equal(signer.Certificate) {
+		t.Errorf("unexpected precertificate %v and signer %v", precert, precertSigner)
+	}
+	if _, _, err := parsePrecertificate(encode(signer.Certificate)); err == nil {
+		t.Error("expected a lone precertificate signing certificate to be rejected")
+	}
+}
+
+func parseForm(t *testing.T, req *http.Request) *multipart.Form {
+	if err := req.ParseMultipartForm(maxUpload); err != nil {
+		t.Fatal(err)
+	}
+	return req.MultipartForm
+}
+
+func TestRootTrust(t *testing.T) {
+	websites := truststore.TrustBits{Websites: true}
+	tests := []struct {
+		name      string
+		inclusion truststore.Entry
+		usage     certutil.Usage
+		trust     certutil.Trust
+	}{
+		{"included", truststore.Entry{Status: truststore.Included, Trust: websites}, certutil.SMIME, certutil.Trust{SSL: certutil.TrustedCA}},
+		{"not included", truststore.Entry{Status: truststore.NotIncluded}, certutil.SMIME, certutil.SMIME.Trust()},
+		{"pending", truststore.Entry{Status: truststore.Pending}, certutil.TLSServer, certutil.TLSServer.Trust()},
+		{"distrusted", truststore.Entry{Status: truststore.Distrusted}, certutil.TLSServer, certutil.NoTrust},
+		{"distrusted after", truststore.Entry{Status: truststore.Distrusted, Trust: websites}, certutil.TLSServer, certutil.NoTrust},
+	}
+	for _, test := range tests {
+		if trust := rootTrust(test.inclusion, test.usage); trust != test.trust {
+			t.Errorf("%s: expected %v, got %v", test.name, test.trust, trust)
+		}
+	}
+}
+
+func TestVerifyChainDistrustedRoot(t *testing.T) {
+	if nss != nil {
+		t.Skipf("the NSS tools are unavailable: %v", nss)
+	}
+	p := pkitest.NewT(t)
+	trustStore.Add(truststore.Entry{Certificate: p.Root.Certificate, Status: truststore.Distrusted})
+	defer trustStore.Add(truststore.Entry{Certificate: p.Root.Certificate, Status: truststore.NotIncluded})
+	chain := []*x509.Certificate{p.Valid.Certificate, p.Intermediate.Certificate, p.Root.Certificate}
+	result := VerifyChain(context.Background(), chain, options{Usage: certutil.TLSServer})
+	if result.Inclusion.Status != truststore.Distrusted {
+		t.Errorf("expected %v, got %v", truststore.Distrusted, result.Inclusion.Status)
+	}
+	if result.Root.Expiration.Trust != certutil.NoTrust {
+		t.Errorf("expected the distrusted root to be installed without trust, got %v", result.Root.Expiration.Trust)
+	}
+	if result.PathValidation.Status == certutil.StatusValid {
+		t.Error("expected the chain to a distrusted root not to validate")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		query   string
+		accept  string
+		formats []string
+		format  string
+	}{
+		{"", "", resultFormats, formatJSON},
+		{"", "text/html;q=0.1, text/markdown", resultFormats, formatMarkdown},
+		{"", "text/plain;q=0.5, text/html;q=0.9", resultFormats, formatHTML},
+		{"", "text/html, text/plain;q=0.5", checkFormats, formatText},
+		{"", "text/html", checkFormats, formatHTML},
+		{"", "text/html, */*;q=0.1", checkFormats, formatJSON},
+		{"", "text/markdown;q=0, text/plain;q=0.2", resultFormats, formatText},
+		{"", "image/png", resultFormats, formatJSON},
+		{"md", "text/html", resultFormats, formatMarkdown},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?format="+test.query, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		if f := format(req, test.formats); f != test.format {
+			t.Errorf("%q: expected %s, got %s", test.accept, test.format, f)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html, text/markdown;q=0.5")
+	resp := httptest.NewRecorder()
+	if f, ok := negotiate(resp, req, checkFormats); !ok || f != formatMarkdown {
+		t.Errorf("expected markdown rather than a %d, got %s", resp.Code, f)
+	}
+}
+
+func TestVerifyChainWithoutNSS(t *testing.T) {
+	if nss == nil {
+		t.Skip("the NSS tools are available")
+	}
+	p := pkitest.NewT(t)
+	result := VerifyChain(context.Background(), p.Valid.Chain, options{Usage: certutil.TLSServer})
+	if result.PathValidation.Status != certutil.StatusToolFailure || result.PathValidation.Error == nil {
+		t.Errorf("expected the failure of NSS to be the path validation result, got %+v", result.PathValidation)
+	}
+	if result.Leaf.Expiration.Status != certutil.StatusToolFailure {
+		t.Errorf("expected the failure of NSS to be the leaf's expiration status, got %v", result.Leaf.Expiration.Status)
+	}
+	if !result.GoValidation.Valid {
+		t.Errorf("expected the chain to be verified without NSS, got %+v", result.GoValidation)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	if n, err := notifier("", "", "", "cacop@localhost", ""); n != nil || err != nil {
+		t.Errorf("expected no notifier, got %v, %v", n, err)
+	}
+	if _, err := notifier("", "", os.TempDir(), "cacop@localhost", ""); err == nil {
+		t.Error("expected a spool without recipients to be refused")
+	}
+	if _, err := notifier("", "", os.TempDir(), "cacop", "ops@example.com"); err == nil {
+		t.Error("expected a spool with a bad sender to be refused")
+	}
+	if _, err := notifier("", "", os.TempDir(), "cacop@localhost", "ops@example.com, security@example.com"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMonitoringUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := store.Open(filepath.Join(dir, "cacop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check := func(string, *x509.Certificate, monitor.Options) (model.TestWebsiteResult, error) {
+		return model.TestWebsiteResult{}, nil
+	}
+	if monitors, err = monitor.New(s, check, nil, time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { monitors = nil }()
+	resp := httptest.NewRecorder()
+	monitoring(resp, httptest.NewRequest(http.MethodPost, "/monitor?subject=https://example.com&expect=valid&usage=ipsec", nil))
+	if resp.Code != 400 {
+		t.Errorf("expected an unknown usage to be rejected, got %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	monitoring(resp, httptest.NewRequest(http.MethodPost, "/monitor?subject=https://example.com&expect=valid&usage=smime", nil))
+	if resp.Code != 200 {
+		t.Fatalf("expected the subject to be registered, got %d: %s", resp.Code, resp.Body)
+	}
+	if registrations := monitors.Registrations(); len(registrations) != 1 || registrations[0].Options.Usage != certutil.SMIME {
+		t.Errorf("expected the registration to keep its usage, got %+v", registrations)
+	}
+}
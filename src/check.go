@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/report"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// expectations are the outcomes of the three test websites that Mozilla
+// requires of a CA, each named by a query parameter or flag of the same name.
+var expectations = []model.Verdict{model.Valid, model.Expired, model.Revoked}
+
+// checkWebsites verifies each test website against the root, in the order of expectations.
+func checkWebsites(ctx context.Context, sites map[model.Verdict]string, root *x509.Certificate, opts options) []report.Check {
+	var checks []report.Check
+	for _, expected := range expectations {
+		subject, ok := sites[expected]
+		if !ok {
+			continue
+		}
+		result, err := testWebsite(ctx, subject, root, opts)
+		if err == nil {
+			save(result)
+		}
+		checks = append(checks, report.Check{Expected: expected, Result: result, Error: err})
+	}
+	return checks
+}
+
+// check verifies the test websites of a CA against the outcomes that they
+// ought to have. Any of the three may be omitted.
+//
+//	POST /check?valid=https://valid.example.com&expired=https://expired.example.com&revoked=https://revoked.example.com  (body: optional root PEM)
+func check(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	f, ok := negotiate(resp, req, checkFormats)
+	if !ok {
+		return
+	}
+	sites := make(map[model.Verdict]string)
+	for _, expected := range expectations {
+		if subject := req.URL.Query().Get(string(expected)); subject != "" {
+			sites[expected] = subject
+		}
+	}
+	if len(sites) == 0 {
+		resp.WriteHeader(400)
+		resp.Write([]byte("at least one of the 'valid', 'expired' or 'revoked' query parameters is required\n"))
+		return
+	}
+	opts, err := verificationOptions(req)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
+	}
+	raw, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("Error reading body: " + err.Error()))
+		return
+	}
+	var root *x509.Certificate
+	if len(raw) != 0 {
+		block, _ := pem.Decode(NormalizePEM(raw))
+		if block == nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Bad PEM\n"))
+			return
+		}
+		if root, err = x509.ParseCertificate(block.Bytes); err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Bad PEM: " + err.Error()))
+			return
+		}
+	}
+	checks := checkWebsites(req.Context(), sites, root, opts)
+	resp.Header().Set("Content-Type", contentTypes[f])
+	if err := renderChecks(resp, f, checks); err != nil {
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+	}
+}
+
+// checkCommand is the command line equivalent of POST /check.
+//
+//	cacop check -valid https://valid.example.com -expired https://expired.example.com -revoked https://revoked.example.com -root root.pem [-usage smime] [-format markdown]
+func checkCommand(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	subjects := make(map[model.Verdict]*string)
+	for _, expected := range expectations {
+		subjects[expected] = flags.String(string(expected), "", fmt.Sprintf("URL of the test website whose leaf is %s", expected))
+	}
+	rootFile := flags.String("root", "", "PEM file of the root to verify against, otherwise the chains offered by the websites are used as is")
+	t := flags.String("time", "", "RFC 3339 time at which to verify the chains, defaults to now")
+	usage := flags.String("usage", string(certutil.TLSServer), "one of tls-server, tls-client, smime or code-signing")
+	f := flags.String("format", formatMarkdown, "one of json, markdown or text")
+	flags.Parse(args)
+	sites := make(map[model.Verdict]string)
+	for expected, subject := range subjects {
+		if *subject != "" {
+			sites[expected] = *subject
+		}
+	}
+	if len(sites) == 0 {
+		return fmt.Errorf("at least one of -valid, -expired or -revoked is required")
+	}
+	if !supports(checkFormats, *f) {
+		return fmt.Errorf("-format must be one of json, markdown or text")
+	}
+	opts, err := parseOptions(*t, *usage)
+	if err != nil {
+		return err
+	}
+	var root *x509.Certificate
+	if *rootFile != "" {
+		if root, err = readRoot(*rootFile); err != nil {
+			return err
+		}
+	}
+	return renderChecks(os.Stdout, *f, checkWebsites(logging.NewContext(), sites, root, opts))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"io/ioutil"
+	"os"
+)
+
+// verify is the command line equivalent of the HTTP API.
+//
+//	cacop verify -subject https://example.com [-root root.pem] [-precert precert.pem] [-time 2019-01-02T15:04:05Z] [-usage smime] [-format markdown]
+//	cacop verify -chain chain.p7b [-root root.pem] [-precert precert.pem] [-time 2019-01-02T15:04:05Z] [-usage smime] [-format markdown]
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	subject := flags.String("subject", "", "URL of the test website, either https or one of smtp, imap, pop3, ldap or xmpp")
+	chainFile := flags.String("chain", "", "PEM bundle or PKCS#7 file of a chain to verify instead of that offered by a subject")
+	rootFile := flags.String("root", "", "PEM file of the root to verify against, otherwise the chain offered by the subject is used as is")
+	precertFile := flags.String("precert", "", "PEM or DER file of the precertificate to compare the leaf with, bundled with its precertificate signing certificate if it has one")
+	t := flags.String("time", "", "RFC 3339 time at which to verify the chain, defaults to now")
+	usage := flags.String("usage", string(certutil.TLSServer), "one of tls-server, tls-client, smime or code-signing")
+	f := flags.String("format", formatJSON, "one of json, html, markdown or text")
+	flags.Parse(args)
+	if (*subject == "") == (*chainFile == "") {
+		return fmt.Errorf("exactly one of -subject or -chain is required")
+	}
+	if !supports(resultFormats, *f) {
+		return fmt.Errorf("-format must be one of json, html, markdown or text")
+	}
+	opts, err := parseOptions(*t, *usage)
+	if err != nil {
+		return err
+	}
+	if *precertFile != "" {
+		raw, err := ioutil.ReadFile(*precertFile)
+		if err != nil {
+			return err
+		}
+		if opts.Precertificate, opts.PrecertificateSigner, err = parsePrecertificate(raw); err != nil {
+			return err
+		}
+	}
+	var result model.TestWebsiteResult
+	if *chainFile != "" {
+		result, err = verifyUpload(*chainFile, *rootFile, opts)
+	} else {
+		result, err = verifySubject(*subject, *rootFile, opts)
+	}
+	if err != nil {
+		return err
+	}
+	save(result)
+	return render(os.Stdout, *f, result)
+}
+
+func verifySubject(subject, rootFile string, opts options) (model.TestWebsiteResult, error) {
+	var root *x509.Certificate
+	if rootFile != "" {
+		var err error
+		if root, err = readRoot(rootFile); err != nil {
+			return model.TestWebsiteResult{}, err
+		}
+	}
+	return testWebsite(logging.NewContext(), subject, root, opts)
+}
+
+func verifyUpload(chainFile, rootFile string, opts options) (model.TestWebsiteResult, error) {
+	rawChain, err := ioutil.ReadFile(chainFile)
+	if err != nil {
+		return model.TestWebsiteResult{}, err
+	}
+	var rawRoot []byte
+	if rootFile != "" {
+		if rawRoot, err = ioutil.ReadFile(rootFile); err != nil {
+			return model.TestWebsiteResult{}, err
+		}
+	}
+	return testUpload(logging.NewContext(), rawChain, rawRoot, opts)
+}
+
+// parseOptions parses the -time and -usage flags.
+func parseOptions(t, usage string) (options, error) {
+	at, err := verificationTime(t)
+	if err != nil {
+		return options{}, fmt.Errorf("-time %s", err)
+	}
+	u, err := certutil.ParseUsage(usage)
+	if err != nil {
+		return options{}, fmt.Errorf("bad -usage: %s", err)
+	}
+	return options{At: at, Usage: u}, nil
+}
+
+// compareRuns is the command line equivalent of GET /diff.
+//
+//	cacop diff -from 41 -to 42
+//	cacop diff -subject https://example.com
+func compareRuns(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := flags.Uint64("from", 0, "id of the earlier run")
+	to := flags.Uint64("to", 0, "id of the later run")
+	subject := flags.String("subject", "", "compare the two most recent runs of this subject instead")
+	flags.Parse(args)
+	if results == nil {
+		return fmt.Errorf("diff requires a result store")
+	}
+	if *subject == "" && (*from == 0 || *to == 0) {
+		return fmt.Errorf("either -subject or both -from and -to are required")
+	}
+	d, err := diffRuns(*from, *to, *subject)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(d)
+}
+
+func readRoot(path string) (*x509.Certificate, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(NormalizePEM(raw))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
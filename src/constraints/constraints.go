@@ -0,0 +1,483 @@
+package constraints
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// RFC 5280
+//
+// 6.1.  Basic Path Validation
+//
+// The algorithm presented in this section validates the certificate with
+// respect to the current date and time.  A conforming implementation MAY
+// also support validation with respect to some point in the past.
+//
+// Only the name constraints and certificate policy portions of the
+// algorithm are carried out here, as NSS and Go already check everything
+// else. Neither reports which certificate broke which constraint though.
+
+// The kinds of name that are constrained.
+const (
+	DNS   = "dns"
+	IP    = "ip"
+	Email = "email"
+	URI   = "uri"
+	// DirectoryName subtrees are distinguished names in the form of RFC 4514.
+	DirectoryName = "dn"
+)
+
+// AnyPolicy is the special policy that stands for every policy.
+const AnyPolicy = "2.5.29.32.0"
+
+// Result is the effect of every constraint within the chain upon the leaf.
+type Result struct {
+	// Permitted are the names that the leaf may have, by kind. A kind that is
+	// absent is unconstrained, whereas an empty list permits nothing.
+	Permitted map[string][]string `json:",omitempty"`
+	// Excluded are the names that the leaf may not have, by kind.
+	Excluded map[string][]string `json:",omitempty"`
+	// ValidPolicies are the policies under which the leaf was issued, as
+	// constrained by each of its issuers. It is empty if no policy remains.
+	ValidPolicies []string
+	// ExplicitPolicyRequired is set when a policy constraint demands that at
+	// least one policy remain valid.
+	ExplicitPolicyRequired bool
+}
+
+// constraint is the name constraints of a single CA.
+type constraint struct {
+	ca        string
+	permitted map[string][]string
+	excluded  map[string][]string
+}
+
+// VerifyChain evaluates the name constraints, policy constraints, inhibit
+// anyPolicy and certificate policies of the chain, leaf first. Violations
+// are returned for each certificate of the chain in the same order.
+//
+// The root is the trust anchor, so its policies are not processed. Its name
+// constraints are though, as NSS enforces those of a constrained root.
+func VerifyChain(chain []*x509.Certificate) (Result, [][]string) {
+	violations := make([][]string, len(chain))
+	result := Result{}
+	var active []constraint
+	for i := len(chain) - 1; i >= 0; i-- {
+		cert := chain[i]
+		// Self-issued intermediates are exempt, lest a CA be unable to roll over its key.
+		if i != len(chain)-1 && (i == 0 || !selfIssued(cert)) {
+			for _, c := range active {
+				violations[i] = append(violations[i], c.check(cert)...)
+			}
+		}
+		c, ok := constraintOf(cert)
+		if !ok {
+			continue
+		}
+		if !cert.IsCA {
+			violations[i] = append(violations[i], "has name constraints yet is not a CA")
+			continue
+		}
+		active = append(active, c)
+		result.Permitted = intersect(result.Permitted, c.permitted)
+		result.Excluded = union(result.Excluded, c.excluded)
+	}
+	policies, explicit, policyViolations := policiesOf(chain)
+	for i := range chain {
+		violations[i] = append(violations[i], policyViolations[i]...)
+	}
+	result.ValidPolicies = policies
+	result.ExplicitPolicyRequired = explicit
+	return result, violations
+}
+
+func constraintOf(cert *x509.Certificate) (constraint, bool) {
+	c := constraint{
+		ca:        name(cert),
+		permitted: make(map[string][]string),
+		excluded:  make(map[string][]string),
+	}
+	add := func(m map[string][]string, kind string, names []string) {
+		if len(names) != 0 {
+			m[kind] = lower(names)
+		}
+	}
+	add(c.permitted, DNS, cert.PermittedDNSDomains)
+	add(c.permitted, IP, ranges(cert.PermittedIPRanges))
+	add(c.permitted, Email, cert.PermittedEmailAddresses)
+	add(c.permitted, URI, cert.PermittedURIDomains)
+	add(c.excluded, DNS, cert.ExcludedDNSDomains)
+	add(c.excluded, IP, ranges(cert.ExcludedIPRanges))
+	add(c.excluded, Email, cert.ExcludedEmailAddresses)
+	add(c.excluded, URI, cert.ExcludedURIDomains)
+	permitted, excluded := directoryNamesOf(cert)
+	add(c.permitted, DirectoryName, permitted)
+	add(c.excluded, DirectoryName, excluded)
+	return c, len(c.permitted) != 0 || len(c.excluded) != 0
+}
+
+// RFC 5280
+//
+// 4.2.1.10.  Name Constraints
+//
+//	NameConstraints ::= SEQUENCE {
+//	     permittedSubtrees       [0]     GeneralSubtrees OPTIONAL,
+//	     excludedSubtrees        [1]     GeneralSubtrees OPTIONAL }
+//
+//	GeneralSubtrees ::= SEQUENCE SIZE (1..MAX) OF GeneralSubtree
+//
+//	GeneralSubtree ::= SEQUENCE {
+//	     base                    GeneralName,
+//	     minimum         [0]     BaseDistance DEFAULT 0,
+//	     maximum         [1]     BaseDistance OPTIONAL }
+//
+// Go leaves directoryName [4] subtrees unparsed, so they are read here.
+
+var idNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+type nameConstraints struct {
+	Permitted []generalSubtree `asn1:"optional,tag:0"`
+	Excluded  []generalSubtree `asn1:"optional,tag:1"`
+}
+
+type generalSubtree struct {
+	Base asn1.RawValue
+	Rest asn1.RawContent `asn1:"optional"`
+}
+
+func directoryNamesOf(cert *x509.Certificate) (permitted, excluded []string) {
+	for _, e := range cert.Extensions {
+		if !e.Id.Equal(idNameConstraints) {
+			continue
+		}
+		var constraints nameConstraints
+		if _, err := asn1.Unmarshal(e.Value, &constraints); err != nil {
+			// Go would have refused to parse the certificate.
+			return nil, nil
+		}
+		return directoryNames(constraints.Permitted), directoryNames(constraints.Excluded)
+	}
+	return nil, nil
+}
+
+func directoryNames(subtrees []generalSubtree) []string {
+	var names []string
+	for _, subtree := range subtrees {
+		// directoryName [4] Name, explicitly tagged as Name is a CHOICE.
+		if subtree.Base.Class != asn1.ClassContextSpecific || subtree.Base.Tag != 4 {
+			continue
+		}
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(subtree.Base.Bytes, &rdns); err != nil {
+			continue
+		}
+		names = append(names, rdns.String())
+	}
+	return names
+}
+
+// check lists every name of the certificate that the constraint forbids.
+func (c constraint) check(cert *x509.Certificate) []string {
+	var violations []string
+	for _, n := range namesOf(cert) {
+		if permitted, ok := c.permitted[n.kind]; ok && !matchesAny(n.kind, permitted, n.name) {
+			violations = append(violations, fmt.Sprintf("%s %s is not permitted by the name constraints of %s", n.kind, n.name, c.ca))
+		}
+		if matchesAny(n.kind, c.excluded[n.kind], n.name) {
+			violations = append(violations, fmt.Sprintf("%s %s is excluded by the name constraints of %s", n.kind, n.name, c.ca))
+		}
+	}
+	return violations
+}
+
+type kindName struct {
+	kind string
+	name string
+}
+
+func namesOf(cert *x509.Certificate) []kindName {
+	var names []kindName
+	for _, n := range cert.DNSNames {
+		names = append(names, kindName{DNS, strings.ToLower(n)})
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, kindName{IP, ip.String()})
+	}
+	for _, n := range cert.EmailAddresses {
+		names = append(names, kindName{Email, strings.ToLower(n)})
+	}
+	for _, u := range cert.URIs {
+		names = append(names, kindName{URI, strings.ToLower(u.String())})
+	}
+	var subject pkix.RDNSequence
+	if _, err := asn1.Unmarshal(cert.RawSubject, &subject); err == nil && len(subject) != 0 {
+		names = append(names, kindName{DirectoryName, strings.ToLower(subject.String())})
+	}
+	// A leaf without subject alternative names is named by its common name,
+	// which is what clients that still fall back to it are held to.
+	if !cert.IsCA && len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 && hostname(cert.Subject.CommonName) {
+		names = append(names, kindName{DNS, strings.ToLower(cert.Subject.CommonName)})
+	}
+	return names
+}
+
+// hostname reports whether the common name is a fully qualified domain name,
+// possibly a wildcard, rather than the name of an organization or a person.
+func hostname(cn string) bool {
+	if !strings.Contains(cn, ".") || net.ParseIP(cn) != nil {
+		return false
+	}
+	for i, label := range strings.Split(cn, ".") {
+		if label == "" || i == 0 && label == "*" {
+			continue
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAny(kind string, constraints []string, name string) bool {
+	for _, c := range constraints {
+		if matches(kind, c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the name falls within the subtree as described by
+// RFC 5280 section 4.2.1.10.
+func matches(kind, subtree, name string) bool {
+	switch kind {
+	case DNS:
+		// Any name that can be constructed by adding labels to the left.
+		return matchesDomain(subtree, name, true)
+	case IP:
+		_, network, err := net.ParseCIDR(subtree)
+		ip := net.ParseIP(name)
+		if err != nil || ip == nil {
+			return false
+		}
+		if v4 := ip.To4(); v4 != nil && len(network.IP) == net.IPv4len {
+			ip = v4
+		}
+		return len(ip) == len(network.IP) && network.Contains(ip)
+	case Email:
+		// A mailbox, a particular host, or any host within a domain.
+		if strings.Contains(subtree, "@") {
+			return subtree == name
+		}
+		at := strings.LastIndex(name, "@")
+		return matchesDomain(subtree, name[at+1:], false)
+	case URI:
+		// A particular host or any host within a domain.
+		return matchesDomain(subtree, hostOf(name), false)
+	case DirectoryName:
+		// Any name whose RDN sequence begins with that of the subtree, which
+		// RFC 4514 writes last.
+		base, rdns := splitRDNs(subtree), splitRDNs(name)
+		if len(base) > len(rdns) {
+			return false
+		}
+		for i := range base {
+			if base[len(base)-1-i] != rdns[len(rdns)-1-i] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchesDomain matches a host against a subtree which, when it begins with
+// a period, is any host within the domain. Otherwise it is the host itself
+// and, for DNS names alone, any host within it.
+func matchesDomain(subtree, host string, within bool) bool {
+	switch {
+	case subtree == "":
+		return true
+	case host == "":
+		return false
+	case strings.HasPrefix(subtree, "."):
+		return strings.HasSuffix(host, subtree)
+	}
+	return host == subtree || within && strings.HasSuffix(host, "."+subtree)
+}
+
+// splitRDNs splits a distinguished name in the form of RFC 4514 at every
+// comma that is not escaped.
+func splitRDNs(dn string) []string {
+	var rdns []string
+	start, escaped := 0, false
+	for i, r := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			rdns = append(rdns, dn[start:i])
+			start = i + 1
+		}
+	}
+	if dn != "" {
+		rdns = append(rdns, dn[start:])
+	}
+	return rdns
+}
+
+func hostOf(uri string) string {
+	rest := uri
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(rest); err == nil {
+		return host
+	}
+	return rest
+}
+
+// within reports whether every name in subtree a also falls within subtree b.
+// As subtrees are no more than suffixes, a name of a, or a name beneath it,
+// stands in for all of them.
+func within(kind, a, b string) bool {
+	switch kind {
+	case IP:
+		_, x, errX := net.ParseCIDR(a)
+		_, y, errY := net.ParseCIDR(b)
+		if errX != nil || errY != nil || len(x.IP) != len(y.IP) {
+			return false
+		}
+		xOnes, _ := x.Mask.Size()
+		yOnes, _ := y.Mask.Size()
+		return xOnes >= yOnes && y.Contains(x.IP)
+	case Email:
+		if strings.Contains(a, "@") {
+			return matches(kind, b, a)
+		}
+		if strings.Contains(b, "@") {
+			return false
+		}
+	case DirectoryName:
+		return matches(kind, b, a)
+	}
+	switch {
+	case b == "":
+		return true
+	case a == "":
+		return false
+	case strings.HasPrefix(a, "."):
+		return matchesDomain(b, "x"+a, kind == DNS)
+	case kind == DNS:
+		return matchesDomain(b, a, true) && matchesDomain(b, "x."+a, true)
+	}
+	return matchesDomain(b, a, false)
+}
+
+// intersect narrows the permitted subtrees so far by those of another CA.
+func intersect(permitted, by map[string][]string) map[string][]string {
+	if len(by) == 0 {
+		return permitted
+	}
+	result := make(map[string][]string)
+	for kind, subtrees := range permitted {
+		result[kind] = subtrees
+	}
+	for kind, subtrees := range by {
+		current, ok := result[kind]
+		if !ok {
+			result[kind] = subtrees
+			continue
+		}
+		narrowed := []string{}
+		for _, a := range current {
+			for _, b := range subtrees {
+				switch {
+				case within(kind, a, b):
+					narrowed = appendUnique(narrowed, a)
+				case within(kind, b, a):
+					narrowed = appendUnique(narrowed, b)
+				}
+			}
+		}
+		result[kind] = narrowed
+	}
+	return result
+}
+
+func union(excluded, by map[string][]string) map[string][]string {
+	if len(by) == 0 {
+		return excluded
+	}
+	result := make(map[string][]string)
+	for kind, subtrees := range excluded {
+		result[kind] = subtrees
+	}
+	for kind, subtrees := range by {
+		for _, subtree := range subtrees {
+			result[kind] = appendUnique(result[kind], subtree)
+		}
+	}
+	return result
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func ranges(networks []*net.IPNet) []string {
+	var r []string
+	for _, n := range networks {
+		r = append(r, n.String())
+	}
+	return r
+}
+
+func lower(names []string) []string {
+	l := make([]string, len(names))
+	for i, n := range names {
+		l[i] = strings.ToLower(n)
+	}
+	return l
+}
+
+func selfIssued(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
+
+func name(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+func sorted(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for policy := range set {
+		list = append(list, policy)
+	}
+	sort.Strings(list)
+	return list
+}
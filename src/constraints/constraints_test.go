@@ -0,0 +1,347 @@
+package constraints
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/pkitest"
+)
+
+var (
+	policyA = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	policyB = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+	any     = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+)
+
+func ca(name string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+}
+
+func leaf(names ...string) *x509.Certificate {
+	template := &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, n)
+		}
+	}
+	return template
+}
+
+// chainOf issues each template with the one before it, beginning with a self
+// signed root, and returns the chain leaf first.
+func chainOf(t *testing.T, templates ...*x509.Certificate) []*x509.Certificate {
+	p := pkitest.NewT(t)
+	chain := make([]*x509.Certificate, len(templates))
+	var issuer *pkitest.Authority
+	for i, template := range templates {
+		template.NotBefore = p.Now.Add(-time.Hour)
+		template.NotAfter = p.Now.Add(time.Hour)
+		var err error
+		if i == len(templates)-1 {
+			chain[0], err = p.Issue(issuer, template, p.Valid.Key.Public())
+		} else if issuer, err = p.NewAuthority(issuer, template); err == nil {
+			chain[len(templates)-1-i] = issuer.Certificate
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chain
+}
+
+func TestNameConstraints(t *testing.T) {
+	intermediate := ca("Constrained Intermediate")
+	intermediate.PermittedDNSDomains = []string{"example.com"}
+	intermediate.ExcludedDNSDomains = []string{"bad.example.com"}
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	intermediate.PermittedIPRanges = []*net.IPNet{network}
+	tests := []struct {
+		leaf      *x509.Certificate
+		violation string
+	}{
+		{leaf("www.example.com", "10.1.2.3"), ""},
+		{leaf("example.com"), ""},
+		{leaf("www.example.org"), "dns www.example.org is not permitted by the name constraints of Constrained Intermediate"},
+		{leaf("x.bad.example.com"), "dns x.bad.example.com is excluded by the name constraints of Constrained Intermediate"},
+		{leaf("192.168.0.1"), "ip 192.168.0.1 is not permitted by the name constraints of Constrained Intermediate"},
+	}
+	for _, test := range tests {
+		result, violations := VerifyChain(chainOf(t, ca("Root"), intermediate, test.leaf))
+		got := strings.Join(violations[0], "\n")
+		if got != test.violation {
+			t.Errorf("%v %v: expected %q, got %q", test.leaf.DNSNames, test.leaf.IPAddresses, test.violation, got)
+		}
+		if len(violations[1]) != 0 || len(violations[2]) != 0 {
+			t.Errorf("expected no violations by the CAs, got %v", violations)
+		}
+		if !reflect.DeepEqual(result.Permitted[DNS], []string{"example.com"}) || !reflect.DeepEqual(result.Excluded[DNS], []string{"bad.example.com"}) {
+			t.Errorf("unexpected effective subtrees %+v", result)
+		}
+	}
+}
+
+// directoryNameConstraints are name constraints of directoryName subtrees
+// alone, which Go cannot write.
+func directoryNameConstraints(t *testing.T, permitted, excluded []pkix.Name) pkix.Extension {
+	type subtree struct {
+		Base asn1.RawValue
+	}
+	subtrees := func(names []pkix.Name) []subtree {
+		var s []subtree
+		for _, n := range names {
+			der, err := asn1.Marshal(n.ToRDNSequence())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s = append(s, subtree{asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: der}})
+		}
+		return s
+	}
+	value, err := asn1.Marshal(struct {
+		Permitted []subtree `asn1:"optional,omitempty,tag:0"`
+		Excluded  []subtree `asn1:"optional,omitempty,tag:1"`
+	}{subtrees(permitted), subtrees(excluded)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: idNameConstraints, Critical: true, Value: value}
+}
+
+func TestDirectoryNameConstraints(t *testing.T) {
+	intermediate := ca("Directory Constrained Intermediate")
+	intermediate.ExtraExtensions = []pkix.Extension{directoryNameConstraints(t,
+		[]pkix.Name{{Country: []string{"US"}, Organization: []string{"Example, Inc."}}},
+		[]pkix.Name{{Country: []string{"US"}, Organization: []string{"Example, Inc."}, OrganizationalUnit: []string{"Revoked"}}},
+	)}
+	subject := func(organization, unit string) *x509.Certificate {
+		template := leaf("www.example.com")
+		template.Subject = pkix.Name{Country: []string{"US"}, Organization: []string{organization}, CommonName: "www.example.com"}
+		if unit != "" {
+			template.Subject.OrganizationalUnit = []string{unit}
+		}
+		return template
+	}
+	tests := []struct {
+		leaf      *x509.Certificate
+		violation string
+	}{
+		{subject("Example, Inc.", ""), ""},
+		{subject("Example, Inc.", "Web"), ""},
+		{subject("Example", ""), `dn cn=www.example.com,o=example,c=us is not permitted by the name constraints of Directory Constrained Intermediate`},
+		{subject("Example, Inc.", "Revoked"), `dn cn=www.example.com,ou=revoked,o=example\, inc.,c=us is excluded by the name constraints of Directory Constrained Intermediate`},
+	}
+	for _, test := range tests {
+		result, violations := VerifyChain(chainOf(t, ca("Root"), intermediate, test.leaf))
+		if got := strings.Join(violations[0], "\n"); got != test.violation {
+			t.Errorf("%v: expected %q, got %q", test.leaf.Subject, test.violation, got)
+		}
+		if !reflect.DeepEqual(result.Permitted[DirectoryName], []string{`o=example\, inc.,c=us`}) {
+			t.Errorf("unexpected effective subtrees %+v", result.Permitted)
+		}
+	}
+}
+
+func TestCommonNameConstraints(t *testing.T) {
+	intermediate := ca("Constrained Intermediate")
+	intermediate.PermittedDNSDomains = []string{"example.com"}
+	tests := []struct {
+		cn        string
+		violation string
+	}{
+		{"www.example.com", ""},
+		{"www.example.org", "dns www.example.org is not permitted by the name constraints of Constrained Intermediate"},
+		// Not a host name, so not a name that constraints apply to.
+		{"Example Leaf", ""},
+	}
+	for _, test := range tests {
+		template := leaf()
+		template.Subject.CommonName = test.cn
+		_, violations := VerifyChain(chainOf(t, ca("Root"), intermediate, template))
+		if got := strings.Join(violations[0], "\n"); got != test.violation {
+			t.Errorf("%s: expected %q, got %q", test.cn, test.violation, got)
+		}
+	}
+	// The common name is ignored in favor of subject alternative names.
+	template := leaf("www.example.com")
+	template.Subject.CommonName = "www.example.org"
+	if _, violations := VerifyChain(chainOf(t, ca("Root"), intermediate, template)); len(violations[0]) != 0 {
+		t.Errorf("expected the common name to be ignored, got %v", violations[0])
+	}
+}
+func TestEffectiveSubtrees(t *testing.T) {
+	root := ca("Root")
+	root.PermittedDNSDomains = []string{"example.com"}
+	root.ExcludedDNSDomains = []string{"a.example.com"}
+	intermediate := ca("Intermediate")
+	intermediate.PermittedDNSDomains = []string{".sub.example.com", "example.org"}
+	intermediate.ExcludedDNSDomains = []string{"b.example.com"}
+	intermediate.PermittedEmailAddresses = []string{"ca@example.com"}
+	result, violations := VerifyChain(chainOf(t, root, intermediate, leaf("www.sub.example.com")))
+	if !reflect.DeepEqual(result.Permitted, map[string][]string{DNS: {".sub.example.com"}, Email: {"ca@example.com"}}) {
+		t.Errorf("unexpected permitted subtrees %v", result.Permitted)
+	}
+	if !reflect.DeepEqual(result.Excluded, map[string][]string{DNS: {"a.example.com", "b.example.com"}}) {
+		t.Errorf("unexpected excluded subtrees %v", result.Excluded)
+	}
+	if len(violations[0]) != 0 || len(violations[1]) != 0 {
+		t.Errorf("unexpected violations %v", violations)
+	}
+	// The intermediate's own name of example.org escapes the root's constraints.
+	_, violations = VerifyChain(chainOf(t, root, intermediate, leaf("www.example.org")))
+	if len(violations[0]) != 1 || !strings.Contains(violations[0][0], "name constraints of Root") {
+		t.Errorf("expected the root's constraints to apply to the leaf, got %v", violations)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		kind    string
+		subtree string
+		name    string
+		matches bool
+	}{
+		{DNS, "example.com", "example.com", true},
+		{DNS, "example.com", "www.example.com", true},
+		{DNS, "example.com", "wwwexample.com", false},
+		{DNS, ".example.com", "example.com", false},
+		{DNS, ".example.com", "www.example.com", true},
+		{DNS, "", "anything.example", true},
+		{Email, "ca@example.com", "ca@example.com", true},
+		{Email, "ca@example.com", "other@example.com", false},
+		{Email, "example.com", "ca@example.com", true},
+		{Email, "example.com", "ca@mail.example.com", false},
+		{Email, ".example.com", "ca@mail.example.com", true},
+		{URI, "example.com", "https://example.com:8443/path", true},
+		{URI, "example.com", "https://www.example.com/", false},
+		{URI, ".example.com", "https://www.example.com/", true},
+		{IP, "10.0.0.0/8", "10.255.0.1", true},
+		{IP, "10.0.0.0/8", "11.0.0.1", false},
+		{IP, "10.0.0.0/8", "::ffff:10.0.0.1", true},
+		{IP, "fd00::/8", "10.0.0.1", false},
+	}
+	for _, test := range tests {
+		if matches := matches(test.kind, test.subtree, test.name); matches != test.matches {
+			t.Errorf("%s %q against %q: expected %v, got %v", test.kind, test.subtree, test.name, test.matches, matches)
+		}
+	}
+}
+
+func TestNotCA(t *testing.T) {
+	constrained := leaf("www.example.com")
+	constrained.PermittedDNSDomains = []string{"example.com"}
+	_, violations := VerifyChain(chainOf(t, ca("Root"), constrained))
+	if len(violations[0]) != 1 || violations[0][0] != "has name constraints yet is not a CA" {
+		t.Errorf("unexpected violations %v", violations)
+	}
+}
+
+func withPolicies(template *x509.Certificate, policies ...asn1.ObjectIdentifier) *x509.Certificate {
+	template.PolicyIdentifiers = append(template.PolicyIdentifiers, policies...)
+	return template
+}
+
+func withExtension(t *testing.T, template *x509.Certificate, id asn1.ObjectIdentifier, value interface{}) *x509.Certificate {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: id, Value: der})
+	return template
+}
+
+func TestPolicies(t *testing.T) {
+	// PolicyConstraints ::= SEQUENCE { requireExplicitPolicy [0] SkipCerts OPTIONAL, ... }
+	// encoding/asn1 would omit an optional zero, so it is spelled out.
+	requireExplicit := asn1.RawValue{FullBytes: []byte{0x30, 0x03, 0x80, 0x01, 0x00}}
+	type mapping struct {
+		Issuer, Subject asn1.ObjectIdentifier
+	}
+	tests := []struct {
+		name         string
+		intermediate *x509.Certificate
+		leaf         *x509.Certificate
+		valid        []string
+		explicit     bool
+		violation    string
+	}{
+		{
+			name:         "asserted",
+			intermediate: withPolicies(ca("Intermediate"), policyA),
+			leaf:         withPolicies(leaf(), policyA),
+			valid:        []string{policyA.String()},
+		},
+		{
+			name:         "anyPolicy",
+			intermediate: withPolicies(ca("Intermediate"), any),
+			leaf:         withPolicies(leaf(), policyA, policyB),
+			valid:        []string{policyA.String(), policyB.String()},
+		},
+		{
+			name:         "not asserted by the intermediate",
+			intermediate: withPolicies(ca("Intermediate"), policyA),
+			leaf:         withPolicies(leaf(), policyB),
+		},
+		{
+			name:         "explicit policy required",
+			intermediate: withExtension(t, withPolicies(ca("Intermediate"), policyA), idPolicyConstraints, requireExplicit),
+			leaf:         withPolicies(leaf(), policyB),
+			explicit:     true,
+			violation:    "an explicit policy is required, yet no policy remains valid",
+		},
+		{
+			name:         "explicit policy satisfied",
+			intermediate: withExtension(t, withPolicies(ca("Intermediate"), policyA), idPolicyConstraints, requireExplicit),
+			leaf:         withPolicies(leaf(), policyA),
+			valid:        []string{policyA.String()},
+			explicit:     true,
+		},
+		{
+			name:         "anyPolicy inhibited",
+			intermediate: withExtension(t, withPolicies(ca("Intermediate"), policyA), idInhibitAnyPolicy, 0),
+			leaf:         withPolicies(leaf(), any),
+		},
+		{
+			name:         "mapped",
+			intermediate: withExtension(t, withPolicies(ca("Intermediate"), policyA), idPolicyMappings, []mapping{{policyA, policyB}}),
+			leaf:         withPolicies(leaf(), policyB),
+			valid:        []string{policyB.String()},
+		},
+		{
+			name:         "anyPolicy mapped",
+			intermediate: withExtension(t, withPolicies(ca("Intermediate"), policyA), idPolicyMappings, []mapping{{any, policyB}}),
+			leaf:         withPolicies(leaf(), policyA),
+			valid:        []string{policyA.String()},
+		},
+	}
+	for _, test := range tests {
+		result, violations := VerifyChain(chainOf(t, ca("Root"), test.intermediate, test.leaf))
+		if len(result.ValidPolicies) != 0 || len(test.valid) != 0 {
+			if !reflect.DeepEqual(result.ValidPolicies, test.valid) {
+				t.Errorf("%s: expected the valid policies %v, got %v", test.name, test.valid, result.ValidPolicies)
+			}
+		}
+		if result.ExplicitPolicyRequired != test.explicit {
+			t.Errorf("%s: expected an explicit policy to be required: %v", test.name, test.explicit)
+		}
+		if got := strings.Join(violations[0], "\n"); got != test.violation {
+			t.Errorf("%s: expected the violation %q, got %q", test.name, test.violation, got)
+		}
+	}
+	_, violations := VerifyChain(chainOf(t, ca("Root"), tests[len(tests)-1].intermediate, withPolicies(leaf(), policyA)))
+	if len(violations[1]) != 1 || !strings.Contains(violations[1][0], "anyPolicy may not be mapped") {
+		t.Errorf("expected the intermediate to be faulted for mapping anyPolicy, got %v", violations)
+	}
+}
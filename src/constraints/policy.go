@@ -0,0 +1,230 @@
+package constraints
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+// RFC 5280
+//
+// 6.1.2.  Initialization
+//
+// (d)  explicit_policy:  an integer that indicates if a non-NULL
+// valid_policy_tree is required.  The integer indicates the
+// number of non-self-issued certificates to be processed before
+// this requirement is imposed.
+//
+// (e)  inhibit_anyPolicy:  an integer that indicates whether the
+// anyPolicy policy identifier is considered a match.
+//
+// (f)  policy_mapping:  an integer that indicates if policy mapping
+// is permitted.
+//
+// The valid_policy_tree is kept as the set of policies that the next
+// certificate is expected to assert, which is all that the outcome depends
+// upon as the initial policy set is anyPolicy. A nil set is the NULL tree.
+// Policies that were mapped are thus reported in the domain of the leaf's
+// issuer rather than that of the root.
+
+// policiesOf processes the certificate policies of every certificate beneath
+// the root, returning the valid policies of the leaf, whether an explicit
+// policy was required, and the violations of each certificate.
+func policiesOf(chain []*x509.Certificate) ([]string, bool, [][]string) {
+	violations := make([][]string, len(chain))
+	n := len(chain) - 1
+	valid := map[string]bool{AnyPolicy: true}
+	explicit, inhibitAny, mapping := n+1, n+1, n+1
+	for i := 1; i <= n; i++ {
+		index := n - i
+		cert := chain[index]
+		leaf := i == n
+		if len(cert.Policies) == 0 && len(cert.PolicyIdentifiers) == 0 {
+			valid = nil
+		} else if valid != nil {
+			valid = narrow(valid, policyIDs(cert), inhibitAny > 0 || !leaf && selfIssued(cert))
+		}
+		fail := func() {
+			if explicit == 0 && valid == nil {
+				violations[index] = append(violations[index], "an explicit policy is required, yet no policy remains valid")
+				// Reported once, where it first fails, rather than for every certificate beneath.
+				explicit = -1
+			}
+		}
+		fail()
+		if !leaf {
+			var err error
+			if valid, err = applyMappings(valid, cert, mapping > 0); err != nil {
+				violations[index] = append(violations[index], err.Error())
+			}
+			if !selfIssued(cert) {
+				explicit, mapping, inhibitAny = decrement(explicit), decrement(mapping), decrement(inhibitAny)
+			}
+			c := policyConstraintsOf(cert)
+			if c.requireExplicitPolicy >= 0 && c.requireExplicitPolicy < explicit {
+				explicit = c.requireExplicitPolicy
+			}
+			if c.inhibitPolicyMapping >= 0 && c.inhibitPolicyMapping < mapping {
+				mapping = c.inhibitPolicyMapping
+			}
+			if c.inhibitAnyPolicy >= 0 && c.inhibitAnyPolicy < inhibitAny {
+				inhibitAny = c.inhibitAnyPolicy
+			}
+		} else {
+			explicit = decrement(explicit)
+			if policyConstraintsOf(cert).requireExplicitPolicy == 0 {
+				explicit = 0
+			}
+			fail()
+		}
+	}
+	return sorted(valid), explicit <= 0, violations
+}
+
+// narrow keeps those valid policies that the certificate asserts, along with
+// everything already valid if the certificate asserts anyPolicy and it is
+// not inhibited.
+func narrow(valid map[string]bool, policies []string, anyPolicy bool) map[string]bool {
+	narrowed := make(map[string]bool)
+	for _, policy := range policies {
+		switch {
+		case policy == AnyPolicy:
+			if anyPolicy {
+				for p := range valid {
+					narrowed[p] = true
+				}
+			}
+		case valid[policy] || valid[AnyPolicy]:
+			narrowed[policy] = true
+		}
+	}
+	if len(narrowed) == 0 {
+		return nil
+	}
+	return narrowed
+}
+
+// applyMappings replaces each issuer domain policy with the subject domain
+// policies that it maps to or, if mapping is inhibited, drops it.
+func applyMappings(valid map[string]bool, cert *x509.Certificate, permitted bool) (map[string]bool, error) {
+	mappings := policyConstraintsOf(cert).mappings
+	if len(mappings) == 0 {
+		return valid, nil
+	}
+	subjects := make(map[string][]string)
+	for _, m := range mappings {
+		issuer, subject := m.IssuerDomainPolicy.String(), m.SubjectDomainPolicy.String()
+		if issuer == AnyPolicy || subject == AnyPolicy {
+			return valid, fmt.Errorf("maps %s to %s, but anyPolicy may not be mapped", issuer, subject)
+		}
+		subjects[issuer] = append(subjects[issuer], subject)
+	}
+	if valid == nil {
+		return nil, nil
+	}
+	mapped := make(map[string]bool)
+	for policy := range valid {
+		if _, ok := subjects[policy]; !ok {
+			mapped[policy] = true
+		}
+	}
+	for issuer, targets := range subjects {
+		if !permitted || !valid[issuer] && !valid[AnyPolicy] {
+			continue
+		}
+		for _, subject := range targets {
+			mapped[subject] = true
+		}
+	}
+	if len(mapped) == 0 {
+		return nil, nil
+	}
+	return mapped, nil
+}
+
+func policyIDs(cert *x509.Certificate) []string {
+	var ids []string
+	for _, policy := range cert.Policies {
+		ids = append(ids, policy.String())
+	}
+	if len(ids) != 0 {
+		return ids
+	}
+	for _, policy := range cert.PolicyIdentifiers {
+		ids = append(ids, policy.String())
+	}
+	return ids
+}
+
+// RFC 5280
+//
+// 4.2.1.5.  Policy Mappings
+//
+//	PolicyMappings ::= SEQUENCE SIZE (1..MAX) OF SEQUENCE {
+//	     issuerDomainPolicy      CertPolicyId,
+//	     subjectDomainPolicy     CertPolicyId }
+//
+// 4.2.1.11.  Policy Constraints
+//
+//	PolicyConstraints ::= SEQUENCE {
+//	     requireExplicitPolicy           [0] SkipCerts OPTIONAL,
+//	     inhibitPolicyMapping            [1] SkipCerts OPTIONAL }
+//
+// 4.2.1.14.  Inhibit anyPolicy
+//
+//	InhibitAnyPolicy ::= SkipCerts
+//
+// crypto/x509 only parses these as of Go 1.24, so they are read here.
+
+var (
+	idPolicyMappings    = asn1.ObjectIdentifier{2, 5, 29, 33}
+	idPolicyConstraints = asn1.ObjectIdentifier{2, 5, 29, 36}
+	idInhibitAnyPolicy  = asn1.ObjectIdentifier{2, 5, 29, 54}
+)
+
+type policyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+// policyConstraints are the skip certs of each constraint, which are -1 when
+// the constraint is absent, and the policy mappings of a certificate.
+type policyConstraints struct {
+	requireExplicitPolicy int
+	inhibitPolicyMapping  int
+	inhibitAnyPolicy      int
+	mappings              []policyMapping
+}
+
+// policyConstraintsOf reads the policy extensions of the certificate. Those
+// that are malformed are ignored, as Go rejects such a certificate outright.
+func policyConstraintsOf(cert *x509.Certificate) policyConstraints {
+	c := policyConstraints{requireExplicitPolicy: -1, inhibitPolicyMapping: -1, inhibitAnyPolicy: -1}
+	for _, e := range cert.Extensions {
+		switch {
+		case e.Id.Equal(idPolicyMappings):
+			asn1.Unmarshal(e.Value, &c.mappings)
+		case e.Id.Equal(idPolicyConstraints):
+			var constraints struct {
+				RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+				InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+			}
+			if _, err := asn1.Unmarshal(e.Value, &constraints); err == nil {
+				c.requireExplicitPolicy = constraints.RequireExplicitPolicy
+				c.inhibitPolicyMapping = constraints.InhibitPolicyMapping
+			}
+		case e.Id.Equal(idInhibitAnyPolicy):
+			if _, err := asn1.Unmarshal(e.Value, &c.inhibitAnyPolicy); err != nil {
+				c.inhibitAnyPolicy = -1
+			}
+		}
+	}
+	return c
+}
+
+func decrement(n int) int {
+	if n > 0 {
+		return n - 1
+	}
+	return n
+}
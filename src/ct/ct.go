@@ -0,0 +1,212 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+)
+
+// RFC 6962
+//
+// 3.1.  Log Entries
+//
+// The Precertificate is constructed from the certificate to be issued by
+// adding a special critical poison extension (OID
+// 1.3.6.1.4.1.11129.2.4.3, whose extnValue OCTET STRING contains
+// ASN.1 NULL data (0x05 0x00)) to the end-entity TBSCertificate (this
+// extension is to ensure that the Precertificate cannot be validated by
+// a standard X.509v3 client) and signing the resulting TBSCertificate
+// [RFC5280] with either
+//
+//   - the private key of the certificate's issuer, or
+//
+//   - the private key of a Precertificate Signing Certificate, which is
+//     a special-purpose (Certificate Transparency key usage
+//     1.3.6.1.4.1.11129.2.4.4) CA certificate issued by the
+//     certificate's issuer.
+var (
+	Poison             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	PrecertificateSign = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}
+	// SCTList is the extension in which the final certificate embeds the
+	// SCTs that the logs returned for its precertificate.
+	SCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	authorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+)
+
+// Poisoned reports whether the certificate bears the CT poison extension,
+// and so is a precertificate.
+func Poisoned(cert *x509.Certificate) bool {
+	return hasExtension(cert, Poison)
+}
+
+// PrecertificateSigner reports whether the certificate is a precertificate
+// signing certificate.
+func PrecertificateSigner(cert *x509.Certificate) bool {
+	for _, usage := range cert.UnknownExtKeyUsage {
+		if usage.Equal(PrecertificateSign) {
+			return true
+		}
+	}
+	return false
+}
+
+// Findings lists, for each certificate of the chain, whether it is a
+// precertificate or a precertificate signing certificate, neither of which
+// belongs in a chain that is served to clients.
+func Findings(chain []*x509.Certificate) [][]string {
+	findings := make([][]string, len(chain))
+	for i, cert := range chain {
+		if Poisoned(cert) {
+			findings[i] = append(findings[i], "is a precertificate, bearing the CT poison extension, which no client will accept")
+		}
+		if PrecertificateSigner(cert) {
+			findings[i] = append(findings[i], "is a precertificate signing certificate, which has no place in a served chain")
+		}
+	}
+	return findings
+}
+
+// Comparison is whether the leaf is the certificate that was issued for a
+// precertificate, that is whether their TBSCertificates are the same save
+// for the poison and the SCT list.
+type Comparison struct {
+	Fingerprint certutil.Fingerprint
+	Matches     bool
+	// SignedByPrecertificateSigner is set when the precertificate was not
+	// issued by the leaf's issuer, in which case RFC 6962 permits its issuer
+	// and authority key identifier to differ from those of the leaf.
+	SignedByPrecertificateSigner bool
+	// Signer is the precertificate signing certificate, if one was given.
+	Signer          certutil.Fingerprint `json:",omitempty"`
+	Inconsistencies []string             `json:",omitempty"`
+}
+
+// Compare matches the leaf, as issued by the issuer, against the precertificate.
+// A precertificate that names an issuer other than the leaf's must have been
+// signed by the signer, a precertificate signing certificate that was itself
+// issued by the leaf's issuer. The signer may be nil if there is none.
+func Compare(leaf, issuer, precert, signer *x509.Certificate) Comparison {
+	c := Comparison{Fingerprint: certutil.FingerprintOf(precert)}
+	differs := func(format string, args ...interface{}) {
+		c.Inconsistencies = append(c.Inconsistencies, fmt.Sprintf(format, args...))
+	}
+	if !Poisoned(precert) {
+		differs("the precertificate lacks the CT poison extension")
+	}
+	if leaf.Version != precert.Version {
+		differs("the version differs, %d in the leaf and %d in the precertificate", leaf.Version, precert.Version)
+	}
+	if leaf.SerialNumber.Cmp(precert.SerialNumber) != 0 {
+		differs("the serial number differs, %X in the leaf and %X in the precertificate", leaf.SerialNumber, precert.SerialNumber)
+	}
+	if leaf.SignatureAlgorithm != precert.SignatureAlgorithm {
+		differs("the signature algorithm differs, %s in the leaf and %s in the precertificate", leaf.SignatureAlgorithm, precert.SignatureAlgorithm)
+	}
+	if !leaf.NotBefore.Equal(precert.NotBefore) || !leaf.NotAfter.Equal(precert.NotAfter) {
+		differs("the validity period differs")
+	}
+	if !bytes.Equal(leaf.RawSubject, precert.RawSubject) {
+		differs("the subject differs, %s in the leaf and %s in the precertificate", leaf.Subject, precert.Subject)
+	}
+	if !bytes.Equal(leaf.RawSubjectPublicKeyInfo, precert.RawSubjectPublicKeyInfo) {
+		differs("the public key differs")
+	}
+	ignored := []asn1.ObjectIdentifier{Poison, SCTList}
+	switch {
+	case bytes.Equal(leaf.RawIssuer, precert.RawIssuer):
+		if issuer != nil && precert.CheckSignatureFrom(issuer) != nil {
+			differs("the precertificate was not signed by the leaf's issuer, %s", issuer.Subject.CommonName)
+		}
+	case signer == nil:
+		c.SignedByPrecertificateSigner = true
+		ignored = append(ignored, authorityKeyID)
+		differs("the precertificate was issued by %s rather than the leaf's issuer, and without its precertificate signing certificate that signer is unverified", precert.Issuer.CommonName)
+	default:
+		c.SignedByPrecertificateSigner = true
+		c.Signer = certutil.FingerprintOf(signer)
+		ignored = append(ignored, authorityKeyID)
+		if !PrecertificateSigner(signer) {
+			differs("%s is not a precertificate signing certificate", signer.Subject.CommonName)
+		}
+		if !bytes.Equal(precert.RawIssuer, signer.RawSubject) || precert.CheckSignatureFrom(signer) != nil {
+			differs("the precertificate was not signed by the precertificate signing certificate, %s", signer.Subject.CommonName)
+		}
+		if !bytes.Equal(signer.RawIssuer, leaf.RawIssuer) || issuer != nil && signer.CheckSignatureFrom(issuer) != nil {
+			differs("the precertificate signing certificate, %s, was not issued by the leaf's issuer", signer.Subject.CommonName)
+		}
+	}
+	for _, inconsistency := range compareExtensions(leaf, precert, ignored) {
+		differs("%s", inconsistency)
+	}
+	c.Matches = len(c.Inconsistencies) == 0
+	return c
+}
+
+// compareExtensions reports every extension, bar those ignored, that is not
+// the same in both certificates, and whether they are in a different order.
+func compareExtensions(leaf, precert *x509.Certificate, ignored []asn1.ObjectIdentifier) []string {
+	var inconsistencies []string
+	l, p := without(leaf, ignored), without(precert, ignored)
+	for _, e := range l {
+		other, ok := find(p, e.Id)
+		switch {
+		case !ok:
+			inconsistencies = append(inconsistencies, fmt.Sprintf("the extension %s is in the leaf but not the precertificate", e.Id))
+		case e.Critical != other.Critical:
+			inconsistencies = append(inconsistencies, fmt.Sprintf("the criticality of the extension %s differs", e.Id))
+		case !bytes.Equal(e.Value, other.Value):
+			inconsistencies = append(inconsistencies, fmt.Sprintf("the extension %s differs", e.Id))
+		}
+	}
+	for _, e := range p {
+		if _, ok := find(l, e.Id); !ok {
+			inconsistencies = append(inconsistencies, fmt.Sprintf("the extension %s is in the precertificate but not the leaf", e.Id))
+		}
+	}
+	if len(inconsistencies) != 0 {
+		return inconsistencies
+	}
+	for i := range l {
+		if !l[i].Id.Equal(p[i].Id) {
+			return []string{"the extensions are in a different order"}
+		}
+	}
+	return nil
+}
+
+func without(cert *x509.Certificate, ignored []asn1.ObjectIdentifier) []pkix.Extension {
+	var extensions []pkix.Extension
+next:
+	for _, e := range cert.Extensions {
+		for _, id := range ignored {
+			if e.Id.Equal(id) {
+				continue next
+			}
+		}
+		extensions = append(extensions, e)
+	}
+	return extensions
+}
+
+func find(extensions []pkix.Extension, id asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, e := range extensions {
+		if e.Id.Equal(id) {
+			return e, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+func hasExtension(cert *x509.Certificate, id asn1.ObjectIdentifier) bool {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package ct
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/pkitest"
+)
+
+var (
+	poison  = pkix.Extension{Id: Poison, Critical: true, Value: []byte{0x05, 0x00}}
+	sctList = pkix.Extension{Id: SCTList, Value: []byte{0x04, 0x02, 0x00, 0x00}}
+)
+
+// leafTemplate is issued by the PKI's intermediate, and so names its
+// revocation endpoints whoever signs it.
+func leafTemplate(p *pkitest.PKI) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "www.example.com"},
+		DNSNames:              []string{"www.example.com"},
+		NotBefore:             p.Now.Add(-time.Hour),
+		NotAfter:              p.Now.Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:            []string{p.Intermediate.OCSPServer},
+		CRLDistributionPoints: []string{p.Intermediate.CRLDistributionPoint},
+	}
+}
+
+// newPrecertificateSigner creates a precertificate signing certificate issued by the issuer.
+func newPrecertificateSigner(t *testing.T, p *pkitest.PKI, issuer *pkitest.Authority) *pkitest.Authority {
+	signer, err := p.NewAuthority(issuer, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "CACop Test Precertificate Signer"},
+		NotBefore:             p.Now.AddDate(-1, 0, 0),
+		NotAfter:              p.Now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{PrecertificateSign},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestFindings(t *testing.T) {
+	p := pkitest.NewT(t)
+	signer := newPrecertificateSigner(t, p, p.Root)
+	precert := leafTemplate(p)
+	precert.ExtraExtensions = []pkix.Extension{poison}
+	leaf, err := p.Issue(signer, precert, p.Valid.Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Poisoned(leaf) || !PrecertificateSigner(signer.Certificate) || PrecertificateSigner(p.Root.Certificate) {
+		t.Fatal("expected the poison and the precertificate signing usage to be detected")
+	}
+	findings := Findings([]*x509.Certificate{leaf, signer.Certificate, p.Root.Certificate})
+	if len(findings[0]) != 1 || !strings.Contains(findings[0][0], "CT poison") {
+		t.Errorf("unexpected findings for the leaf %v", findings[0])
+	}
+	if len(findings[1]) != 1 || !strings.Contains(findings[1][0], "precertificate signing certificate") {
+		t.Errorf("unexpected findings for the signer %v", findings[1])
+	}
+	if len(findings[2]) != 0 {
+		t.Errorf("unexpected findings for the root %v", findings[2])
+	}
+}
+
+func TestCompare(t *testing.T) {
+	p := pkitest.NewT(t)
+	other, err := p.NewRoot("Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := newPrecertificateSigner(t, p, p.Intermediate)
+	// Another signer of the same name, whose signature the precertificate does not bear.
+	impostor := newPrecertificateSigner(t, p, p.Intermediate)
+	// A signer of the right name, but issued by the root rather than the leaf's issuer.
+	misissued := newPrecertificateSigner(t, p, p.Root)
+	final := leafTemplate(p)
+	final.ExtraExtensions = []pkix.Extension{sctList}
+	key := p.Valid.Key.Public()
+	leaf, err := p.Issue(p.Intermediate, final, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		precert func(*x509.Certificate)
+		// signedBy signs the precertificate, and given is the signer that
+		// accompanies it.
+		signedBy      *pkitest.Authority
+		given         *x509.Certificate
+		inconsistency string
+		precertSigned bool
+	}{
+		{
+			name:    "matches",
+			precert: func(*x509.Certificate) {},
+		},
+		{
+			name:          "serial",
+			precert:       func(c *x509.Certificate) { c.SerialNumber = big.NewInt(43) },
+			inconsistency: "the serial number differs, 2A in the leaf and 2B in the precertificate",
+		},
+		{
+			name:          "names",
+			precert:       func(c *x509.Certificate) { c.DNSNames = append(c.DNSNames, "example.com") },
+			inconsistency: "the extension 2.5.29.17 differs",
+		},
+		{
+			name:          "no poison",
+			precert:       func(c *x509.Certificate) { c.ExtraExtensions = nil },
+			inconsistency: "the precertificate lacks the CT poison extension",
+		},
+		{
+			name:          "precertificate signer",
+			precert:       func(*x509.Certificate) {},
+			signedBy:      signer,
+			given:         signer.Certificate,
+			precertSigned: true,
+		},
+		{
+			name:          "unverified signer",
+			precert:       func(*x509.Certificate) {},
+			signedBy:      signer,
+			inconsistency: "the precertificate was issued by CACop Test Precertificate Signer rather than the leaf's issuer, and without its precertificate signing certificate that signer is unverified",
+			precertSigned: true,
+		},
+		{
+			name:          "impostor",
+			precert:       func(*x509.Certificate) {},
+			signedBy:      signer,
+			given:         impostor.Certificate,
+			inconsistency: "the precertificate was not signed by the precertificate signing certificate, CACop Test Precertificate Signer",
+			precertSigned: true,
+		},
+		{
+			name:          "misissued signer",
+			precert:       func(*x509.Certificate) {},
+			signedBy:      misissued,
+			given:         misissued.Certificate,
+			inconsistency: "the precertificate signing certificate, CACop Test Precertificate Signer, was not issued by the leaf's issuer",
+			precertSigned: true,
+		},
+		{
+			name:          "another issuer",
+			precert:       func(*x509.Certificate) {},
+			signedBy:      other,
+			given:         other.Certificate,
+			inconsistency: "Other is not a precertificate signing certificate; the precertificate signing certificate, Other, was not issued by the leaf's issuer",
+			precertSigned: true,
+		},
+	}
+	for _, test := range tests {
+		template := leafTemplate(p)
+		template.ExtraExtensions = []pkix.Extension{poison}
+		test.precert(template)
+		signedBy := p.Intermediate
+		if test.signedBy != nil {
+			signedBy = test.signedBy
+		}
+		precert, err := p.Issue(signedBy, template, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := Compare(leaf, p.Intermediate.Certificate, precert, test.given)
+		if got := strings.Join(c.Inconsistencies, "; "); got != test.inconsistency {
+			t.Errorf("%s: expected %q, got %q", test.name, test.inconsistency, got)
+		}
+		if c.Matches != (test.inconsistency == "") || c.SignedByPrecertificateSigner != test.precertSigned {
+			t.Errorf("%s: unexpected comparison %+v", test.name, c)
+		}
+	}
+}
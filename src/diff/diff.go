@@ -0,0 +1,234 @@
+package diff
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// The runs being compared are the JSON encoded results as they are kept in
+// the result store, so they are decoded into these views rather than into
+// model.TestWebsiteResult whose error fields cannot be decoded.
+type run struct {
+	SubjectURL string
+	Chain      struct {
+		Leaf           certificate
+		Intermediates  []certificate
+		Root           certificate
+		PathValidation verdict
+	}
+}
+
+type certificate struct {
+	Fingerprint string
+	CommonName  string
+	OCSP        []struct {
+		Responder string
+		Good      bool
+		Revoked   bool
+		Unknown   bool
+		Error     json.RawMessage
+	}
+	CRL []struct {
+		Endpoint string
+		Revoked  bool
+		Error    json.RawMessage
+	}
+	Expiration verdict
+	Findings   []string
+}
+
+type verdict struct {
+	Status   string
+	NSSError string
+}
+
+func (v verdict) String() string {
+	if v.NSSError == "" {
+		return v.Status
+	}
+	return v.Status + " (" + v.NSSError + ")"
+}
+
+// certificates lists each certificate of the chain once. A lone certificate
+// is both the leaf and the root, and is reported as the leaf.
+func (r run) certificates() []certificate {
+	all := append(append([]certificate{r.Chain.Leaf}, r.Chain.Intermediates...), r.Chain.Root)
+	seen := make(map[string]bool, len(all))
+	certs := make([]certificate, 0, len(all))
+	for _, cert := range all {
+		if !seen[cert.Fingerprint] {
+			seen[cert.Fingerprint] = true
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// Certificate identifies a certificate within a chain.
+type Certificate struct {
+	Fingerprint string
+	CommonName  string
+}
+
+// Transition is a change in the outcome of a single check between two runs.
+type Transition struct {
+	Certificate
+	Endpoint string `json:",omitempty"`
+	From     string
+	To       string
+}
+
+type Finding struct {
+	Certificate
+	Finding string
+}
+
+type Diff struct {
+	Subject             string
+	AddedCertificates   []Certificate
+	DroppedCertificates []Certificate
+	OCSP                []Transition
+	CRL                 []Transition
+	Certutil            []Transition
+	PathValidation      *Transition
+	NewFindings         []Finding
+}
+
+// Empty reports whether nothing of note changed between the two runs.
+func (d Diff) Empty() bool {
+	return len(d.AddedCertificates) == 0 &&
+		len(d.DroppedCertificates) == 0 &&
+		len(d.OCSP) == 0 &&
+		len(d.CRL) == 0 &&
+		len(d.Certutil) == 0 &&
+		d.PathValidation == nil &&
+		len(d.NewFindings) == 0
+}
+
+// Compare reports what changed from the former run to the latter, both being
+// JSON encoded model.TestWebsiteResults.
+func Compare(from, to []byte) (d Diff, err error) {
+	var before, after run
+	if err = json.Unmarshal(from, &before); err != nil {
+		return d, errors.Wrap(err, "failed to decode the former run")
+	}
+	if err = json.Unmarshal(to, &after); err != nil {
+		return d, errors.Wrap(err, "failed to decode the latter run")
+	}
+	d.Subject = after.SubjectURL
+	previous := make(map[string]certificate)
+	for _, cert := range before.certificates() {
+		previous[cert.Fingerprint] = cert
+	}
+	current := make(map[string]certificate)
+	for _, cert := range after.certificates() {
+		current[cert.Fingerprint] = cert
+		old, ok := previous[cert.Fingerprint]
+		if !ok {
+			d.AddedCertificates = append(d.AddedCertificates, identify(cert))
+			continue
+		}
+		d.OCSP = append(d.OCSP, compareOCSP(old, cert)...)
+		d.CRL = append(d.CRL, compareCRL(old, cert)...)
+		if old.Expiration != cert.Expiration {
+			d.Certutil = append(d.Certutil, Transition{
+				Certificate: identify(cert),
+				From:        old.Expiration.String(),
+				To:          cert.Expiration.String(),
+			})
+		}
+		for _, finding := range newFindings(old.Findings, cert.Findings) {
+			d.NewFindings = append(d.NewFindings, Finding{identify(cert), finding})
+		}
+	}
+	for _, cert := range before.certificates() {
+		if _, ok := current[cert.Fingerprint]; !ok {
+			d.DroppedCertificates = append(d.DroppedCertificates, identify(cert))
+		}
+	}
+	if before.Chain.PathValidation != after.Chain.PathValidation {
+		d.PathValidation = &Transition{
+			From: before.Chain.PathValidation.String(),
+			To:   after.Chain.PathValidation.String(),
+		}
+	}
+	return d, nil
+}
+
+func identify(cert certificate) Certificate {
+	return Certificate{Fingerprint: cert.Fingerprint, CommonName: cert.CommonName}
+}
+
+func compareOCSP(before, after certificate) []Transition {
+	previous := make(map[string]string)
+	for _, response := range before.OCSP {
+		previous[response.Responder] = ocspStatus(response.Good, response.Revoked, response.Unknown, response.Error)
+	}
+	var transitions []Transition
+	for _, response := range after.OCSP {
+		status := ocspStatus(response.Good, response.Revoked, response.Unknown, response.Error)
+		if old, ok := previous[response.Responder]; ok && old != status {
+			transitions = append(transitions, Transition{identify(after), response.Responder, old, status})
+		}
+	}
+	return transitions
+}
+
+func compareCRL(before, after certificate) []Transition {
+	previous := make(map[string]string)
+	for _, crl := range before.CRL {
+		previous[crl.Endpoint] = crlStatus(crl.Revoked, crl.Error)
+	}
+	var transitions []Transition
+	for _, crl := range after.CRL {
+		status := crlStatus(crl.Revoked, crl.Error)
+		if old, ok := previous[crl.Endpoint]; ok && old != status {
+			transitions = append(transitions, Transition{identify(after), crl.Endpoint, old, status})
+		}
+	}
+	return transitions
+}
+
+func ocspStatus(good, revoked, unknown bool, err json.RawMessage) string {
+	switch {
+	case failed(err):
+		return "error"
+	case good:
+		return "good"
+	case revoked:
+		return "revoked"
+	case unknown:
+		return "unknown"
+	}
+	return "none"
+}
+
+func crlStatus(revoked bool, err json.RawMessage) string {
+	switch {
+	case failed(err):
+		return "error"
+	case revoked:
+		return "revoked"
+	}
+	return "not revoked"
+}
+
+// failed reports whether an encoded error field held an error.
+func failed(err json.RawMessage) bool {
+	return len(err) != 0 && string(err) != "null"
+}
+
+func newFindings(before, after []string) []string {
+	seen := make(map[string]bool)
+	for _, finding := range before {
+		seen[finding] = true
+	}
+	var findings []string
+	for _, finding := range after {
+		if !seen[finding] {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
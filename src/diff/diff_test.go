@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/revocation/crl"
+	"github.com/christopher-henderson/CACop/revocation/ocsp"
+)
+
+func certificateResult(fingerprint string, response ocsp.OCSP, list crl.CRL, status certutil.Status) model.CertificateResult {
+	return model.CertificateResult{
+		Fingerprint: fingerprint,
+		CommonName:  fingerprint,
+		OCSP:        []ocsp.OCSP{response},
+		CRL:         []crl.CRL{list},
+		Expiration:  expiration.ExpirationStatus{Status: status},
+	}
+}
+
+func encode(t *testing.T, result model.TestWebsiteResult) []byte {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestCompare(t *testing.T) {
+	good := ocsp.OCSP{Responder: "http://ocsp.example.com", Good: true}
+	revoked := ocsp.OCSP{Responder: "http://ocsp.example.com", Revoked: true}
+	listed := crl.CRL{Endpoint: "http://crl.example.com", Revoked: true}
+	unlisted := crl.CRL{Endpoint: "http://crl.example.com"}
+	failing := crl.CRL{Endpoint: "http://crl.example.com", Error: errors.New("404")}
+
+	before := model.TestWebsiteResult{SubjectURL: "https://revoked.example.com"}
+	before.Chain.Leaf = certificateResult("leaf", revoked, listed, certutil.StatusRevoked)
+	before.Chain.Intermediates = []model.CertificateResult{certificateResult("old intermediate", good, unlisted, certutil.StatusValid)}
+	before.Chain.Root = certificateResult("root", good, unlisted, certutil.StatusValid)
+
+	after := model.TestWebsiteResult{SubjectURL: "https://revoked.example.com"}
+	after.Chain.Leaf = certificateResult("leaf", good, unlisted, certutil.StatusValid)
+	after.Chain.Intermediates = []model.CertificateResult{certificateResult("new intermediate", good, unlisted, certutil.StatusValid)}
+	after.Chain.Root = certificateResult("root", good, failing, certutil.StatusValid)
+
+	d, err := Compare(encode(t, before), encode(t, after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Empty() {
+		t.Fatal("expected a difference")
+	}
+	if len(d.AddedCertificates) != 1 || d.AddedCertificates[0].Fingerprint != "new intermediate" {
+		t.Errorf("unexpected added certificates %v", d.AddedCertificates)
+	}
+	if len(d.DroppedCertificates) != 1 || d.DroppedCertificates[0].Fingerprint != "old intermediate" {
+		t.Errorf("unexpected dropped certificates %v", d.DroppedCertificates)
+	}
+	if len(d.OCSP) != 1 || d.OCSP[0].From != "revoked" || d.OCSP[0].To != "good" {
+		t.Errorf("unexpected OCSP transitions %v", d.OCSP)
+	}
+	if len(d.CRL) != 2 {
+		t.Fatalf("unexpected CRL transitions %v", d.CRL)
+	}
+	if d.CRL[0].Fingerprint != "leaf" || d.CRL[0].From != "revoked" || d.CRL[0].To != "not revoked" {
+		t.Errorf("unexpected CRL transition %v", d.CRL[0])
+	}
+	if d.CRL[1].Fingerprint != "root" || d.CRL[1].To != "error" {
+		t.Errorf("unexpected CRL transition %v", d.CRL[1])
+	}
+	if len(d.Certutil) != 1 || d.Certutil[0].From != "revoked" || d.Certutil[0].To != "valid" {
+		t.Errorf("unexpected certutil transitions %v", d.Certutil)
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	result := model.TestWebsiteResult{SubjectURL: "https://valid.example.com"}
+	result.Chain.Leaf = certificateResult("leaf", ocsp.OCSP{Good: true}, crl.CRL{}, certutil.StatusValid)
+	result.Chain.Root = certificateResult("root", ocsp.OCSP{}, crl.CRL{}, certutil.StatusValid)
+	d, err := Compare(encode(t, result), encode(t, result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Errorf("expected no difference, got %+v", d)
+	}
+}
+
+func TestCompareLoneCertificate(t *testing.T) {
+	lone := func(response ocsp.OCSP, status certutil.Status) model.TestWebsiteResult {
+		result := model.TestWebsiteResult{SubjectURL: "https://self-signed.example.com"}
+		result.Chain.Leaf = certificateResult("self signed", response, crl.CRL{}, status)
+		result.Chain.Root = result.Chain.Leaf
+		return result
+	}
+	before := lone(ocsp.OCSP{Responder: "http://ocsp.example.com", Good: true}, certutil.StatusValid)
+	after := lone(ocsp.OCSP{Responder: "http://ocsp.example.com", Revoked: true}, certutil.StatusRevoked)
+	d, err := Compare(encode(t, before), encode(t, after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.OCSP) != 1 || len(d.Certutil) != 1 {
+		t.Errorf("expected each transition of the lone certificate once, got %+v", d)
+	}
+}
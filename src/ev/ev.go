@@ -0,0 +1,208 @@
+package ev
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/pkg/errors"
+)
+
+// Firefox gives EV treatment to a chain only if its root is enabled for the
+// very EV policy that the leaf asserts. The roots and their policies are
+// compiled into PSM as ExtendedValidation.cpp, so they are kept here as a
+// table that may be loaded from a file of the form
+//
+//	# comment
+//	<SHA-256 fingerprint of the root> <EV policy OID> [<EV policy OID>...]
+//
+// where the fingerprint is hex, with or without colons.
+//
+// https://hg.mozilla.org/mozilla-central/file/tip/security/certverifier/ExtendedValidation.cpp
+
+// CABForumEV is the policy of the CA/Browser Forum EV Guidelines, which
+// every EV leaf asserts in addition to, or in place of, a CA's own policy.
+const CABForumEV = "2.23.140.1.1"
+
+const anyPolicy = "2.5.29.32.0"
+
+// Result is whether the chain would receive EV treatment.
+type Result struct {
+	// Enabled are the EV policies for which the root is enabled.
+	Enabled []string
+	// Policy is the enabled policy that the chain asserts throughout.
+	Policy    string `json:",omitempty"`
+	Treatment bool
+}
+
+type Table struct {
+	lock     sync.RWMutex
+	policies map[certutil.Fingerprint][]string
+}
+
+func New() *Table {
+	return &Table{policies: make(map[certutil.Fingerprint][]string)}
+}
+
+// Add enables the root with the given fingerprint for the EV policies.
+func (t *Table) Add(fingerprint certutil.Fingerprint, policies ...string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	fingerprint = normalize(fingerprint)
+	for _, policy := range policies {
+		if !contains(t.policies[fingerprint], policy) {
+			t.policies[fingerprint] = append(t.policies[fingerprint], policy)
+		}
+	}
+}
+
+func (t *Table) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.policies)
+}
+
+// Policies are the EV policies for which the root is enabled, if any.
+func (t *Table) Policies(root *x509.Certificate) []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	policies := append([]string{}, t.policies[certutil.FingerprintOf(root)]...)
+	sort.Strings(policies)
+	return policies
+}
+
+// LoadFile adds every root listed in the file at the given path.
+func (t *Table) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open EV policy table %v", path)
+	}
+	defer f.Close()
+	return errors.Wrapf(t.Load(f), "failed to load EV policy table %v", path)
+}
+
+// Load adds every root listed in the table.
+func (t *Table) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: expected a fingerprint followed by at least one policy", line)
+		}
+		fingerprint := normalize(fields[0])
+		if raw, err := hex.DecodeString(fingerprint); err != nil || len(raw) != 32 {
+			return fmt.Errorf("line %d: %q is not a SHA-256 fingerprint", line, fields[0])
+		}
+		var policies []string
+		for _, policy := range fields[1:] {
+			oid, err := x509.ParseOID(policy)
+			if err != nil {
+				return fmt.Errorf("line %d: %q is not an OID", line, policy)
+			}
+			policies = append(policies, oid.String())
+		}
+		t.Add(fingerprint, policies...)
+	}
+	return scanner.Err()
+}
+
+// Evaluate decides whether the chain, leaf first, receives EV treatment given
+// the policies that remain valid for its leaf. As with PSM, the leaf must
+// assert an EV policy of the root, and every intermediate must assert that
+// same policy or anyPolicy. Findings are returned for each certificate.
+func (t *Table) Evaluate(chain []*x509.Certificate, valid []string) (Result, [][]string) {
+	findings := make([][]string, len(chain))
+	result := Result{Enabled: t.Policies(chain[len(chain)-1])}
+	if len(chain) < 2 {
+		return result, findings
+	}
+	leaf := policiesOf(chain[0])
+	if len(result.Enabled) == 0 {
+		if contains(leaf, CABForumEV) {
+			findings[0] = append(findings[0], fmt.Sprintf("asserts the EV policy %s, yet the root is not enabled for EV treatment", CABForumEV))
+		}
+		return result, findings
+	}
+	for _, policy := range result.Enabled {
+		if contains(leaf, policy) && assertedByIntermediates(chain, policy) && (contains(valid, policy) || contains(valid, anyPolicy)) {
+			result.Policy = policy
+			result.Treatment = true
+			return result, findings
+		}
+	}
+	// Nothing matched, so explain where each enabled policy was lost.
+	enabled := strings.Join(result.Enabled, ", ")
+	if !containsAny(leaf, result.Enabled) {
+		findings[0] = append(findings[0], fmt.Sprintf("asserts none of the EV policies for which the root is enabled (%s)", enabled))
+	}
+	for i, cert := range chain[1 : len(chain)-1] {
+		policies := policiesOf(cert)
+		if !contains(policies, anyPolicy) && !containsAny(policies, result.Enabled) {
+			findings[i+1] = append(findings[i+1], fmt.Sprintf("asserts neither anyPolicy nor any of the EV policies for which the root is enabled (%s)", enabled))
+		}
+	}
+	if containsAny(leaf, result.Enabled) {
+		findings[0] = append(findings[0], "no EV policy for which the root is enabled remains valid through the chain, so it does not receive EV treatment")
+	}
+	return result, findings
+}
+
+func assertedByIntermediates(chain []*x509.Certificate, policy string) bool {
+	for _, cert := range chain[1 : len(chain)-1] {
+		policies := policiesOf(cert)
+		if !contains(policies, policy) && !contains(policies, anyPolicy) {
+			return false
+		}
+	}
+	return true
+}
+
+func policiesOf(cert *x509.Certificate) []string {
+	var policies []string
+	for _, policy := range cert.Policies {
+		policies = append(policies, policy.String())
+	}
+	if len(policies) != 0 {
+		return policies
+	}
+	for _, policy := range cert.PolicyIdentifiers {
+		policies = append(policies, policy.String())
+	}
+	return policies
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, of []string) bool {
+	for _, s := range of {
+		if contains(list, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(fingerprint string) string {
+	return strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+}
@@ -0,0 +1,155 @@
+package ev
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/pkitest"
+)
+
+const caEV = "1.2.3.4.5"
+
+// chainOf issues a certificate asserting each list of policies, each signed
+// by the one before it beginning with a self signed root, and returns the
+// chain leaf first.
+func chainOf(t *testing.T, policies ...[]string) []*x509.Certificate {
+	p := pkitest.NewT(t)
+	chain := make([]*x509.Certificate, len(policies))
+	var issuer *pkitest.Authority
+	for i, asserted := range policies {
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: string(rune('A' + i))},
+			NotBefore:             p.Now.Add(-time.Hour),
+			NotAfter:              p.Now.Add(time.Hour),
+			IsCA:                  i != len(policies)-1,
+			BasicConstraintsValid: true,
+		}
+		for _, policy := range asserted {
+			template.PolicyIdentifiers = append(template.PolicyIdentifiers, oidOf(t, policy))
+		}
+		var err error
+		if template.IsCA {
+			issuer, err = p.NewAuthority(issuer, template)
+			if err == nil {
+				chain[len(policies)-1-i] = issuer.Certificate
+			}
+		} else {
+			chain[0], err = p.Issue(issuer, template, p.Valid.Key.Public())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chain
+}
+
+func TestLoad(t *testing.T) {
+	table := New()
+	fingerprint := strings.Repeat("AB:", 31) + "AB"
+	err := table.Load(strings.NewReader("# EV roots\n\n" + fingerprint + " 2.23.140.1.1 1.2.3.4.5 # trailing comment\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 1 {
+		t.Fatalf("expected 1 root, got %d", table.Len())
+	}
+	if policies := table.policies[strings.Repeat("ab", 32)]; !reflect.DeepEqual(policies, []string{"2.23.140.1.1", "1.2.3.4.5"}) {
+		t.Errorf("unexpected policies %v", policies)
+	}
+	for _, bad := range []string{
+		fingerprint,
+		"abcd 2.23.140.1.1",
+		fingerprint + " not.an.oid",
+	} {
+		if err := New().Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		root      []string
+		inter     []string
+		leaf      []string
+		valid     []string
+		treatment bool
+		findings  [3]string
+	}{
+		{
+			name:      "EV",
+			inter:     []string{caEV},
+			leaf:      []string{CABForumEV, caEV},
+			valid:     []string{caEV},
+			treatment: true,
+		},
+		{
+			name:      "anyPolicy intermediate",
+			inter:     []string{anyPolicy},
+			leaf:      []string{caEV},
+			valid:     []string{caEV},
+			treatment: true,
+		},
+		{
+			name:     "leaf without the EV policy",
+			inter:    []string{caEV},
+			leaf:     []string{CABForumEV},
+			valid:    []string{CABForumEV},
+			findings: [3]string{"asserts none of the EV policies for which the root is enabled (1.2.3.4.5)"},
+		},
+		{
+			name:  "intermediate without the EV policy",
+			inter: []string{"1.2.3"},
+			leaf:  []string{caEV},
+			findings: [3]string{
+				"no EV policy for which the root is enabled remains valid through the chain, so it does not receive EV treatment",
+				"asserts neither anyPolicy nor any of the EV policies for which the root is enabled (1.2.3.4.5)",
+			},
+		},
+	}
+	for _, test := range tests {
+		chain := chainOf(t, test.root, test.inter, test.leaf)
+		table := New()
+		table.Add(certutil.FingerprintOf(chain[2]), caEV)
+		result, findings := table.Evaluate(chain, test.valid)
+		if result.Treatment != test.treatment || test.treatment && result.Policy != caEV {
+			t.Errorf("%s: unexpected result %+v", test.name, result)
+		}
+		for i := range findings {
+			if got := strings.Join(findings[i], "; "); got != test.findings[i] {
+				t.Errorf("%s: expected the findings %q for certificate %d, got %q", test.name, test.findings[i], i, got)
+			}
+		}
+	}
+}
+
+func TestNotEnabled(t *testing.T) {
+	chain := chainOf(t, nil, []string{anyPolicy}, []string{CABForumEV})
+	result, findings := New().Evaluate(chain, []string{CABForumEV})
+	if result.Treatment || len(result.Enabled) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(findings[0]) != 1 || !strings.Contains(findings[0][0], "the root is not enabled for EV treatment") {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func oidOf(t *testing.T, policy string) asn1.ObjectIdentifier {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(policy, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oid = append(oid, n)
+	}
+	return oid
+}
@@ -4,12 +4,13 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -51,12 +52,18 @@ const (
 	TrustedPeer     = "P,p,p"
 	TrustedImplicit = ",,"
 	TrustedCA       = "C"
+	TrustedClientCA = "T"
+	ValidCA         = "c"
+	Prohibited      = "p"
 
 	Verify          = "-V"
 	VerifySignature = "-e"
 	CertUsage       = "-u"
 	SSLServer       = "V"
 
+	ValidityTime       = "-b"
+	ValidityTimeLayout = "060102150405Z"
+
 	ListChain = "-O"
 )
 
@@ -101,7 +108,7 @@ func NewCerutilInto(dir string) (certutil Certutil, err error) {
 	certutil.tmpDir = dir
 	out, err := execute([]string{NewCertificateDatabase, NoPassword, CertDbDirectory, certutil.tmpDir})
 	if err != nil {
-		log.Println(string(out))
+		err = errors.Wrap(err, string(out))
 	}
 	return
 }
@@ -122,18 +129,46 @@ func CertUtilFrom(dir string) (certutil Certutil) {
 //u 	 user cert
 //w 	 send warning
 //g 	 make step-up cert
-func (c Certutil) Install(cert *x509.Certificate) ([]byte, error) {
-	var trustArgs string
-	switch cert.Subject.CommonName == cert.Issuer.CommonName {
-	case true:
-		trustArgs = TrustedCA
-	case false:
-		trustArgs = TrustedImplicit
+type Trust struct {
+	SSL           string
+	Email         string
+	ObjectSigning string
+}
+
+// NoTrust installs a certificate without any explicit trust, which is what
+// every certificate other than the designated root should receive.
+var NoTrust = Trust{}
+
+// TrustedRoot marks a certificate as a trust anchor for every usage.
+var TrustedRoot = Trust{SSL: TrustedCA, Email: TrustedCA, ObjectSigning: TrustedCA}
+
+func (t Trust) String() string {
+	return t.SSL + "," + t.Email + "," + t.ObjectSigning
+}
+
+func (t Trust) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// IsSelfSigned reports whether the certificate's issuer is its own subject
+// and whether it is signed by its own key. Comparing common names is not enough,
+// as intermediates frequently share a common name with their root and some
+// roots have no common name at all.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
 	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// Install adds the certificate to the database with the given trust. Trust
+// should only be given to the root that the caller has designated as the
+// anchor for the chain, everything else ought to be installed with NoTrust.
+func (c Certutil) Install(cert *x509.Certificate, trust Trust) ([]byte, error) {
 	return execute([]string{
 		InstallCert,
-		TrustArgs, trustArgs,
-		CertName, fingerprintOf(cert),
+		TrustArgs, trust.String(),
+		CertName, FingerprintOf(cert),
 		CertDbDirectory, c.tmpDir,
 	}, cert.Raw...)
 }
@@ -149,27 +184,28 @@ func (c Certutil) Install(cert *x509.Certificate) ([]byte, error) {
 //R 	 Email Recipient
 //O 	 OCSP status responder
 //J 	 Object signer
-func (c Certutil) Verify(cert *x509.Certificate) ([]byte, error) {
-	var certUsage string
-	switch cert.IsCA {
-	case true:
-		certUsage = CertUsageSSLCA
-	case false:
-		certUsage = CertUsageSSLServer
-	}
-	return execute([]string{
+//
+//-b time           validity time ("YYMMDDHHMMSS[+HHMM|-HHMM|Z]")
+//
+// The certificate is verified for the given usage at the given time, or now if the time is zero.
+func (c Certutil) Verify(cert *x509.Certificate, usage Usage, at time.Time) ([]byte, error) {
+	args := []string{
 		Verify,
 		VerifySignature,
-		CertName, fingerprintOf(cert),
-		CertUsage, certUsage,
+		CertName, FingerprintOf(cert),
+		CertUsage, usage.CertUsage(cert),
 		CertDbDirectory, c.tmpDir,
-	})
+	}
+	if !at.IsZero() {
+		args = append(args, ValidityTime, at.UTC().Format(ValidityTimeLayout))
+	}
+	return execute(args)
 }
 
 func (c Certutil) ListChain(cert *x509.Certificate) ([]Fingerprint, error) {
 	out, err := execute([]string{
 		ListChain,
-		CertName, fingerprintOf(cert),
+		CertName, FingerprintOf(cert),
 		CertDbDirectory, c.tmpDir,
 	})
 	if err != nil {
@@ -183,6 +219,12 @@ func (c Certutil) ListChain(cert *x509.Certificate) ([]Fingerprint, error) {
 	return fingerprints, nil
 }
 
+// Dir is the directory of the NSS database, for other NSS tools
+// that ought to operate on the same database.
+func (c Certutil) Dir() string {
+	return c.tmpDir
+}
+
 func (c Certutil) Delete() error {
 	return os.RemoveAll(c.tmpDir)
 }
@@ -190,11 +232,14 @@ func (c Certutil) Delete() error {
 func execute(args []string, input ...byte) ([]byte, error) {
 	cmd := exec.Command(executable, args...)
 	cmd.Stdin = bytes.NewBuffer(input)
+	start := time.Now()
 	out, err := cmd.CombinedOutput()
+	ObserveInvocation(executable, operationOf(args), start, err)
 	return bytes.TrimSpace(out), err
 }
 
-func fingerprintOf(cert *x509.Certificate) Fingerprint {
+// FingerprintOf is the SHA256 fingerprint under which the certificate is installed.
+func FingerprintOf(cert *x509.Certificate) Fingerprint {
 	hasher := crypto.SHA256.New()
 	hasher.Write(cert.Raw)
 	return fmt.Sprintf("%x", hasher.Sum(nil))
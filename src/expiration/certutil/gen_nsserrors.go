@@ -0,0 +1,69 @@
+//go:build ignore
+// +build ignore
+
+// gen_nsserrors generates nsserrors.go from NSS's lib/util/SECerrs.h, whose
+// entries are of the form
+//
+//	ER3(SEC_ERROR_IO, SEC_ERROR_BASE + 0,
+//	    "An I/O error occurred during security authorization.")
+//
+// Usage:
+//
+//	go run gen_nsserrors.go path/to/nss/lib/util/SECerrs.h
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var (
+	entry  = regexp.MustCompile(`(?s)ER3\(\s*(\w+)\s*,\s*\(?\s*SEC_ERROR_BASE\s*\+\s*(\d+)\s*\)?\s*,\s*((?:"(?:[^"\\]|\\.)*"\s*)+)\)`)
+	quoted = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run gen_nsserrors.go path/to/nss/lib/util/SECerrs.h")
+	}
+	header, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by gen_nsserrors.go from NSS's lib/util/SECerrs.h; DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "package certutil")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "var nssErrors = []NSSError{")
+	matches := entry.FindAllSubmatch(header, -1)
+	if len(matches) == 0 {
+		log.Fatalf("no errors found within %s", os.Args[1])
+	}
+	for _, m := range matches {
+		offset, _ := strconv.Atoi(string(m[2]))
+		var message string
+		for _, q := range quoted.FindAll(m[3], -1) {
+			s, err := strconv.Unquote(string(q))
+			if err != nil {
+				log.Fatalf("%s: %s", m[1], err)
+			}
+			message += s
+		}
+		fmt.Fprintf(&b, "\t{Code: secErrorBase + %d, Name: %q, Message: %q},\n", offset, m[1], message)
+	}
+	fmt.Fprintln(&b, "}")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("nsserrors.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,51 @@
+package certutil
+
+import (
+	"os/exec"
+	"time"
+
+	"github.com/christopher-henderson/CACop/metrics"
+)
+
+var (
+	invocations = metrics.NewCounterVec("cacop_nss_invocations_total",
+		"Invocations of the NSS command line tools by tool, operation and result.",
+		"tool", "operation", "result")
+	invocationDuration = metrics.NewHistogramVec("cacop_nss_invocation_duration_seconds",
+		"Time taken by invocations of the NSS command line tools.",
+		metrics.DurationBuckets, "tool", "operation")
+)
+
+var operations = map[string]string{
+	NewCertificateDatabase: "create database",
+	InstallCert:            "install",
+	Verify:                 "verify",
+	ListChain:              "list chain",
+}
+
+// ObserveInvocation records an invocation of an NSS tool that began at start
+// and ended with err. The NSS tools exit non zero for an invalid certificate
+// as well as for a misuse of the tool, so a non zero exit is told apart from
+// the tool failing to run at all.
+func ObserveInvocation(tool, operation string, start time.Time, err error) {
+	invocationDuration.With(tool, operation).ObserveSince(start)
+	result := "ok"
+	switch err.(type) {
+	case nil:
+	case *exec.ExitError:
+		result = "non zero exit"
+	default:
+		result = "failed to run"
+	}
+	invocations.With(tool, operation, result).Inc()
+}
+
+func operationOf(args []string) string {
+	if len(args) == 0 {
+		return "help"
+	}
+	if operation, ok := operations[args[0]]; ok {
+		return operation
+	}
+	return args[0]
+}
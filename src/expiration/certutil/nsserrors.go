@@ -0,0 +1,189 @@
+// Code generated by gen_nsserrors.go from NSS's lib/util/SECerrs.h; DO NOT EDIT.
+
+package certutil
+
+var nssErrors = []NSSError{
+	{Code: secErrorBase + 0, Name: "SEC_ERROR_IO", Message: "An I/O error occurred during security authorization."},
+	{Code: secErrorBase + 1, Name: "SEC_ERROR_LIBRARY_FAILURE", Message: "security library failure."},
+	{Code: secErrorBase + 2, Name: "SEC_ERROR_BAD_DATA", Message: "security library: received bad data."},
+	{Code: secErrorBase + 3, Name: "SEC_ERROR_OUTPUT_LEN", Message: "security library: output length error."},
+	{Code: secErrorBase + 4, Name: "SEC_ERROR_INPUT_LEN", Message: "security library has experienced an input length error."},
+	{Code: secErrorBase + 5, Name: "SEC_ERROR_INVALID_ARGS", Message: "security library: invalid arguments."},
+	{Code: secErrorBase + 6, Name: "SEC_ERROR_INVALID_ALGORITHM", Message: "security library: invalid algorithm."},
+	{Code: secErrorBase + 7, Name: "SEC_ERROR_INVALID_AVA", Message: "security library: invalid AVA."},
+	{Code: secErrorBase + 8, Name: "SEC_ERROR_INVALID_TIME", Message: "Improperly formatted time string."},
+	{Code: secErrorBase + 9, Name: "SEC_ERROR_BAD_DER", Message: "security library: improperly formatted DER-encoded message."},
+	{Code: secErrorBase + 10, Name: "SEC_ERROR_BAD_SIGNATURE", Message: "Peer's certificate has an invalid signature."},
+	{Code: secErrorBase + 11, Name: "SEC_ERROR_EXPIRED_CERTIFICATE", Message: "Peer's Certificate has expired."},
+	{Code: secErrorBase + 12, Name: "SEC_ERROR_REVOKED_CERTIFICATE", Message: "Peer's Certificate has been revoked."},
+	{Code: secErrorBase + 13, Name: "SEC_ERROR_UNKNOWN_ISSUER", Message: "Peer's Certificate issuer is not recognized."},
+	{Code: secErrorBase + 14, Name: "SEC_ERROR_BAD_KEY", Message: "Peer's public key is invalid."},
+	{Code: secErrorBase + 15, Name: "SEC_ERROR_BAD_PASSWORD", Message: "The security password entered is incorrect."},
+	{Code: secErrorBase + 16, Name: "SEC_ERROR_RETRY_PASSWORD", Message: "New password entered incorrectly. Please try again."},
+	{Code: secErrorBase + 17, Name: "SEC_ERROR_NO_NODELOCK", Message: "security library: no nodelock."},
+	{Code: secErrorBase + 18, Name: "SEC_ERROR_BAD_DATABASE", Message: "security library: bad database."},
+	{Code: secErrorBase + 19, Name: "SEC_ERROR_NO_MEMORY", Message: "security library: memory allocation failure."},
+	{Code: secErrorBase + 20, Name: "SEC_ERROR_UNTRUSTED_ISSUER", Message: "Peer's certificate issuer has been marked as not trusted by the user."},
+	{Code: secErrorBase + 21, Name: "SEC_ERROR_UNTRUSTED_CERT", Message: "Peer's certificate has been marked as not trusted by the user."},
+	{Code: secErrorBase + 22, Name: "SEC_ERROR_DUPLICATE_CERT", Message: "Certificate already exists in your database."},
+	{Code: secErrorBase + 23, Name: "SEC_ERROR_DUPLICATE_CERT_NAME", Message: "Downloaded certificate's name duplicates one already in your database."},
+	{Code: secErrorBase + 24, Name: "SEC_ERROR_ADDING_CERT", Message: "Error adding certificate to database."},
+	{Code: secErrorBase + 25, Name: "SEC_ERROR_FILING_KEY", Message: "Error refiling the key for this certificate."},
+	{Code: secErrorBase + 26, Name: "SEC_ERROR_NO_KEY", Message: "The private key for this certificate cannot be found in key database"},
+	{Code: secErrorBase + 27, Name: "SEC_ERROR_CERT_VALID", Message: "This certificate is valid."},
+	{Code: secErrorBase + 28, Name: "SEC_ERROR_CERT_NOT_VALID", Message: "This certificate is not valid."},
+	{Code: secErrorBase + 29, Name: "SEC_ERROR_CERT_NO_RESPONSE", Message: "Cert Library: No Response"},
+	{Code: secErrorBase + 30, Name: "SEC_ERROR_EXPIRED_ISSUER_CERTIFICATE", Message: "The certificate issuer's certificate has expired. Check your system date and time."},
+	{Code: secErrorBase + 31, Name: "SEC_ERROR_CRL_EXPIRED", Message: "The CRL for the certificate's issuer has expired. Update it or check your system date and time."},
+	{Code: secErrorBase + 32, Name: "SEC_ERROR_CRL_BAD_SIGNATURE", Message: "The CRL for the certificate's issuer has an invalid signature."},
+	{Code: secErrorBase + 33, Name: "SEC_ERROR_CRL_INVALID", Message: "New CRL has an invalid format."},
+	{Code: secErrorBase + 34, Name: "SEC_ERROR_EXTENSION_VALUE_INVALID", Message: "Certificate extension value is invalid."},
+	{Code: secErrorBase + 35, Name: "SEC_ERROR_EXTENSION_NOT_FOUND", Message: "Certificate extension not found."},
+	{Code: secErrorBase + 36, Name: "SEC_ERROR_CA_CERT_INVALID", Message: "Issuer certificate is invalid."},
+	{Code: secErrorBase + 37, Name: "SEC_ERROR_PATH_LEN_CONSTRAINT_INVALID", Message: "Certificate path length constraint is invalid."},
+	{Code: secErrorBase + 38, Name: "SEC_ERROR_CERT_USAGES_INVALID", Message: "Certificate usages field is invalid."},
+	{Code: secErrorBase + 39, Name: "SEC_INTERNAL_ONLY", Message: "**Internal ONLY module**"},
+	{Code: secErrorBase + 40, Name: "SEC_ERROR_INVALID_KEY", Message: "The key does not support the requested operation."},
+	{Code: secErrorBase + 41, Name: "SEC_ERROR_UNKNOWN_CRITICAL_EXTENSION", Message: "Certificate contains unknown critical extension."},
+	{Code: secErrorBase + 42, Name: "SEC_ERROR_OLD_CRL", Message: "New CRL is not later than the current one."},
+	{Code: secErrorBase + 43, Name: "SEC_ERROR_NO_EMAIL_CERT", Message: "Not encrypted or signed: you do not yet have an email certificate."},
+	{Code: secErrorBase + 44, Name: "SEC_ERROR_NO_RECIPIENT_CERTS_QUERY", Message: "Not encrypted: you do not have certificates for each of the recipients."},
+	{Code: secErrorBase + 45, Name: "SEC_ERROR_NOT_A_RECIPIENT", Message: "Cannot decrypt: you are not a recipient, or matching certificate and private key not found."},
+	{Code: secErrorBase + 46, Name: "SEC_ERROR_PKCS7_KEYALG_MISMATCH", Message: "Cannot decrypt: key encryption algorithm does not match your certificate."},
+	{Code: secErrorBase + 47, Name: "SEC_ERROR_PKCS7_BAD_SIGNATURE", Message: "Signature verification failed: no signer found, too many signers found, or improper or corrupted data."},
+	{Code: secErrorBase + 48, Name: "SEC_ERROR_UNSUPPORTED_KEYALG", Message: "Unsupported or unknown key algorithm."},
+	{Code: secErrorBase + 49, Name: "SEC_ERROR_DECRYPTION_DISALLOWED", Message: "Cannot decrypt: encrypted using a disallowed algorithm or key size."},
+	{Code: secErrorBase + 50, Name: "XP_SEC_FORTEZZA_BAD_CARD", Message: "Fortezza card has not been properly initialized. Please remove it and return it to your issuer."},
+	{Code: secErrorBase + 51, Name: "XP_SEC_FORTEZZA_NO_CARD", Message: "No Fortezza cards Found"},
+	{Code: secErrorBase + 52, Name: "XP_SEC_FORTEZZA_NONE_SELECTED", Message: "No Fortezza card selected"},
+	{Code: secErrorBase + 53, Name: "XP_SEC_FORTEZZA_MORE_INFO", Message: "Please select a personality to get more info on"},
+	{Code: secErrorBase + 54, Name: "XP_SEC_FORTEZZA_PERSON_NOT_FOUND", Message: "Personality not found"},
+	{Code: secErrorBase + 55, Name: "XP_SEC_FORTEZZA_NO_MORE_INFO", Message: "No more information on that Personality"},
+	{Code: secErrorBase + 56, Name: "XP_SEC_FORTEZZA_BAD_PIN", Message: "Invalid Pin"},
+	{Code: secErrorBase + 57, Name: "XP_SEC_FORTEZZA_PERSON_ERROR", Message: "Couldn't initialize Fortezza personalities."},
+	{Code: secErrorBase + 58, Name: "SEC_ERROR_NO_KRL", Message: "No KRL for this site's certificate has been found."},
+	{Code: secErrorBase + 59, Name: "SEC_ERROR_KRL_EXPIRED", Message: "The KRL for this site's certificate has expired."},
+	{Code: secErrorBase + 60, Name: "SEC_ERROR_KRL_BAD_SIGNATURE", Message: "The KRL for this site's certificate has an invalid signature."},
+	{Code: secErrorBase + 61, Name: "SEC_ERROR_REVOKED_KEY", Message: "The key for this site's certificate has been revoked."},
+	{Code: secErrorBase + 62, Name: "SEC_ERROR_KRL_INVALID", Message: "New KRL has an invalid format."},
+	{Code: secErrorBase + 63, Name: "SEC_ERROR_NEED_RANDOM", Message: "security library: need random data."},
+	{Code: secErrorBase + 64, Name: "SEC_ERROR_NO_MODULE", Message: "security library: no security module can perform the requested operation."},
+	{Code: secErrorBase + 65, Name: "SEC_ERROR_NO_TOKEN", Message: "The security card or token does not exist, needs to be initialized, or has been removed."},
+	{Code: secErrorBase + 66, Name: "SEC_ERROR_READ_ONLY", Message: "security library: read-only database."},
+	{Code: secErrorBase + 67, Name: "SEC_ERROR_NO_SLOT_SELECTED", Message: "No slot or token was selected."},
+	{Code: secErrorBase + 68, Name: "SEC_ERROR_CERT_NICKNAME_COLLISION", Message: "A certificate with the same nickname already exists."},
+	{Code: secErrorBase + 69, Name: "SEC_ERROR_KEY_NICKNAME_COLLISION", Message: "A key with the same nickname already exists."},
+	{Code: secErrorBase + 70, Name: "SEC_ERROR_SAFE_NOT_CREATED", Message: "error while creating safe object"},
+	{Code: secErrorBase + 71, Name: "SEC_ERROR_BAGGAGE_NOT_CREATED", Message: "error while creating baggage object"},
+	{Code: secErrorBase + 72, Name: "XP_JAVA_REMOVE_PRINCIPAL_ERROR", Message: "Couldn't remove the principal"},
+	{Code: secErrorBase + 73, Name: "XP_JAVA_DELETE_PRIVILEGE_ERROR", Message: "Couldn't delete the privilege"},
+	{Code: secErrorBase + 74, Name: "XP_JAVA_CERT_NOT_EXISTS_ERROR", Message: "This principal doesn't have a certificate"},
+	{Code: secErrorBase + 75, Name: "SEC_ERROR_BAD_EXPORT_ALGORITHM", Message: "Required algorithm is not allowed."},
+	{Code: secErrorBase + 76, Name: "SEC_ERROR_EXPORTING_CERTIFICATES", Message: "Error attempting to export certificates."},
+	{Code: secErrorBase + 77, Name: "SEC_ERROR_IMPORTING_CERTIFICATES", Message: "Error attempting to import certificates."},
+	{Code: secErrorBase + 78, Name: "SEC_ERROR_PKCS12_DECODING_PFX", Message: "Unable to import. Decoding error. File not valid."},
+	{Code: secErrorBase + 79, Name: "SEC_ERROR_PKCS12_INVALID_MAC", Message: "Unable to import. Invalid MAC. Incorrect password or corrupt file."},
+	{Code: secErrorBase + 80, Name: "SEC_ERROR_PKCS12_UNSUPPORTED_MAC_ALGORITHM", Message: "Unable to import. MAC algorithm not supported."},
+	{Code: secErrorBase + 81, Name: "SEC_ERROR_PKCS12_UNSUPPORTED_TRANSPORT_MODE", Message: "Unable to import. Only password integrity and privacy modes supported."},
+	{Code: secErrorBase + 82, Name: "SEC_ERROR_PKCS12_CORRUPT_PFX_STRUCTURE", Message: "Unable to import. File structure is corrupt."},
+	{Code: secErrorBase + 83, Name: "SEC_ERROR_PKCS12_UNSUPPORTED_PBE_ALGORITHM", Message: "Unable to import. Encryption algorithm not supported."},
+	{Code: secErrorBase + 84, Name: "SEC_ERROR_PKCS12_UNSUPPORTED_VERSION", Message: "Unable to import. File version not supported."},
+	{Code: secErrorBase + 85, Name: "SEC_ERROR_PKCS12_PRIVACY_PASSWORD_INCORRECT", Message: "Unable to import. Incorrect privacy password."},
+	{Code: secErrorBase + 86, Name: "SEC_ERROR_PKCS12_CERT_COLLISION", Message: "Unable to import. Same nickname already exists in database."},
+	{Code: secErrorBase + 87, Name: "SEC_ERROR_USER_CANCELLED", Message: "The user pressed cancel."},
+	{Code: secErrorBase + 88, Name: "SEC_ERROR_PKCS12_DUPLICATE_DATA", Message: "Not imported, already in database."},
+	{Code: secErrorBase + 89, Name: "SEC_ERROR_MESSAGE_SEND_ABORTED", Message: "Message not sent."},
+	{Code: secErrorBase + 90, Name: "SEC_ERROR_INADEQUATE_KEY_USAGE", Message: "Certificate key usage inadequate for attempted operation."},
+	{Code: secErrorBase + 91, Name: "SEC_ERROR_INADEQUATE_CERT_TYPE", Message: "Certificate type not approved for application."},
+	{Code: secErrorBase + 92, Name: "SEC_ERROR_CERT_ADDR_MISMATCH", Message: "Address in signing certificate does not match address in message headers."},
+	{Code: secErrorBase + 93, Name: "SEC_ERROR_PKCS12_UNABLE_TO_IMPORT_KEY", Message: "Unable to import. Error attempting to import private key."},
+	{Code: secErrorBase + 94, Name: "SEC_ERROR_PKCS12_IMPORTING_CERT_CHAIN", Message: "Unable to import. Error attempting to import certificate chain."},
+	{Code: secErrorBase + 95, Name: "SEC_ERROR_PKCS12_UNABLE_TO_LOCATE_OBJECT_BY_NAME", Message: "Unable to export. Unable to locate certificate or key by nickname."},
+	{Code: secErrorBase + 96, Name: "SEC_ERROR_PKCS12_UNABLE_TO_EXPORT_KEY", Message: "Unable to export. Private Key could not be located and exported."},
+	{Code: secErrorBase + 97, Name: "SEC_ERROR_PKCS12_UNABLE_TO_WRITE", Message: "Unable to export. Unable to write the export file."},
+	{Code: secErrorBase + 98, Name: "SEC_ERROR_PKCS12_UNABLE_TO_READ", Message: "Unable to import. Unable to read the import file."},
+	{Code: secErrorBase + 99, Name: "SEC_ERROR_PKCS12_KEY_DATABASE_NOT_INITIALIZED", Message: "Unable to export. Key database corrupt or deleted."},
+	{Code: secErrorBase + 100, Name: "SEC_ERROR_KEYGEN_FAIL", Message: "Unable to generate public/private key pair."},
+	{Code: secErrorBase + 101, Name: "SEC_ERROR_INVALID_PASSWORD", Message: "Password entered is invalid. Please pick a different one."},
+	{Code: secErrorBase + 102, Name: "SEC_ERROR_RETRY_OLD_PASSWORD", Message: "Old password entered incorrectly. Please try again."},
+	{Code: secErrorBase + 103, Name: "SEC_ERROR_BAD_NICKNAME", Message: "Certificate nickname already in use."},
+	{Code: secErrorBase + 104, Name: "SEC_ERROR_NOT_FORTEZZA_ISSUER", Message: "Peer FORTEZZA chain has a non-FORTEZZA Certificate."},
+	{Code: secErrorBase + 105, Name: "SEC_ERROR_CANNOT_MOVE_SENSITIVE_KEY", Message: "A sensitive key cannot be moved to the slot where it is needed."},
+	{Code: secErrorBase + 106, Name: "SEC_ERROR_JS_INVALID_MODULE_NAME", Message: "Invalid module name."},
+	{Code: secErrorBase + 107, Name: "SEC_ERROR_JS_INVALID_DLL", Message: "Invalid module path/filename"},
+	{Code: secErrorBase + 108, Name: "SEC_ERROR_JS_ADD_MOD_FAILURE", Message: "Unable to add module"},
+	{Code: secErrorBase + 109, Name: "SEC_ERROR_JS_DEL_MOD_FAILURE", Message: "Unable to delete module"},
+	{Code: secErrorBase + 110, Name: "SEC_ERROR_OLD_KRL", Message: "New KRL is not later than the current one."},
+	{Code: secErrorBase + 111, Name: "SEC_ERROR_CKL_CONFLICT", Message: "New CKL has different issuer than current CKL. Delete current CKL."},
+	{Code: secErrorBase + 112, Name: "SEC_ERROR_CERT_NOT_IN_NAME_SPACE", Message: "The Certifying Authority for this certificate is not permitted to issue a certificate with this name."},
+	{Code: secErrorBase + 113, Name: "SEC_ERROR_KRL_NOT_YET_VALID", Message: "The key revocation list for this certificate is not yet valid."},
+	{Code: secErrorBase + 114, Name: "SEC_ERROR_CRL_NOT_YET_VALID", Message: "The certificate revocation list for this certificate is not yet valid."},
+	{Code: secErrorBase + 115, Name: "SEC_ERROR_UNKNOWN_CERT", Message: "The requested certificate could not be found."},
+	{Code: secErrorBase + 116, Name: "SEC_ERROR_UNKNOWN_SIGNER", Message: "The signer's certificate could not be found."},
+	{Code: secErrorBase + 117, Name: "SEC_ERROR_CERT_BAD_ACCESS_LOCATION", Message: "The location for the certificate status server has invalid format."},
+	{Code: secErrorBase + 118, Name: "SEC_ERROR_OCSP_UNKNOWN_RESPONSE_TYPE", Message: "The OCSP response cannot be fully decoded; it is of an unknown type."},
+	{Code: secErrorBase + 119, Name: "SEC_ERROR_OCSP_BAD_HTTP_RESPONSE", Message: "The OCSP server returned unexpected/invalid HTTP data."},
+	{Code: secErrorBase + 120, Name: "SEC_ERROR_OCSP_MALFORMED_REQUEST", Message: "The OCSP server found the request to be corrupted or improperly formed."},
+	{Code: secErrorBase + 121, Name: "SEC_ERROR_OCSP_SERVER_ERROR", Message: "The OCSP server experienced an internal error."},
+	{Code: secErrorBase + 122, Name: "SEC_ERROR_OCSP_TRY_SERVER_LATER", Message: "The OCSP server suggests trying again later."},
+	{Code: secErrorBase + 123, Name: "SEC_ERROR_OCSP_REQUEST_NEEDS_SIG", Message: "The OCSP server requires a signature on this request."},
+	{Code: secErrorBase + 124, Name: "SEC_ERROR_OCSP_UNAUTHORIZED_REQUEST", Message: "The OCSP server has refused this request as unauthorized."},
+	{Code: secErrorBase + 125, Name: "SEC_ERROR_OCSP_UNKNOWN_RESPONSE_STATUS", Message: "The OCSP server returned an unrecognizable status."},
+	{Code: secErrorBase + 126, Name: "SEC_ERROR_OCSP_UNKNOWN_CERT", Message: "The OCSP server has no status for the certificate."},
+	{Code: secErrorBase + 127, Name: "SEC_ERROR_OCSP_NOT_ENABLED", Message: "You must enable OCSP before performing this operation."},
+	{Code: secErrorBase + 128, Name: "SEC_ERROR_OCSP_NO_DEFAULT_RESPONDER", Message: "You must set the OCSP default responder before performing this operation."},
+	{Code: secErrorBase + 129, Name: "SEC_ERROR_OCSP_MALFORMED_RESPONSE", Message: "The response from the OCSP server was corrupted or improperly formed."},
+	{Code: secErrorBase + 130, Name: "SEC_ERROR_OCSP_UNAUTHORIZED_RESPONSE", Message: "The signer of the OCSP response is not authorized to give status for this certificate."},
+	{Code: secErrorBase + 131, Name: "SEC_ERROR_OCSP_FUTURE_RESPONSE", Message: "The OCSP response is not yet valid (contains a date in the future)."},
+	{Code: secErrorBase + 132, Name: "SEC_ERROR_OCSP_OLD_RESPONSE", Message: "The OCSP response contains out-of-date information."},
+	{Code: secErrorBase + 133, Name: "SEC_ERROR_DIGEST_NOT_FOUND", Message: "The CMS or PKCS #7 Digest was not found in signed message."},
+	{Code: secErrorBase + 134, Name: "SEC_ERROR_UNSUPPORTED_MESSAGE_TYPE", Message: "The CMS or PKCS #7 Message type is unsupported."},
+	{Code: secErrorBase + 135, Name: "SEC_ERROR_MODULE_STUCK", Message: "PKCS #11 module could not be removed because it is still in use."},
+	{Code: secErrorBase + 136, Name: "SEC_ERROR_BAD_TEMPLATE", Message: "Could not decode ASN.1 data. Specified template was invalid."},
+	{Code: secErrorBase + 137, Name: "SEC_ERROR_CRL_NOT_FOUND", Message: "No matching CRL was found."},
+	{Code: secErrorBase + 138, Name: "SEC_ERROR_REUSED_ISSUER_AND_SERIAL", Message: "You are attempting to import a cert with the same issuer/serial as an existing cert, but that is not the same cert."},
+	{Code: secErrorBase + 139, Name: "SEC_ERROR_BUSY", Message: "NSS could not shutdown. Objects are still in use."},
+	{Code: secErrorBase + 140, Name: "SEC_ERROR_EXTRA_INPUT", Message: "DER-encoded message contained extra unused data."},
+	{Code: secErrorBase + 141, Name: "SEC_ERROR_UNSUPPORTED_ELLIPTIC_CURVE", Message: "Unsupported elliptic curve."},
+	{Code: secErrorBase + 142, Name: "SEC_ERROR_UNSUPPORTED_EC_POINT_FORM", Message: "Unsupported elliptic curve point form."},
+	{Code: secErrorBase + 143, Name: "SEC_ERROR_UNRECOGNIZED_OID", Message: "Unrecognized Object Identifier."},
+	{Code: secErrorBase + 144, Name: "SEC_ERROR_OCSP_INVALID_SIGNING_CERT", Message: "Invalid OCSP signing certificate in OCSP response."},
+	{Code: secErrorBase + 145, Name: "SEC_ERROR_REVOKED_CERTIFICATE_CRL", Message: "Certificate is revoked in issuer's certificate revocation list."},
+	{Code: secErrorBase + 146, Name: "SEC_ERROR_REVOKED_CERTIFICATE_OCSP", Message: "Issuer's OCSP responder reports certificate is revoked."},
+	{Code: secErrorBase + 147, Name: "SEC_ERROR_CRL_INVALID_VERSION", Message: "Issuer's Certificate Revocation List has an unknown version number."},
+	{Code: secErrorBase + 148, Name: "SEC_ERROR_CRL_V1_CRITICAL_EXTENSION", Message: "Issuer's V1 Certificate Revocation List has a critical extension."},
+	{Code: secErrorBase + 149, Name: "SEC_ERROR_CRL_UNKNOWN_CRITICAL_EXTENSION", Message: "Issuer's V2 Certificate Revocation List has an unknown critical extension."},
+	{Code: secErrorBase + 150, Name: "SEC_ERROR_UNKNOWN_OBJECT_TYPE", Message: "Unknown object type specified."},
+	{Code: secErrorBase + 151, Name: "SEC_ERROR_INCOMPATIBLE_PKCS11", Message: "PKCS #11 driver violates the spec in an incompatible way."},
+	{Code: secErrorBase + 152, Name: "SEC_ERROR_NO_EVENT", Message: "No new slot event is available at this time."},
+	{Code: secErrorBase + 153, Name: "SEC_ERROR_CRL_ALREADY_EXISTS", Message: "CRL already exists."},
+	{Code: secErrorBase + 154, Name: "SEC_ERROR_NOT_INITIALIZED", Message: "NSS is not initialized."},
+	{Code: secErrorBase + 155, Name: "SEC_ERROR_TOKEN_NOT_LOGGED_IN", Message: "The operation failed because the PKCS#11 token is not logged in."},
+	{Code: secErrorBase + 156, Name: "SEC_ERROR_OCSP_RESPONDER_CERT_INVALID", Message: "Configured OCSP responder's certificate is invalid."},
+	{Code: secErrorBase + 157, Name: "SEC_ERROR_OCSP_BAD_SIGNATURE", Message: "OCSP response has an invalid signature."},
+	{Code: secErrorBase + 158, Name: "SEC_ERROR_OUT_OF_SEARCH_LIMITS", Message: "Cert validation search is out of search limits"},
+	{Code: secErrorBase + 159, Name: "SEC_ERROR_INVALID_POLICY_MAPPING", Message: "Policy mapping contains anypolicy"},
+	{Code: secErrorBase + 160, Name: "SEC_ERROR_POLICY_VALIDATION_FAILED", Message: "Cert chain fails policy validation"},
+	{Code: secErrorBase + 161, Name: "SEC_ERROR_UNKNOWN_AIA_LOCATION_TYPE", Message: "Unknown location type in cert AIA extension"},
+	{Code: secErrorBase + 162, Name: "SEC_ERROR_BAD_HTTP_RESPONSE", Message: "Server returned bad HTTP response"},
+	{Code: secErrorBase + 163, Name: "SEC_ERROR_BAD_LDAP_RESPONSE", Message: "Server returned bad LDAP response"},
+	{Code: secErrorBase + 164, Name: "SEC_ERROR_FAILED_TO_ENCODE_DATA", Message: "Failed to encode data with ASN1 encoder"},
+	{Code: secErrorBase + 165, Name: "SEC_ERROR_BAD_INFO_ACCESS_LOCATION", Message: "Bad information access location in cert extension"},
+	{Code: secErrorBase + 166, Name: "SEC_ERROR_LIBPKIX_INTERNAL", Message: "Libpkix internal error occurred during cert validation."},
+	{Code: secErrorBase + 167, Name: "SEC_ERROR_PKCS11_GENERAL_ERROR", Message: "A PKCS #11 module returned CKR_GENERAL_ERROR, indicating that an unrecoverable error has occurred."},
+	{Code: secErrorBase + 168, Name: "SEC_ERROR_PKCS11_FUNCTION_FAILED", Message: "A PKCS #11 module returned CKR_FUNCTION_FAILED, indicating that the requested function could not be performed. Trying the same operation again might succeed."},
+	{Code: secErrorBase + 169, Name: "SEC_ERROR_PKCS11_DEVICE_ERROR", Message: "A PKCS #11 module returned CKR_DEVICE_ERROR, indicating that a problem has occurred with the token or slot."},
+	{Code: secErrorBase + 170, Name: "SEC_ERROR_BAD_INFO_ACCESS_METHOD", Message: "Unknown information access method in certificate extension."},
+	{Code: secErrorBase + 171, Name: "SEC_ERROR_CRL_IMPORT_FAILED", Message: "Error attempting to import a CRL."},
+	{Code: secErrorBase + 172, Name: "SEC_ERROR_EXPIRED_PASSWORD", Message: "The password expired."},
+	{Code: secErrorBase + 173, Name: "SEC_ERROR_LOCKED_PASSWORD", Message: "The password is locked."},
+	{Code: secErrorBase + 174, Name: "SEC_ERROR_UNKNOWN_PKCS11_ERROR", Message: "Unknown PKCS #11 error."},
+	{Code: secErrorBase + 175, Name: "SEC_ERROR_BAD_CRL_DP_URL", Message: "Invalid or unsupported URL in CRL distribution point name."},
+	{Code: secErrorBase + 176, Name: "SEC_ERROR_CERT_SIGNATURE_ALGORITHM_DISABLED", Message: "The certificate was signed using a signature algorithm that is disabled because it is not secure."},
+	{Code: secErrorBase + 177, Name: "SEC_ERROR_LEGACY_DATABASE", Message: "The certificate/key database is in an old, unsupported format."},
+	{Code: secErrorBase + 178, Name: "SEC_ERROR_APPLICATION_CALLBACK_ERROR", Message: "The certificate was rejected by extra checks in the application."},
+	{Code: secErrorBase + 179, Name: "SEC_ERROR_INVALID_STATE", Message: "The attempted operation is invalid for the current state."},
+	{Code: secErrorBase + 180, Name: "SEC_ERROR_POLICY_LOCKED", Message: "Could not change the policy because the policy is now locked."},
+	{Code: secErrorBase + 181, Name: "SEC_ERROR_SIGNATURE_ALGORITHM_DISABLED", Message: "Could not create or verify a signature using a signature algorithm that is disabled because it is not secure."},
+	{Code: secErrorBase + 182, Name: "SEC_ERROR_ALGORITHM_MISMATCH", Message: "The signature algorithm in the signature field of the certificate does not match the algorithm in its signatureAlgorithm field."},
+}
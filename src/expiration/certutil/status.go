@@ -0,0 +1,199 @@
+package certutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+// Status is the verdict reached by NSS for a single certificate.
+type Status int
+
+const (
+	StatusUnrecognized Status = iota
+	StatusValid
+	StatusExpired
+	StatusIssuerExpired
+	StatusIssuerUnknown
+	StatusRevoked
+	StatusUntrustedIssuer
+	StatusUntrustedCert
+	StatusBadSignature
+	StatusInadequateKeyUsage
+	StatusInadequateCertType
+	StatusInvalidCA
+	StatusPathLenConstraint
+	StatusUnknownCriticalExtension
+	StatusNameConstraints
+	StatusPolicyValidation
+	StatusSignatureAlgorithmDisabled
+	StatusBadDER
+	StatusCRLExpired
+	StatusOCSPFailure
+	StatusCertNotFound
+	// StatusToolFailure means that certutil could not be run at all, or that
+	// it exited with a failure without saying anything about the certificate.
+	StatusToolFailure
+)
+
+var statusNames = map[Status]string{
+	StatusUnrecognized:               "unrecognized",
+	StatusValid:                      "valid",
+	StatusExpired:                    "expired",
+	StatusIssuerExpired:              "issuer expired",
+	StatusIssuerUnknown:              "issuer unknown",
+	StatusRevoked:                    "revoked",
+	StatusUntrustedIssuer:            "untrusted issuer",
+	StatusUntrustedCert:              "untrusted certificate",
+	StatusBadSignature:               "bad signature",
+	StatusInadequateKeyUsage:         "inadequate key usage",
+	StatusInadequateCertType:         "inadequate certificate type",
+	StatusInvalidCA:                  "invalid CA",
+	StatusPathLenConstraint:          "path length constraint",
+	StatusUnknownCriticalExtension:   "unknown critical extension",
+	StatusNameConstraints:            "name constraints",
+	StatusPolicyValidation:           "policy validation",
+	StatusSignatureAlgorithmDisabled: "signature algorithm disabled",
+	StatusBadDER:                     "bad DER",
+	StatusCRLExpired:                 "CRL expired",
+	StatusOCSPFailure:                "OCSP failure",
+	StatusCertNotFound:               "certificate not found",
+	StatusToolFailure:                "tool failure",
+}
+
+func (s Status) String() string {
+	return statusNames[s]
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// NSSError is an entry of NSS's lib/util/SECerrs.h, which is where the
+// strings that certutil and vfychain print come from. Every entry is in
+// nsserrors.go, which is generated from SECerrs.h.
+type NSSError struct {
+	Code    int
+	Name    string
+	Message string
+	Status  Status
+}
+
+//go:generate go run gen_nsserrors.go $NSS_SOURCE/lib/util/SECerrs.h
+
+const secErrorBase = -0x2000
+
+// nssStatuses are the statuses of those NSS errors that say something of the
+// certificate, any other error being unrecognized. Every SEC_ERROR_OCSP_ error
+// is an OCSP failure.
+var nssStatuses = map[string]Status{
+	"SEC_ERROR_BAD_DER":                           StatusBadDER,
+	"SEC_ERROR_BAD_SIGNATURE":                     StatusBadSignature,
+	"SEC_ERROR_EXPIRED_CERTIFICATE":               StatusExpired,
+	"SEC_ERROR_REVOKED_CERTIFICATE":               StatusRevoked,
+	"SEC_ERROR_REVOKED_CERTIFICATE_CRL":           StatusRevoked,
+	"SEC_ERROR_REVOKED_CERTIFICATE_OCSP":          StatusRevoked,
+	"SEC_ERROR_UNKNOWN_ISSUER":                    StatusIssuerUnknown,
+	"SEC_ERROR_UNTRUSTED_ISSUER":                  StatusUntrustedIssuer,
+	"SEC_ERROR_UNTRUSTED_CERT":                    StatusUntrustedCert,
+	"SEC_ERROR_EXPIRED_ISSUER_CERTIFICATE":        StatusIssuerExpired,
+	"SEC_ERROR_CRL_EXPIRED":                       StatusCRLExpired,
+	"SEC_ERROR_CA_CERT_INVALID":                   StatusInvalidCA,
+	"SEC_ERROR_PATH_LEN_CONSTRAINT_INVALID":       StatusPathLenConstraint,
+	"SEC_ERROR_UNKNOWN_CRITICAL_EXTENSION":        StatusUnknownCriticalExtension,
+	"SEC_ERROR_INADEQUATE_KEY_USAGE":              StatusInadequateKeyUsage,
+	"SEC_ERROR_INADEQUATE_CERT_TYPE":              StatusInadequateCertType,
+	"SEC_ERROR_CERT_NOT_IN_NAME_SPACE":            StatusNameConstraints,
+	"SEC_ERROR_POLICY_VALIDATION_FAILED":          StatusPolicyValidation,
+	"SEC_ERROR_CERT_SIGNATURE_ALGORITHM_DISABLED": StatusSignatureAlgorithmDisabled,
+	"SEC_ERROR_SIGNATURE_ALGORITHM_DISABLED":      StatusSignatureAlgorithmDisabled,
+}
+
+func init() {
+	for i, e := range nssErrors {
+		if strings.HasPrefix(e.Name, "SEC_ERROR_OCSP_") {
+			nssErrors[i].Status = StatusOCSPFailure
+		} else {
+			nssErrors[i].Status = nssStatuses[e.Name]
+		}
+	}
+}
+
+// LookupCode returns the NSS error with the given numeric code, as printed by vfychain.
+func LookupCode(code int) (NSSError, bool) {
+	for _, e := range nssErrors {
+		if e.Code == code {
+			return e, true
+		}
+	}
+	return NSSError{}, false
+}
+
+// LookupMessage returns the NSS error whose human readable string is the
+// given message. Runs of whitespace are insignificant, as some versions of
+// NSS separate sentences with two spaces.
+func LookupMessage(message string) (NSSError, bool) {
+	message = strings.Join(strings.Fields(message), " ")
+	for _, e := range nssErrors {
+		if strings.EqualFold(strings.Join(strings.Fields(e.Message), " "), message) {
+			return e, true
+		}
+	}
+	return NSSError{}, false
+}
+
+// Verdict is the parsed result of a certutil -V invocation.
+type Verdict struct {
+	Status   Status
+	NSSError string
+	ExitCode int
+	Raw      string
+}
+
+const (
+	validPrefix   = "certutil: certificate is valid"
+	invalidPrefix = "certutil: certificate is invalid: "
+	notFound      = "could not find certificate named"
+)
+
+// ParseVerify interprets the combined output and error of a certutil -V invocation.
+// certutil exits non zero whenever the certificate is anything other than valid,
+// so the exit code alone cannot tell a revoked certificate from a misuse of the tool.
+// The printed NSS error string is therefore the primary source of the verdict
+// while the exit code is kept to catch the tool failing outright.
+func ParseVerify(out []byte, err error) (verdict Verdict) {
+	verdict.Raw = string(out)
+	switch e := err.(type) {
+	case nil:
+		verdict.ExitCode = 0
+	case *exec.ExitError:
+		verdict.ExitCode = e.ExitCode()
+	default:
+		// The process never ran, eg. certutil is not on the PATH.
+		verdict.ExitCode = -1
+		verdict.Status = StatusToolFailure
+		return
+	}
+	for _, line := range bytes.Split(out, []byte{'\n'}) {
+		l := string(bytes.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(l, validPrefix):
+			verdict.Status = StatusValid
+			return
+		case strings.HasPrefix(l, invalidPrefix):
+			if e, ok := LookupMessage(strings.TrimPrefix(l, invalidPrefix)); ok {
+				verdict.Status = e.Status
+				verdict.NSSError = e.Name
+			}
+			return
+		case strings.Contains(l, notFound):
+			verdict.Status = StatusCertNotFound
+			return
+		}
+	}
+	if verdict.ExitCode != 0 {
+		verdict.Status = StatusToolFailure
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package certutil
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func exitError(t *testing.T) error {
+	err := exec.Command("sh", "-c", "exit 255").Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("expected an *exec.ExitError, got %v", err)
+	}
+	return err
+}
+
+func TestParseVerify(t *testing.T) {
+	failed := exitError(t)
+	tests := []struct {
+		out      string
+		err      error
+		status   Status
+		nssError string
+		exitCode int
+	}{
+		{VALID, nil, StatusValid, "", 0},
+		{EXPIRED, failed, StatusExpired, "SEC_ERROR_EXPIRED_CERTIFICATE", 255},
+		{ISSUER_UNKOWN, failed, StatusIssuerUnknown, "SEC_ERROR_UNKNOWN_ISSUER", 255},
+		{"certutil: certificate is invalid: Peer's Certificate has been revoked.", failed, StatusRevoked, "SEC_ERROR_REVOKED_CERTIFICATE", 255},
+		{"certutil: certificate is invalid: Peer's certificate issuer has been marked as not trusted by the user.", failed, StatusUntrustedIssuer, "SEC_ERROR_UNTRUSTED_ISSUER", 255},
+		{"certutil: certificate is invalid: Certificate key usage inadequate for attempted operation.", failed, StatusInadequateKeyUsage, "SEC_ERROR_INADEQUATE_KEY_USAGE", 255},
+		{"certutil: certificate is invalid: Something NSS has never said before.", failed, StatusUnrecognized, "", 255},
+		{"certutil: could not find certificate named \"abc\": SEC_ERROR_BAD_DATABASE", failed, StatusCertNotFound, "", 255},
+		{"certutil: function failed: SEC_ERROR_BAD_DATABASE", failed, StatusToolFailure, "", 255},
+		{"", errors.New("exec: \"certutil\": executable file not found in $PATH"), StatusToolFailure, "", -1},
+	}
+	for _, test := range tests {
+		verdict := ParseVerify([]byte(test.out), test.err)
+		if verdict.Status != test.status {
+			t.Errorf("%q: expected status %v, got %v", test.out, test.status, verdict.Status)
+		}
+		if verdict.NSSError != test.nssError {
+			t.Errorf("%q: expected NSS error %q, got %q", test.out, test.nssError, verdict.NSSError)
+		}
+		if verdict.ExitCode != test.exitCode {
+			t.Errorf("%q: expected exit code %d, got %d", test.out, test.exitCode, verdict.ExitCode)
+		}
+		if verdict.Raw != test.out {
+			t.Errorf("expected the raw output to be retained, got %q", verdict.Raw)
+		}
+	}
+}
+
+func TestLookupCodes(t *testing.T) {
+	for code, want := range map[int]struct {
+		name   string
+		status Status
+	}{
+		-8180: {"SEC_ERROR_REVOKED_CERTIFICATE", StatusRevoked},
+		-8066: {"SEC_ERROR_OCSP_UNKNOWN_CERT", StatusOCSPFailure},
+		-8071: {"SEC_ERROR_OCSP_SERVER_ERROR", StatusOCSPFailure},
+		-8073: {"SEC_ERROR_OCSP_BAD_HTTP_RESPONSE", StatusOCSPFailure},
+		-8164: {"SEC_ERROR_CERT_NOT_VALID", StatusUnrecognized},
+		-8158: {"SEC_ERROR_EXTENSION_VALUE_INVALID", StatusUnrecognized},
+	} {
+		e, ok := LookupCode(code)
+		if !ok || e.Name != want.name || e.Status != want.status {
+			t.Errorf("%d: expected %s (%v), got %+v", code, want.name, want.status, e)
+		}
+	}
+	if len(nssErrors) < 180 {
+		t.Errorf("expected every error of SECerrs.h, got %d", len(nssErrors))
+	}
+	if e, ok := LookupMessage("The certificate issuer's certificate has expired.  Check your system date and time."); !ok || e.Status != StatusIssuerExpired {
+		t.Errorf("expected the message to be found regardless of spacing, got %+v", e)
+	}
+}
+
+func TestLookupCode(t *testing.T) {
+	e, ok := LookupCode(-8179)
+	if !ok || e.Name != "SEC_ERROR_UNKNOWN_ISSUER" {
+		t.Errorf("expected SEC_ERROR_UNKNOWN_ISSUER, got %v", e)
+	}
+	if _, ok := LookupCode(0); ok {
+		t.Error("expected no NSS error for code 0")
+	}
+}
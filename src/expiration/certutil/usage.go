@@ -0,0 +1,94 @@
+package certutil
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// Usage is the purpose for which a chain is verified. The empty usage is a
+// TLS server, which is what every test website was before any other was supported.
+type Usage string
+
+const (
+	TLSServer   Usage = "tls-server"
+	TLSClient   Usage = "tls-client"
+	SMIME       Usage = "smime"
+	CodeSigning Usage = "code-signing"
+)
+
+var Usages = []Usage{TLSServer, TLSClient, SMIME, CodeSigning}
+
+func ParseUsage(u string) (Usage, error) {
+	if u == "" {
+		return TLSServer, nil
+	}
+	for _, usage := range Usages {
+		if Usage(u) == usage {
+			return usage, nil
+		}
+	}
+	return "", fmt.Errorf("unknown usage %q, expected one of tls-server, tls-client, smime or code-signing", u)
+}
+
+func (u Usage) normalize() Usage {
+	if u == "" {
+		return TLSServer
+	}
+	return u
+}
+
+// CertUsage is the certutil -u option with which to verify a certificate for
+// this usage. CAs are verified as SSL CAs for TLS, and as any CA otherwise,
+// as certutil has no usage for S/MIME or object signing CAs.
+func (u Usage) CertUsage(cert *x509.Certificate) string {
+	switch u.normalize() {
+	case TLSClient:
+		if cert.IsCA {
+			return CertUsageSSLCA
+		}
+		return CertUsageSSLClient
+	case SMIME:
+		if cert.IsCA {
+			return CertUsageAnyCA
+		}
+		return CertUsageEmailSigner
+	case CodeSigning:
+		if cert.IsCA {
+			return CertUsageAnyCA
+		}
+		return CertUsageObjectSigner
+	}
+	if cert.IsCA {
+		return CertUsageSSLCA
+	}
+	return CertUsageSSLServer
+}
+
+// Trust is the trust with which a root is installed when it is to be trusted
+// for this usage alone. Each usage has its own position within NSS's trust
+// arguments, being SSL, S/MIME and then object signing.
+func (u Usage) Trust() Trust {
+	switch u.normalize() {
+	case TLSClient:
+		return Trust{SSL: TrustedClientCA}
+	case SMIME:
+		return Trust{Email: TrustedCA}
+	case CodeSigning:
+		return Trust{ObjectSigning: TrustedCA}
+	}
+	return Trust{SSL: TrustedCA}
+}
+
+// ExtKeyUsage is the extended key usage that the leaf and every intermediate
+// must permit, either explicitly or by having no extended key usage at all.
+func (u Usage) ExtKeyUsage() x509.ExtKeyUsage {
+	switch u.normalize() {
+	case TLSClient:
+		return x509.ExtKeyUsageClientAuth
+	case SMIME:
+		return x509.ExtKeyUsageEmailProtection
+	case CodeSigning:
+		return x509.ExtKeyUsageCodeSigning
+	}
+	return x509.ExtKeyUsageServerAuth
+}
@@ -1,51 +1,114 @@
 package expiration
 
 import (
+	"context"
 	"crypto/x509"
 	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/expiration/vfychain"
+	"github.com/christopher-henderson/CACop/logging"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type ExpirationStatus struct {
 	Valid         bool
 	Expired       bool
 	IssuerUnknown bool
+	Status        certutil.Status
+	NSSError      string
+	ExitCode      int
+	SelfSigned    bool
+	Trust         certutil.Trust
 	Raw           string
 	Error         error
 }
 
-func VerifyChain(chain []*x509.Certificate) ([]ExpirationStatus, error) {
+// Revocation is the set of revocation methods exercised by vfychain.
+var Revocation = vfychain.OCSP | vfychain.CRL
+
+// VerifyChain installs the chain into a fresh NSS database and verifies each
+// certificate. The last certificate in the chain is the root designated by the
+// caller and is the only one installed with rootTrust.
+//
+// Alongside the per certificate verdicts of certutil, the chain as a whole is
+// validated by vfychain against the same database. Both tools verify for the
+// given usage at the given time, or now if the time is zero.
+func VerifyChain(ctx context.Context, chain []*x509.Certificate, rootTrust certutil.Trust, usage certutil.Usage, at time.Time) ([]ExpirationStatus, vfychain.Result, error) {
+	log := logging.FromContext(ctx)
 	statuses := make([]ExpirationStatus, len(chain))
+	var path vfychain.Result
 	c, err := certutil.NewCertutil()
 	if err != nil {
-		return statuses, errors.Wrap(err, "failed to initialize a new NSS certificate database")
+		return statuses, path, errors.Wrap(err, "failed to initialize a new NSS certificate database")
 	}
 	defer c.Delete()
-	for _, cert := range chain {
-		out, err := c.Install(cert)
+	root := len(chain) - 1
+	for i, cert := range chain {
+		trust := certutil.NoTrust
+		if i == root {
+			trust = rootTrust
+		}
+		statuses[i].Trust = trust
+		statuses[i].SelfSigned = certutil.IsSelfSigned(cert)
+		out, err := c.Install(cert, trust)
 		o := string(out)
 		if err != nil {
-			return statuses, errors.Wrapf(err, "failed to install certificate, %v", o)
+			return statuses, path, errors.Wrapf(err, "failed to install certificate, %v", o)
 		}
 	}
 	for i, cert := range chain {
-		statuses[i] = queryExpiration(cert, c)
+		queryExpiration(cert, c, usage, at, &statuses[i])
+		entry := log.WithFields(logrus.Fields{
+			"fingerprint": certutil.FingerprintOf(cert),
+			"status":      statuses[i].Status.String(),
+			"nss_error":   statuses[i].NSSError,
+			"exit_code":   statuses[i].ExitCode,
+		})
+		if statuses[i].Error != nil {
+			entry.WithError(statuses[i].Error).Error("certutil failed")
+		} else {
+			entry.Debug("certutil verified certificate")
+		}
+	}
+	path = vfychain.VerifyChain(c.Dir(), pathOf(chain), vfychain.Options{
+		Usage:      vfychain.UsageOf(usage),
+		Revocation: Revocation,
+		Time:       at,
+	})
+	entry := log.WithFields(logrus.Fields{
+		"status":    path.Status.String(),
+		"nss_error": path.NSSError,
+		"exit_code": path.ExitCode,
+	})
+	if path.Error != nil {
+		entry.WithError(path.Error).Error("vfychain failed")
+	} else {
+		entry.Debug("vfychain validated chain")
+	}
+	return statuses, path, nil
+}
+
+// pathOf is the portion of the chain given to vfychain, which is everything
+// but the root as the root is found within the database.
+func pathOf(chain []*x509.Certificate) []*x509.Certificate {
+	if len(chain) == 1 {
+		return chain
 	}
-	return statuses, nil
+	return chain[:len(chain)-1]
 }
 
-func queryExpiration(certificate *x509.Certificate, c certutil.Certutil) (exps ExpirationStatus) {
-	// @TODO try to figure certutil's error codes. It uses non zero codes when the answer is
-	// anything other than just "valid", so it's not a reliable way to know whether or not
-	// the tool was fundamentally used wrong or if the cert is just expired or what.
-	resp, _ := c.Verify(certificate)
-	response := string(resp)
-	exps.Raw = response
-	exps.Valid = certutil.VALID == response
-	exps.Expired = certutil.EXPIRED == response
-	exps.IssuerUnknown = certutil.ISSUER_UNKOWN == response
-	if !exps.Valid && !exps.Expired && !exps.IssuerUnknown {
-		exps.Error = errors.New(string(response))
+func queryExpiration(certificate *x509.Certificate, c certutil.Certutil, usage certutil.Usage, at time.Time, exps *ExpirationStatus) {
+	verdict := certutil.ParseVerify(c.Verify(certificate, usage, at))
+	exps.Raw = verdict.Raw
+	exps.Status = verdict.Status
+	exps.NSSError = verdict.NSSError
+	exps.ExitCode = verdict.ExitCode
+	exps.Valid = verdict.Status == certutil.StatusValid
+	exps.Expired = verdict.Status == certutil.StatusExpired
+	exps.IssuerUnknown = verdict.Status == certutil.StatusIssuerUnknown
+	switch verdict.Status {
+	case certutil.StatusUnrecognized, certutil.StatusToolFailure:
+		exps.Error = errors.Errorf("certutil exited with %d: %s", verdict.ExitCode, verdict.Raw)
 	}
-	return
 }
@@ -1,68 +1,81 @@
 package expiration
 
 import (
-	"bytes"
-	"crypto/x509"
-	"encoding/pem"
-	"github.com/christopher-henderson/CACop/expiration/certutil"
-	"io/ioutil"
-	"log"
+	"context"
 	"os"
 	"testing"
-)
+	"time"
 
-//var revoked = `/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/AffirmTrust Premium/revoked`
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/pkitest"
+)
 
-const DIST = "/Users/chris/Documents/Contracting/mozilla/testWebSites/dist/Debug"
+// nss is why the NSS tools could not be found, either on the PATH or within
+// the distribution named by the NSS_DIST environment variable.
+var nss error
 
-func init() {
-	if err := certutil.Init(DIST); err != nil {
-		log.Panic(err)
-	}
+func TestMain(m *testing.M) {
+	nss = certutil.Init(os.Getenv("NSS_DIST"))
+	os.Exit(m.Run())
 }
 
-func parseChain(path string) (certs []*x509.Certificate) {
-	f, err := os.Open(path)
-	if err != nil {
-		panic(err)
-	}
-	raw, err := ioutil.ReadAll(f)
-	if err != nil {
-		panic(err)
-	}
-	for _, b := range bytes.SplitAfter(raw, []byte("-----END CERTIFICATE-----")) {
-		block, rest := pem.Decode(b)
-		if len(rest) != 0 {
-			continue
-		}
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			panic(err)
-		}
-		certs = append(certs, cert)
+func requireNSS(t *testing.T) {
+	if nss != nil {
+		t.Skipf("the NSS tools are unavailable: %v", nss)
 	}
-	return
 }
 
 func TestUnknownIssuer(t *testing.T) {
-	chain := parseChain(revoked)
-	c, err := certutil.NewCertutil()
+	requireNSS(t)
+	p := pkitest.NewT(t)
+	// The leaf alone is installed as though it were the root, but without trust.
+	statuses, _, err := VerifyChain(context.Background(), p.Valid.Chain[:1], certutil.NoTrust, certutil.TLSServer, time.Time{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer c.Delete()
-	c.Install(chain[0])
-	o, err := c.Verify(chain[0])
-	t.Log(string(o))
-	t.Log(err)
+	if !statuses[0].IssuerUnknown {
+		t.Errorf("expected the issuer to be unknown, got %+v", statuses[0])
+	}
 }
 
-var expired = "/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/DST Root CA X3/expired"
-var revoked = "/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/DST Root CA X3/revoked"
-var valid = "/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/DST Root CA X3/valid"
-
 func TestVerifyChain(t *testing.T) {
-	t.Log(VerifyChain(parseChain(valid)))
-	t.Log(VerifyChain(parseChain(revoked)))
-	t.Log(VerifyChain(parseChain(expired)))
+	requireNSS(t)
+	p := pkitest.NewT(t)
+	tests := []struct {
+		leaf    *pkitest.Leaf
+		status  certutil.Status
+		revoked bool
+	}{
+		{p.Valid, certutil.StatusValid, false},
+		{p.Expired, certutil.StatusExpired, false},
+		{p.Revoked, certutil.StatusValid, true},
+	}
+	for _, test := range tests {
+		name := test.leaf.Certificate.Subject.CommonName
+		statuses, path, err := VerifyChain(context.Background(), test.leaf.Chain, certutil.TrustedRoot, certutil.TLSServer, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != 3 {
+			t.Fatalf("%s: expected 3 statuses, got %d", name, len(statuses))
+		}
+		// certutil does not check revocation, so a revoked leaf is otherwise valid.
+		if statuses[0].Status != test.status {
+			t.Errorf("%s: expected %v, got %v: %s", name, test.status, statuses[0].Status, statuses[0].Raw)
+		}
+		for _, status := range statuses[1:] {
+			if !status.Valid {
+				t.Errorf("%s: expected the issuers to be valid, got %+v", name, status)
+			}
+		}
+		if !statuses[2].SelfSigned || statuses[2].Trust != certutil.TrustedRoot {
+			t.Errorf("%s: expected a trusted self signed root, got %+v", name, statuses[2])
+		}
+		if test.revoked && path.Status != certutil.StatusRevoked {
+			t.Errorf("%s: expected vfychain to find the leaf revoked, got %v", name, path.Status)
+		}
+		if test.status == certutil.StatusValid && !test.revoked && !path.Good {
+			t.Errorf("%s: expected vfychain to find the chain good, got %v", name, path.Status)
+		}
+	}
 }
@@ -0,0 +1,73 @@
+package goverify
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+)
+
+// Result is the verdict of Go's crypto/x509 for a chain, which serves as a
+// second opinion to NSS.
+type Result struct {
+	Valid  bool
+	Reason string
+	// IncompatibleUsage lists the fingerprints of the leaf and intermediates
+	// whose extended key usage does not permit the usage for which the chain
+	// was verified. An intermediate's extended key usage constrains every
+	// certificate beneath it, so a single one breaks the chain.
+	IncompatibleUsage []certutil.Fingerprint `json:",omitempty"`
+}
+
+// VerifyChain verifies the leaf of the chain for the given usage, using the
+// last certificate of the chain as the sole root and everything in between as
+// intermediates. The chain is verified at the given time, or now if the time is zero.
+func VerifyChain(chain []*x509.Certificate, usage certutil.Usage, at time.Time) (result Result) {
+	roots := x509.NewCertPool()
+	roots.AddCert(chain[len(chain)-1])
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	eku := usage.ExtKeyUsage()
+	for _, cert := range pathOf(chain) {
+		if !Permits(cert, eku) {
+			result.IncompatibleUsage = append(result.IncompatibleUsage, certutil.FingerprintOf(cert))
+		}
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{eku},
+	})
+	if err != nil {
+		result.Reason = err.Error()
+		return
+	}
+	result.Valid = true
+	return
+}
+
+// Permits reports whether the certificate's extended key usage allows the
+// given usage. A certificate without any extended key usage allows everything.
+func Permits(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return true
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == eku || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// pathOf is the leaf and intermediates, as the root's extended key usage is
+// superseded by the trust that the root store grants it.
+func pathOf(chain []*x509.Certificate) []*x509.Certificate {
+	if len(chain) == 1 {
+		return chain
+	}
+	return chain[:len(chain)-1]
+}
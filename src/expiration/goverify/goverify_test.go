@@ -0,0 +1,114 @@
+package goverify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+)
+
+func issue(t *testing.T, template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyChainAt(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	rootKey, leafKey := newKey(t), newKey(t)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := issue(t, rootTemplate, rootTemplate, rootKey, rootKey)
+	leaf := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:     []string{"leaf.example.com"},
+		NotBefore:    start,
+		NotAfter:     start.AddDate(1, 0, 0),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root, leafKey, rootKey)
+	chain := []*x509.Certificate{leaf, root}
+	if result := VerifyChain(chain, certutil.TLSServer, start.AddDate(0, 6, 0)); !result.Valid {
+		t.Errorf("expected the chain to be valid, got %s", result.Reason)
+	}
+	if result := VerifyChain(chain, certutil.TLSServer, start.AddDate(2, 0, 0)); result.Valid || result.Reason == "" {
+		t.Error("expected the chain to have expired")
+	}
+}
+
+func TestExtKeyUsageChaining(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	rootKey, intermediateKey, leafKey := newKey(t), newKey(t), newKey(t)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := issue(t, rootTemplate, rootTemplate, rootKey, rootKey)
+	// The intermediate may only issue for TLS, yet its leaf claims S/MIME as well.
+	intermediate := issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Intermediate"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(5, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, root, intermediateKey, rootKey)
+	leaf := issue(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(3),
+		Subject:        pkix.Name{CommonName: "someone@example.com"},
+		EmailAddresses: []string{"someone@example.com"},
+		NotBefore:      start,
+		NotAfter:       start.AddDate(1, 0, 0),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageClientAuth},
+	}, intermediate, leafKey, intermediateKey)
+	chain := []*x509.Certificate{leaf, intermediate, root}
+	at := start.AddDate(0, 6, 0)
+	if result := VerifyChain(chain, certutil.TLSClient, at); !result.Valid || len(result.IncompatibleUsage) != 0 {
+		t.Errorf("expected the chain to be valid for TLS clients, got %+v", result)
+	}
+	result := VerifyChain(chain, certutil.SMIME, at)
+	if result.Valid {
+		t.Error("expected the intermediate to prevent S/MIME")
+	}
+	if len(result.IncompatibleUsage) != 1 || result.IncompatibleUsage[0] != certutil.FingerprintOf(intermediate) {
+		t.Errorf("expected only the intermediate to be incompatible, got %v", result.IncompatibleUsage)
+	}
+	result = VerifyChain(chain, certutil.CodeSigning, at)
+	if result.Valid || len(result.IncompatibleUsage) != 2 {
+		t.Errorf("expected neither the leaf nor the intermediate to permit code signing, got %+v", result)
+	}
+}
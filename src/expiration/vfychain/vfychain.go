@@ -0,0 +1,207 @@
+package vfychain
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/pkg/errors"
+)
+
+// vfychain drives NSS's libpkix, via CERT_PKIXVerifyCert, over a whole chain
+// in the same way that Firefox does, including fetching revocation information.
+//
+//	-d directory      Database directory
+//	-pp               Use PKIX Library to validate certificate by calling CERT_PKIXVerifyCert
+//	-u usage          0=SSL client, 1=SSL server, 2=SSL StepUp, 3=SSL CA,
+//	                  4=Email signer, 5=Email recipient, 6=Object signer,
+//	                  9=ProtectedObjectSigner, 10=OCSP responder, 11=Any CA
+//	-b time           Validate the chain at the given time (YYMMDDHHMMZ)
+//	-g test type      Sets status checking test type. Possible values are "leaf" or "chain"
+//	-m method type    Sets method type for the test type it follows. Possible types are "crl" and "ocsp"
+//	-f                Enable cert fetching from AIA URL
+//	-v                Verbose mode. Prints root cert subject
+const (
+	DbDirectory = "-d"
+	PKIX        = "-pp"
+	Usage       = "-u"
+	Time        = "-b"
+	TestType    = "-g"
+	MethodType  = "-m"
+	AIAFetching = "-f"
+
+	TestLeaf   = "leaf"
+	TestChain  = "chain"
+	MethodCRL  = "crl"
+	MethodOCSP = "ocsp"
+
+	TimeLayout = "0601021504Z"
+)
+
+const (
+	UsageSSLClient      = "0"
+	UsageSSLServer      = "1"
+	UsageSSLCA          = "3"
+	UsageEmailSigner    = "4"
+	UsageEmailRecipient = "5"
+	UsageObjectSigner   = "6"
+	UsageAnyCA          = "11"
+)
+
+// UsageOf is the vfychain usage with which the leaf is validated for the given usage.
+func UsageOf(usage certutil.Usage) string {
+	switch usage {
+	case certutil.TLSClient:
+		return UsageSSLClient
+	case certutil.SMIME:
+		return UsageEmailSigner
+	case certutil.CodeSigning:
+		return UsageObjectSigner
+	}
+	return UsageSSLServer
+}
+
+// Revocation is the set of revocation checking methods that vfychain should exercise.
+type Revocation int
+
+const (
+	// OCSP checks the leaf against the responder within its AIA, which is what Firefox does.
+	OCSP Revocation = 1 << iota
+	// CRL checks every certificate in the chain against its distribution points.
+	CRL
+)
+
+const NoRevocation Revocation = 0
+
+type Options struct {
+	Usage      string
+	Revocation Revocation
+	// Time, when not zero, is the moment at which the chain is validated.
+	Time time.Time
+}
+
+func (o Options) args() []string {
+	usage := o.Usage
+	if usage == "" {
+		usage = UsageSSLServer
+	}
+	args := []string{PKIX, AIAFetching, Usage, usage}
+	if !o.Time.IsZero() {
+		args = append(args, Time, o.Time.UTC().Format(TimeLayout))
+	}
+	if o.Revocation&OCSP != 0 {
+		args = append(args, TestType, TestLeaf, MethodType, MethodOCSP)
+	}
+	if o.Revocation&CRL != 0 {
+		args = append(args, TestType, TestChain, MethodType, MethodCRL)
+	}
+	return args
+}
+
+type Result struct {
+	Good       bool
+	Status     certutil.Status
+	NSSError   string
+	ErrorCode  int
+	ExitCode   int
+	Revocation []string
+	Time       *time.Time
+	Raw        string
+	Error      error
+}
+
+var executable = "vfychain"
+
+// VerifyChain validates the chain against the NSS database found in dbDir. The
+// database is expected to already hold the trust anchor for the chain, so the
+// root ought to be excluded from the given chain unless it is the only certificate.
+func VerifyChain(dbDir string, chain []*x509.Certificate, opts Options) (result Result) {
+	if !opts.Time.IsZero() {
+		t := opts.Time
+		result.Time = &t
+	}
+	if opts.Revocation&OCSP != 0 {
+		result.Revocation = append(result.Revocation, MethodOCSP)
+	}
+	if opts.Revocation&CRL != 0 {
+		result.Revocation = append(result.Revocation, MethodCRL)
+	}
+	certDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		result.Error = errors.Wrap(err, "failed to create a directory for the chain")
+		return
+	}
+	defer os.RemoveAll(certDir)
+	args := append([]string{DbDirectory, dbDir}, opts.args()...)
+	for i, cert := range chain {
+		file := path.Join(certDir, fmt.Sprintf("%d.der", i))
+		if err := ioutil.WriteFile(file, cert.Raw, 0600); err != nil {
+			result.Error = errors.Wrapf(err, "failed to write %v", file)
+			return
+		}
+		args = append(args, file)
+	}
+	start := time.Now()
+	out, err := exec.Command(executable, args...).CombinedOutput()
+	certutil.ObserveInvocation(executable, "verify chain", start, err)
+	parsed := Parse(bytes.TrimSpace(out), err)
+	parsed.Time, parsed.Revocation = result.Time, result.Revocation
+	return parsed
+}
+
+const (
+	chainGood = "Chain is good!"
+	chainBad  = "Chain is bad!"
+)
+
+var errorLine = regexp.MustCompile(`ERROR (-?\d+): (.*)`)
+
+// Parse interprets the output of vfychain. A bad chain is reported as
+//
+//	Chain is bad!
+//	ERROR -8179: Peer's Certificate issuer is not recognized.
+func Parse(out []byte, err error) (result Result) {
+	result.Raw = string(out)
+	switch e := err.(type) {
+	case nil:
+	case *exec.ExitError:
+		result.ExitCode = e.ExitCode()
+	default:
+		result.ExitCode = -1
+		result.Status = certutil.StatusToolFailure
+		result.Error = errors.Wrap(err, "failed to execute vfychain")
+		return
+	}
+	switch {
+	case bytes.Contains(out, []byte(chainGood)):
+		result.Good = true
+		result.Status = certutil.StatusValid
+		return
+	case !bytes.Contains(out, []byte(chainBad)):
+		result.Status = certutil.StatusToolFailure
+		result.Error = errors.Errorf("vfychain exited with %d: %s", result.ExitCode, result.Raw)
+		return
+	}
+	match := errorLine.FindSubmatch(out)
+	if match == nil {
+		return
+	}
+	result.ErrorCode, _ = strconv.Atoi(string(match[1]))
+	nssError, ok := certutil.LookupCode(result.ErrorCode)
+	if !ok {
+		nssError, ok = certutil.LookupMessage(string(match[2]))
+	}
+	if ok {
+		result.Status = nssError.Status
+		result.NSSError = nssError.Name
+	}
+	return
+}
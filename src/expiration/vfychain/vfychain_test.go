@@ -0,0 +1,58 @@
+package vfychain
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+)
+
+func TestParse(t *testing.T) {
+	failed := exec.Command("sh", "-c", "exit 1").Run()
+	tests := []struct {
+		out       string
+		err       error
+		good      bool
+		status    certutil.Status
+		errorCode int
+	}{
+		{"Chain is good!", nil, true, certutil.StatusValid, 0},
+		{"Chain is bad!\nERROR -8179: Peer's Certificate issuer is not recognized.", failed, false, certutil.StatusIssuerUnknown, -8179},
+		{"Chain is bad!\nERROR -8180: Peer's Certificate has been revoked.", failed, false, certutil.StatusRevoked, -8180},
+		{"Chain is bad!\nERROR -9999: Peer's Certificate has expired.", failed, false, certutil.StatusExpired, -9999},
+		{"Chain is bad!\nERROR -9999: Something new.", failed, false, certutil.StatusUnrecognized, -9999},
+		{"vfychain: could not open database", failed, false, certutil.StatusToolFailure, 0},
+		{"", errors.New("not found"), false, certutil.StatusToolFailure, 0},
+	}
+	for _, test := range tests {
+		result := Parse([]byte(test.out), test.err)
+		if result.Good != test.good {
+			t.Errorf("%q: expected good to be %v", test.out, test.good)
+		}
+		if result.Status != test.status {
+			t.Errorf("%q: expected %v, got %v", test.out, test.status, result.Status)
+		}
+		if result.ErrorCode != test.errorCode {
+			t.Errorf("%q: expected error code %d, got %d", test.out, test.errorCode, result.ErrorCode)
+		}
+	}
+}
+
+func TestOptionsArgs(t *testing.T) {
+	opts := Options{
+		Revocation: OCSP | CRL,
+		Time:       time.Date(2018, 12, 25, 13, 30, 0, 0, time.UTC),
+	}
+	expected := []string{
+		PKIX, AIAFetching, Usage, UsageSSLServer,
+		Time, "1812251330Z",
+		TestType, TestLeaf, MethodType, MethodOCSP,
+		TestType, TestChain, MethodType, MethodCRL,
+	}
+	if args := opts.args(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
@@ -2,7 +2,9 @@ module github.com/christopher-henderson/CACop
 
 require (
 	github.com/mozilla/OneCRL-Tools v0.0.0-20181214195002-1791e18a01a2
-	github.com/pkg/errors v0.8.0
-	github.com/sirupsen/logrus v1.2.0
-	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.12.2
+	github.com/sirupsen/logrus v1.6.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
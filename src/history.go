@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/christopher-henderson/CACop/diff"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/store"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var results *store.Store
+
+// save records the result in the result store, if one is configured.
+func save(result model.TestWebsiteResult) {
+	if results == nil {
+		return
+	}
+	if _, err := results.Save(result, time.Now()); err != nil {
+		logging.Logger.WithError(err).WithField(logging.Field, result.CorrelationID).Error("failed to save result")
+	}
+}
+
+// history lists the past runs for either a subject or a root.
+//
+//	GET /history?subject=https://example.com
+//	GET /history?root={SHA256 fingerprint}
+func history(resp http.ResponseWriter, req *http.Request) {
+	var summaries []store.Summary
+	var err error
+	query := req.URL.Query()
+	switch {
+	case query.Get("subject") != "":
+		summaries, err = results.BySubject(query.Get("subject"))
+	case query.Get("root") != "":
+		summaries, err = results.ByRoot(query.Get("root"))
+	default:
+		resp.WriteHeader(400)
+		resp.Write([]byte("either the 'subject' or the 'root' query parameter is required\n"))
+		return
+	}
+	if err != nil {
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+		return
+	}
+	encode(resp, summaries)
+}
+
+// run fetches a single past run.
+//
+//	GET /run?id=42
+func run(resp http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("'id' query parameter must be the numeric id of a run\n"))
+		return
+	}
+	record, err := results.Get(id)
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		resp.WriteHeader(404)
+		fmt.Fprintf(resp, "no run with id %d\n", id)
+		return
+	default:
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+		return
+	}
+	encode(resp, record)
+}
+
+// compare reports what changed between two runs.
+//
+//	GET /diff?from=41&to=42
+//	GET /diff?subject=https://example.com
+//
+// When given a subject, the two most recent runs for that subject are compared.
+func compare(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var from, to uint64
+	if query.Get("subject") == "" {
+		var err error
+		if from, err = strconv.ParseUint(query.Get("from"), 10, 64); err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("either the 'subject' query parameter or the numeric 'from' and 'to' query parameters are required\n"))
+			return
+		}
+		if to, err = strconv.ParseUint(query.Get("to"), 10, 64); err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("either the 'subject' query parameter or the numeric 'from' and 'to' query parameters are required\n"))
+			return
+		}
+	}
+	d, err := diffRuns(from, to, query.Get("subject"))
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		resp.WriteHeader(404)
+		resp.Write([]byte(err.Error() + "\n"))
+		return
+	default:
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+		return
+	}
+	encode(resp, d)
+}
+
+// diffRuns compares the runs with the given ids or, if a subject is given,
+// the two most recent runs of that subject.
+func diffRuns(from, to uint64, subject string) (diff.Diff, error) {
+	if subject != "" {
+		summaries, err := results.BySubject(subject)
+		if err != nil {
+			return diff.Diff{}, err
+		}
+		if len(summaries) < 2 {
+			return diff.Diff{}, store.ErrNotFound
+		}
+		from, to = summaries[1].ID, summaries[0].ID
+	}
+	before, err := results.Get(from)
+	if err != nil {
+		return diff.Diff{}, err
+	}
+	after, err := results.Get(to)
+	if err != nil {
+		return diff.Diff{}, err
+	}
+	return diff.Compare(before.Result, after.Result)
+}
+
+func encode(resp http.ResponseWriter, v interface{}) {
+	encoder := json.NewEncoder(resp)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(v); err != nil {
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+	}
+}
@@ -0,0 +1,102 @@
+package hostname
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RFC 6125
+//
+// 6.4.4.  Checking of Common Names
+//
+// As noted, a client MUST NOT seek a match for a reference identifier
+// of CN-ID if the presented identifiers include a DNS-ID, SRV-ID,
+// URI-ID, or any application-specific identifier types supported by the
+// client.
+//
+// Therefore, if and only if the presented identifiers do not include a
+// DNS-ID, SRV-ID, URI-ID, or any application-specific identifier types
+// supported by the client, then the client MAY as a last resort check
+// for a string whose form matches that of a fully qualified DNS domain
+// name in a Common Name field of the subject field (i.e., a CN-ID).
+//
+// Browsers no longer fall back to the common name at all, so a match that
+// relies upon it is reported as deprecated.
+
+// Result is whether the leaf is for the host from which it was gathered.
+type Result struct {
+	Host    string
+	Matched bool
+	// Name is the SAN, or common name, that matched the host.
+	Name string `json:",omitempty"`
+	// CommonNameFallback is set when the leaf has no SAN and the host matched
+	// its common name, which browsers no longer accept.
+	CommonNameFallback bool
+	Reason             string `json:",omitempty"`
+}
+
+// Verify matches the host against the leaf's subject alternative names. IP
+// addresses match only IP SANs, whereas DNS names match DNS SANs, wildcards
+// included, or the common name if the leaf has no SANs whatsoever.
+func Verify(leaf *x509.Certificate, host string) (result Result) {
+	result.Host = host
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		for _, san := range leaf.IPAddresses {
+			if san.Equal(ip) {
+				result.Matched = true
+				result.Name = san.String()
+				return
+			}
+		}
+		result.Reason = fmt.Sprintf("%s is not among the IP addresses of the leaf", host)
+		return
+	}
+	for _, san := range leaf.DNSNames {
+		if Matches(san, host) {
+			result.Matched = true
+			result.Name = san
+			return
+		}
+	}
+	if len(leaf.DNSNames) == 0 && len(leaf.IPAddresses) == 0 {
+		if cn := leaf.Subject.CommonName; cn != "" && Matches(cn, host) {
+			result.Matched = true
+			result.Name = cn
+			result.CommonNameFallback = true
+			return
+		}
+		result.Reason = fmt.Sprintf("the leaf has no subject alternative names and its common name does not match %s", host)
+		return
+	}
+	result.Reason = fmt.Sprintf("%s is not among the DNS names of the leaf", host)
+	return
+}
+
+// Matches reports whether the presented name, which may be a wildcard, is
+// for the host as per RFC 6125 section 6.4.3. Only a wildcard that is the
+// whole of the leftmost label is honoured, as browsers do, and it matches
+// exactly one label. Wildcards directly beneath a single label, such as
+// *.com, match nothing.
+func Matches(name, host string) bool {
+	name = normalize(name)
+	host = normalize(host)
+	if name == "" || host == "" {
+		return false
+	}
+	if !strings.HasPrefix(name, "*.") {
+		return !strings.Contains(name, "*") && name == host
+	}
+	suffix := name[1:]
+	if strings.Contains(suffix, "*") || strings.Count(suffix, ".") < 2 {
+		return false
+	}
+	label := strings.TrimSuffix(host, suffix)
+	return label != host && label != "" && !strings.Contains(label, ".")
+}
+
+// normalize lowercases the name and drops the trailing dot of an absolute name.
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
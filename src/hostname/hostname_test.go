@@ -0,0 +1,77 @@
+package hostname
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		matches bool
+	}{
+		{"www.example.com", "www.example.com", true},
+		{"WWW.Example.COM", "www.example.com", true},
+		{"www.example.com.", "www.example.com", true},
+		{"www.example.com", "example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.www.example.com", false},
+		{"*.example.com", "wwwexample.com", false},
+		{"*.com", "example.com", false},
+		{"w*.example.com", "www.example.com", false},
+		{"www.*.com", "www.example.com", false},
+		{"*.*.example.com", "a.b.example.com", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if matches := Matches(test.name, test.host); matches != test.matches {
+			t.Errorf("%q against %q: expected %v, got %v", test.name, test.host, test.matches, matches)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	leaf := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "cn.example.com"},
+		DNSNames:    []string{"valid.example.com", "*.test.example.com"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	tests := []struct {
+		host    string
+		matched bool
+		name    string
+	}{
+		{"valid.example.com", true, "valid.example.com"},
+		{"a.test.example.com", true, "*.test.example.com"},
+		{"127.0.0.1", true, "127.0.0.1"},
+		{"::1", true, "::1"},
+		{"[::1]", true, "::1"},
+		{"127.0.0.2", false, ""},
+		// The common name is ignored once there are SANs.
+		{"cn.example.com", false, ""},
+	}
+	for _, test := range tests {
+		result := Verify(leaf, test.host)
+		if result.Matched != test.matched || result.Name != test.name || result.CommonNameFallback {
+			t.Errorf("%s: unexpected result %+v", test.host, result)
+		}
+		if !result.Matched && result.Reason == "" {
+			t.Errorf("%s: expected a reason for the mismatch", test.host)
+		}
+	}
+}
+
+func TestCommonNameFallback(t *testing.T) {
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "legacy.example.com"}}
+	result := Verify(leaf, "legacy.example.com")
+	if !result.Matched || !result.CommonNameFallback {
+		t.Errorf("expected a deprecated match on the common name, got %+v", result)
+	}
+	if result := Verify(leaf, "127.0.0.1"); result.Matched {
+		t.Errorf("expected an IP address never to match the common name, got %+v", result)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/christopher-henderson/CACop/metrics"
+	"github.com/christopher-henderson/CACop/model"
+	"time"
+)
+
+var (
+	verifications = metrics.NewCounterVec("cacop_verifications_total",
+		"Chains verified, by verdict.",
+		"verdict")
+	verificationDuration = metrics.NewHistogramVec("cacop_verification_duration_seconds",
+		"Time taken to run every verifier over a chain.",
+		metrics.DurationBuckets)
+	inFlight = metrics.NewGaugeVec("cacop_verifications_in_flight",
+		"Chains that are currently being verified.")
+	gathers = metrics.NewCounterVec("cacop_chain_gathers_total",
+		"Certificate chains retrieved from subjects, by result.",
+		"result")
+	gatherDuration = metrics.NewHistogramVec("cacop_chain_gather_duration_seconds",
+		"Time taken to retrieve the certificate chain from a subject.",
+		metrics.DurationBuckets)
+)
+
+// observeVerification is deferred by VerifyChain, having incremented the in flight gauge.
+func observeVerification(start time.Time, result *model.ChainResult) {
+	inFlight.With().Dec()
+	verificationDuration.With().ObserveSince(start)
+	verifications.With(string(model.TestWebsiteResult{Chain: *result}.Verdict())).Inc()
+}
+
+func observeGather(start time.Time, err error) {
+	gatherDuration.With().ObserveSince(start)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	gathers.With(result).Inc()
+}
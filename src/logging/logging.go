@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger writes one JSON object per line to stderr.
+var Logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano},
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.InfoLevel,
+}
+
+const (
+	// Header carries the correlation ID of a request. A client may supply its
+	// own, otherwise one is generated, and it is always echoed in the response.
+	Header = "X-Correlation-ID"
+	// Field is the name under which the correlation ID appears in every log line.
+	Field = "correlation_id"
+)
+
+type key struct{}
+
+// NewID returns a random correlation ID.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithID returns a context carrying the given correlation ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// NewContext returns a background context carrying a new correlation ID, for
+// work that does not originate from an HTTP request.
+func NewContext() context.Context {
+	return WithID(context.Background(), NewID())
+}
+
+// ID is the correlation ID carried by the context, if any.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// FromContext returns a log entry that is tagged with the context's correlation ID.
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(Logger)
+	if id := ID(ctx); id != "" {
+		entry = entry.WithField(Field, id)
+	}
+	return entry
+}
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Middleware tags every request with a correlation ID and logs its outcome.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(Header)
+		if !validID.MatchString(id) {
+			id = NewID()
+		}
+		resp.Header().Set(Header, id)
+		ctx := WithID(req.Context(), id)
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		start := time.Now()
+		log := FromContext(ctx).WithFields(logrus.Fields{
+			"method": req.Method,
+			"path":   req.URL.Path,
+			"query":  req.URL.RawQuery,
+			"remote": req.RemoteAddr,
+		})
+		log.Info("request received")
+		next.ServeHTTP(recorder, req.WithContext(ctx))
+		log.WithFields(logrus.Fields{
+			"status":   recorder.status,
+			"duration": time.Since(start).Seconds(),
+		}).Info("request completed")
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
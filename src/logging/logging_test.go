@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func capture(t *testing.T) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	out := Logger.Out
+	Logger.Out = &buf
+	return &buf, func() { Logger.Out = out }
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestMiddleware(t *testing.T) {
+	buf, restore := capture(t)
+	defer restore()
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		seen = ID(req.Context())
+		FromContext(req.Context()).Warn("inside")
+		resp.WriteHeader(http.StatusTeapot)
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/?subject=x", nil))
+	id := recorder.Header().Get(Header)
+	if id == "" || id != seen {
+		t.Fatalf("expected the echoed ID %q to be the one in the context %q", id, seen)
+	}
+	entries := lines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 log lines, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry[Field] != id {
+			t.Errorf("log line without the correlation ID: %v", entry)
+		}
+	}
+	if entries[1]["level"] != "warning" || entries[1]["msg"] != "inside" {
+		t.Errorf("unexpected log line %v", entries[1])
+	}
+	if entries[2]["status"] != float64(http.StatusTeapot) {
+		t.Errorf("expected the status to be logged, got %v", entries[2])
+	}
+}
+
+func TestMiddlewareKeepsClientID(t *testing.T) {
+	_, restore := capture(t)
+	defer restore()
+	handler := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for id, kept := range map[string]bool{
+		"complaint-42":  true,
+		"bad id\nfield": false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(Header, id)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if got := recorder.Header().Get(Header); (got == id) != kept {
+			t.Errorf("for client supplied %q got %q", id, got)
+		}
+	}
+}
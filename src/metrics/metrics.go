@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Every metric is registered with the default Prometheus registry, so that
+// the Go runtime and process metrics are exposed alongside them.
+
+// Handler exposes every registered metric.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Host is the host of the given URL, for labelling metrics by endpoint
+// without creating a series per path.
+func Host(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{promauto.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+}
+
+// With is the counter of the given label values, which must be as many as
+// the labels of the family.
+func (c *CounterVec) With(values ...string) prometheus.Counter {
+	return c.vec.WithLabelValues(values...)
+}
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec struct {
+	vec *prometheus.GaugeVec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{promauto.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)}
+}
+
+func (g *GaugeVec) With(values ...string) prometheus.Gauge {
+	return g.vec.WithLabelValues(values...)
+}
+
+var (
+	// DurationBuckets are upper bounds, in seconds, suited to network requests
+	// and invocations of the NSS tools.
+	DurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	// SizeBuckets are upper bounds, in bytes, suited to CRLs.
+	SizeBuckets = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogramVec creates a histogram with the given, ascending, bucket upper bounds.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{promauto.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)}
+}
+
+func (h *HistogramVec) With(values ...string) Histogram {
+	return Histogram{h.vec.WithLabelValues(values...)}
+}
+
+type Histogram struct {
+	prometheus.Observer
+}
+
+// ObserveSince observes the number of seconds elapsed since the given time.
+func (h Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	testCounter   = NewCounterVec("test_requests_total", "Requests by host.", "host", "result")
+	testGauge     = NewGaugeVec("test_in_flight", "Requests in flight.")
+	testHistogram = NewHistogramVec("test_duration_seconds", "Request durations.", []float64{0.1, 1}, "host")
+)
+
+func scrape(t *testing.T) string {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("unexpected content type %q", got)
+	}
+	body, err := ioutil.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestExposition(t *testing.T) {
+	testCounter.With("ocsp.example.com", "good").Inc()
+	testCounter.With("ocsp.example.com", "good").Add(2)
+	testCounter.With(`quote"d`, "error").Inc()
+	testGauge.With().Inc()
+	testGauge.With().Inc()
+	testGauge.With().Dec()
+	h := testHistogram.With("crl.example.com")
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	body := scrape(t)
+	for _, want := range []string{
+		"# HELP test_requests_total Requests by host.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{host="ocsp.example.com",result="good"} 3` + "\n",
+		`test_requests_total{host="quote\"d",result="error"} 1` + "\n",
+		"# TYPE test_in_flight gauge\ntest_in_flight 1\n",
+		`test_duration_seconds_bucket{host="crl.example.com",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{host="crl.example.com",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{host="crl.example.com",le="+Inf"} 3` + "\n",
+		`test_duration_seconds_sum{host="crl.example.com"} 5.55` + "\n",
+		`test_duration_seconds_count{host="crl.example.com"} 3` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q within\n%s", want, body)
+		}
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a missing label value")
+		}
+	}()
+	testCounter.With("ocsp.example.com")
+}
+
+func TestHost(t *testing.T) {
+	for url, want := range map[string]string{
+		"http://ocsp.example.com/":          "ocsp.example.com",
+		"http://crl.example.com:8080/a.crl": "crl.example.com:8080",
+		"not a url":                         "unknown",
+	} {
+		if got := Host(url); got != want {
+			t.Errorf("Host(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
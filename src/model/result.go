@@ -2,24 +2,93 @@ package model
 
 import (
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"github.com/christopher-henderson/CACop/constraints"
+	"github.com/christopher-henderson/CACop/ct"
+	"github.com/christopher-henderson/CACop/ev"
 	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/expiration/goverify"
+	"github.com/christopher-henderson/CACop/expiration/vfychain"
+	"github.com/christopher-henderson/CACop/hostname"
 	"github.com/christopher-henderson/CACop/revocation/crl"
 	"github.com/christopher-henderson/CACop/revocation/ocsp"
+	"github.com/christopher-henderson/CACop/truststore"
+	"time"
 )
 
+// Uploaded is the subject of a result whose chain was sent by the CA rather
+// than gathered from a test website.
+const Uploaded = "uploaded"
+
 type TestWebsiteResult struct {
 	SubjectURL string
-	Chain      ChainResult
-	Error      error
+	Handshake  Handshake
+	// Staple is the OCSP response stapled to the handshake, if there was one.
+	Staple *ocsp.Staple `json:",omitempty"`
+	// Hostname is whether the leaf is for the subject's host. It is absent
+	// for uploaded chains, which have no host.
+	Hostname *hostname.Result `json:",omitempty"`
+	Chain    ChainResult
+	Error    error
+	// CorrelationID tags every log line written while producing this result.
+	CorrelationID string `json:",omitempty"`
+}
+
+// Handshake describes the TLS connection over which the chain was gathered,
+// whether that was https or a protocol upgraded via STARTTLS.
+type Handshake struct {
+	Version     string
+	CipherSuite string
+	// ServerName is the SNI sent, which is absent when the subject is an IP address.
+	ServerName         string
+	NegotiatedProtocol string `json:",omitempty"`
+}
+
+func NewHandshake(state tls.ConnectionState) Handshake {
+	return Handshake{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+	}
+}
+
+// MustStapleViolated reports whether the leaf requires a stapled OCSP response
+// that was not given during the handshake, in which case Firefox refuses the
+// connection. A result without a handshake, such as that of an uploaded
+// chain, cannot violate it.
+func (r TestWebsiteResult) MustStapleViolated() bool {
+	return r.Chain.Leaf.MustStaple && r.Handshake.Version != "" && !r.Staple.Valid()
+}
+
+// HostnameMismatched reports whether the leaf is not for the host from which
+// it was gathered.
+func (r TestWebsiteResult) HostnameMismatched() bool {
+	return r.Hostname != nil && !r.Hostname.Matched
 }
 
 type ChainResult struct {
-	Leaf          CertificateResult
-	Intermediates []CertificateResult
-	Root          CertificateResult
-	BrokenEdges   [][2]Fingerprint
+	Leaf             CertificateResult
+	Intermediates    []CertificateResult
+	Root             CertificateResult
+	BrokenEdges      [][2]Fingerprint
+	Inclusion        truststore.Entry
+	PathValidation   vfychain.Result
+	GoValidation     goverify.Result
+	VerificationTime time.Time
+	// Usage is the purpose for which the chain was verified.
+	Usage certutil.Usage
+	// Constraints are the names and policies that the leaf is held to by
+	// the CAs above it. Violations are among the Findings of each certificate.
+	Constraints constraints.Result
+	// EV is whether the chain would receive EV treatment in Firefox.
+	EV ev.Result
+	// Precertificate is how the leaf compares with the precertificate that
+	// was supplied for it, if any.
+	Precertificate *ct.Comparison `json:",omitempty"`
 }
 
 type CertificateResult struct {
@@ -29,6 +98,18 @@ type CertificateResult struct {
 	OCSP              []ocsp.OCSP
 	CRL               []crl.CRL
 	Expiration        expiration.ExpirationStatus
+	// MustStaple is set when the certificate's TLS Feature extension requires
+	// a stapled OCSP response.
+	MustStaple bool
+	// RevocationDeterminable is set when at least one OCSP response or CRL
+	// gives the status of the certificate. Mozilla requires that the status
+	// of every intermediate be determinable, usually from its parent's CRL.
+	// It is nil for the root, which is trusted rather than checked.
+	RevocationDeterminable *bool `json:",omitempty"`
+	// Findings are what is wrong with the certificate in the context of its
+	// chain, such as the constraints that it violates, an EV policy that it
+	// lacks, or that it is a precertificate.
+	Findings []string `json:",omitempty"`
 }
 
 func NewCeritifcateResult(certificate *x509.Certificate, ocspResonse []ocsp.OCSP, crlStatus []crl.CRL, expirationStatus expiration.ExpirationStatus) CertificateResult {
@@ -39,7 +120,21 @@ func NewCeritifcateResult(certificate *x509.Certificate, ocspResonse []ocsp.OCSP
 		ocspResonse,
 		crlStatus,
 		expirationStatus,
+		ocsp.MustStaple(certificate),
+		revocationDeterminable(ocspResonse, crlStatus),
+		nil,
+	}
+}
+
+func revocationDeterminable(ocsps []ocsp.OCSP, crls []crl.CRL) *bool {
+	determinable := false
+	for _, o := range ocsps {
+		determinable = determinable || o.Determines()
+	}
+	for _, c := range crls {
+		determinable = determinable || c.Determines()
 	}
+	return &determinable
 }
 
 type Fingerprint = string
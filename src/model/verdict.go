@@ -0,0 +1,51 @@
+package model
+
+import "fmt"
+
+// Verdict is the overall outcome of a test website. Mozilla expects every CA
+// to host three test websites whose leaves are valid, expired and revoked.
+type Verdict string
+
+const (
+	Valid   Verdict = "valid"
+	Expired Verdict = "expired"
+	Revoked Verdict = "revoked"
+	// Invalid is any other failure, such as an unknown issuer.
+	Invalid Verdict = "invalid"
+)
+
+func ParseVerdict(v string) (Verdict, error) {
+	switch verdict := Verdict(v); verdict {
+	case Valid, Expired, Revoked, Invalid:
+		return verdict, nil
+	}
+	return "", fmt.Errorf("unknown verdict %q, expected one of valid, expired, revoked or invalid", v)
+}
+
+// Verdict judges the website by its leaf. certutil does not check revocation,
+// so a leaf reported as revoked by any OCSP responder or CRL is revoked
+// regardless of what certutil had to say about it. Nor does it know of the
+// handshake, so a leaf that would otherwise be valid is invalid if it
+// demands a staple that was not given, or is not for the subject's host.
+func (r TestWebsiteResult) Verdict() Verdict {
+	leaf := r.Chain.Leaf
+	for _, response := range leaf.OCSP {
+		if response.Revoked {
+			return Revoked
+		}
+	}
+	for _, crl := range leaf.CRL {
+		if crl.Revoked {
+			return Revoked
+		}
+	}
+	switch {
+	case leaf.Expiration.Expired:
+		return Expired
+	case leaf.Expiration.Valid && (r.MustStapleViolated() || r.HostnameMismatched()):
+		return Invalid
+	case leaf.Expiration.Valid:
+		return Valid
+	}
+	return Invalid
+}
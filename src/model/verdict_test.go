@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/hostname"
+	"github.com/christopher-henderson/CACop/revocation/crl"
+	"github.com/christopher-henderson/CACop/revocation/ocsp"
+)
+
+func TestVerdict(t *testing.T) {
+	valid := expiration.ExpirationStatus{Valid: true}
+	expired := expiration.ExpirationStatus{Expired: true}
+	tests := []struct {
+		leaf    CertificateResult
+		verdict Verdict
+	}{
+		{CertificateResult{Expiration: valid}, Valid},
+		{CertificateResult{Expiration: expired}, Expired},
+		{CertificateResult{Expiration: valid, OCSP: []ocsp.OCSP{{Revoked: true}}}, Revoked},
+		{CertificateResult{Expiration: valid, CRL: []crl.CRL{{}, {Revoked: true}}}, Revoked},
+		{CertificateResult{Expiration: expiration.ExpirationStatus{IssuerUnknown: true}}, Invalid},
+	}
+	for i, test := range tests {
+		result := TestWebsiteResult{}
+		result.Chain.Leaf = test.leaf
+		if verdict := result.Verdict(); verdict != test.verdict {
+			t.Errorf("%d: expected %v, got %v", i, test.verdict, verdict)
+		}
+	}
+}
+
+func TestMustStaple(t *testing.T) {
+	handshake := Handshake{Version: "TLS 1.3"}
+	stapled := &ocsp.Staple{OCSP: ocsp.OCSP{Good: true, Fresh: true}}
+	stale := &ocsp.Staple{OCSP: ocsp.OCSP{Good: true}}
+	tests := []struct {
+		handshake Handshake
+		staple    *ocsp.Staple
+		verdict   Verdict
+	}{
+		{handshake, stapled, Valid},
+		{handshake, nil, Invalid},
+		{handshake, stale, Invalid},
+		// Uploaded chains have no handshake to judge.
+		{Handshake{}, nil, Valid},
+	}
+	for i, test := range tests {
+		result := TestWebsiteResult{Handshake: test.handshake, Staple: test.staple}
+		result.Chain.Leaf = CertificateResult{Expiration: expiration.ExpirationStatus{Valid: true}, MustStaple: true}
+		if verdict := result.Verdict(); verdict != test.verdict {
+			t.Errorf("%d: expected %v, got %v", i, test.verdict, verdict)
+		}
+	}
+}
+
+func TestHostnameMismatched(t *testing.T) {
+	for _, test := range []struct {
+		hostname *hostname.Result
+		verdict  Verdict
+	}{
+		{&hostname.Result{Host: "valid.example.com", Matched: true}, Valid},
+		{&hostname.Result{Host: "valid.example.com"}, Invalid},
+		{nil, Valid},
+	} {
+		result := TestWebsiteResult{Hostname: test.hostname}
+		result.Chain.Leaf = CertificateResult{Expiration: expiration.ExpirationStatus{Valid: true}}
+		if verdict := result.Verdict(); verdict != test.verdict {
+			t.Errorf("%+v: expected %v, got %v", test.hostname, test.verdict, verdict)
+		}
+	}
+}
+
+func TestParseVerdict(t *testing.T) {
+	if v, err := ParseVerdict("revoked"); err != nil || v != Revoked {
+		t.Errorf("expected %v, got %v %v", Revoked, v, err)
+	}
+	if _, err := ParseVerdict("fine"); err == nil {
+		t.Error("expected an error for an unknown verdict")
+	}
+}
@@ -0,0 +1,337 @@
+package monitor
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/christopher-henderson/CACop/diff"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/notify"
+	"github.com/christopher-henderson/CACop/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Check runs the verification pipeline for the subject against the given root,
+// with the options that the subject was registered with.
+type Check func(subject string, root *x509.Certificate, opts Options) (model.TestWebsiteResult, error)
+
+// Options are how a registration is verified on every run. There is no
+// verification time, as a monitored subject is always verified as of now.
+type Options struct {
+	Usage certutil.Usage `json:",omitempty"`
+}
+
+// Registration is a test website that is periodically verified along with
+// the outcome that the CA claims it to have.
+type Registration struct {
+	Subject  string
+	Root     []byte
+	Expected model.Verdict
+	Options  Options
+
+	LastChecked time.Time
+	LastRun     uint64
+	Verdict     model.Verdict
+	Regressed   bool
+	Error       string
+}
+
+func (r Registration) root() (*x509.Certificate, error) {
+	if len(r.Root) == 0 {
+		return nil, nil
+	}
+	return x509.ParseCertificate(r.Root)
+}
+
+type Monitor struct {
+	lock          sync.Mutex
+	registrations map[string]*Registration
+	stops         map[string]chan struct{}
+	store         *store.Store
+	check         Check
+	notifier      notify.Notifier
+	interval      time.Duration
+	jitter        time.Duration
+	started       bool
+}
+
+// New returns a monitor that verifies each registration once per interval,
+// plus a random delay of up to jitter so that runs do not all coincide.
+// Registrations that were previously kept in the store are restored.
+// The notifier, which may be nil, is told of every regression.
+func New(s *store.Store, check Check, notifier notify.Notifier, interval, jitter time.Duration) (*Monitor, error) {
+	m := &Monitor{
+		registrations: make(map[string]*Registration),
+		stops:         make(map[string]chan struct{}),
+		store:         s,
+		check:         check,
+		notifier:      notifier,
+		interval:      interval,
+		jitter:        jitter,
+	}
+	raws, err := s.Registrations()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to restore monitor registrations")
+	}
+	for _, raw := range raws {
+		var r Registration
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, errors.Wrap(err, "failed to decode monitor registration")
+		}
+		m.registrations[r.Subject] = &r
+	}
+	return m, nil
+}
+
+// Register begins monitoring the subject, replacing any existing registration for it.
+func (m *Monitor) Register(subject string, root *x509.Certificate, expected model.Verdict, opts Options) (Registration, error) {
+	r := &Registration{Subject: subject, Expected: expected, Options: opts}
+	if root != nil {
+		r.Root = root.Raw
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.persist(r); err != nil {
+		return *r, err
+	}
+	m.stop(subject)
+	m.registrations[subject] = r
+	if m.started {
+		m.schedule(subject, true)
+	}
+	return *r, nil
+}
+
+func (m *Monitor) Unregister(subject string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.registrations[subject]; !ok {
+		return fmt.Errorf("%s is not monitored", subject)
+	}
+	m.stop(subject)
+	delete(m.registrations, subject)
+	return m.store.DeleteRegistration(subject)
+}
+
+// Registrations lists every registration, ordered by subject.
+func (m *Monitor) Registrations() []Registration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	registrations := make([]Registration, 0, len(m.registrations))
+	for _, r := range m.registrations {
+		registrations = append(registrations, *r)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Subject < registrations[j].Subject
+	})
+	return registrations
+}
+
+// Start schedules every registration.
+func (m *Monitor) Start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = true
+	for subject := range m.registrations {
+		m.schedule(subject, false)
+	}
+}
+
+// Stop cancels every scheduled run. Runs already in flight are allowed to finish.
+func (m *Monitor) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = false
+	for subject := range m.stops {
+		m.stop(subject)
+	}
+}
+
+// schedule must be called with the lock held. A new registration is run
+// immediately rather than waiting out the first interval.
+func (m *Monitor) schedule(subject string, immediately bool) {
+	stop := make(chan struct{})
+	m.stops[subject] = stop
+	go func() {
+		if immediately {
+			m.Run(subject)
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(m.delay()):
+				m.Run(subject)
+			}
+		}
+	}()
+}
+
+// stop must be called with the lock held.
+func (m *Monitor) stop(subject string) {
+	if stop, ok := m.stops[subject]; ok {
+		close(stop)
+		delete(m.stops, subject)
+	}
+}
+
+func (m *Monitor) delay() time.Duration {
+	if m.jitter <= 0 {
+		return m.interval
+	}
+	return m.interval + time.Duration(rand.Int63n(int64(m.jitter)))
+}
+
+// Run verifies the subject immediately, stores the result and records whether
+// the verdict deviates from what was expected.
+func (m *Monitor) Run(subject string) (Registration, error) {
+	m.lock.Lock()
+	registered, ok := m.registrations[subject]
+	if !ok {
+		m.lock.Unlock()
+		return Registration{}, fmt.Errorf("%s is not monitored", subject)
+	}
+	r := *registered
+	m.lock.Unlock()
+
+	previous := r
+	result, err := m.verify(r)
+	r.LastChecked = time.Now()
+	switch err {
+	case nil:
+		r.Error = ""
+		r.Verdict = result.Verdict()
+		r.Regressed = r.Verdict != r.Expected
+		record, err := m.store.Save(result, r.LastChecked)
+		if err != nil {
+			logging.Logger.WithError(err).WithFields(logrus.Fields{
+				"subject":     subject,
+				logging.Field: result.CorrelationID,
+			}).Error("failed to save monitored run")
+		}
+		r.LastRun = record.ID
+	default:
+		// A test website that cannot be reached is as broken as one with the wrong verdict.
+		r.Error = err.Error()
+		r.Verdict = ""
+		r.Regressed = true
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.registrations[subject] != registered {
+		// Unregistered or replaced while the run was in flight, so the result
+		// is for a registration that no longer exists.
+		return r, nil
+	}
+	m.registrations[subject] = &r
+	if m.notifier != nil {
+		go m.deliver(m.events(previous, r))
+	}
+	return r, m.persist(&r)
+}
+
+// events reports whether the verdict changed since the previous run, and
+// whether an OCSP responder or CRL distribution point started failing.
+func (m *Monitor) events(previous, current Registration) []notify.Event {
+	var events []notify.Event
+	event := notify.Event{
+		Subject:     current.Subject,
+		Time:        current.LastChecked,
+		Expected:    current.Expected,
+		Previous:    previous.Verdict,
+		Current:     current.Verdict,
+		Regressed:   current.Regressed,
+		Error:       current.Error,
+		PreviousRun: previous.LastRun,
+		Run:         current.LastRun,
+	}
+	if current.Error == "" && previous.LastRun != 0 && current.LastRun != 0 {
+		d, err := m.diff(previous.LastRun, current.LastRun)
+		if err != nil {
+			logging.Logger.WithError(err).WithField("subject", current.Subject).Error("failed to compare monitored runs")
+		} else {
+			event.Diff = &d
+		}
+	}
+	changed := previous.Verdict != current.Verdict || previous.Regressed != current.Regressed || previous.Error != current.Error
+	if previous.LastChecked.IsZero() {
+		// The first run has nothing to change from, so only a regression is news.
+		changed = current.Regressed
+	}
+	if changed {
+		e := event
+		e.Kind = notify.VerdictChanged
+		events = append(events, e)
+	}
+	if event.Diff != nil {
+		var failing []diff.Transition
+		for _, t := range append(event.Diff.OCSP, event.Diff.CRL...) {
+			if t.To == "error" {
+				failing = append(failing, t)
+			}
+		}
+		if len(failing) != 0 {
+			e := event
+			e.Kind = notify.EndpointFailing
+			e.Failing = failing
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// deliver is run in its own goroutine as notifiers may retry for some time.
+func (m *Monitor) deliver(events []notify.Event) {
+	for _, e := range events {
+		if err := m.notifier.Notify(e); err != nil {
+			logging.Logger.WithError(err).WithFields(logrus.Fields{
+				"subject": e.Subject,
+				"kind":    e.Kind,
+			}).Error("failed to deliver notification")
+		}
+	}
+}
+
+func (m *Monitor) diff(from, to uint64) (diff.Diff, error) {
+	before, err := m.store.Get(from)
+	if err != nil {
+		return diff.Diff{}, errors.Wrapf(err, "failed to retrieve run %d", from)
+	}
+	after, err := m.store.Get(to)
+	if err != nil {
+		return diff.Diff{}, errors.Wrapf(err, "failed to retrieve run %d", to)
+	}
+	return diff.Compare(before.Result, after.Result)
+}
+
+// verify runs the check, converting any panic within the pipeline into an
+// error so that a single bad website cannot bring down the server.
+func (m *Monitor) verify(r Registration) (result model.TestWebsiteResult, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("verification of %s panicked: %v", r.Subject, p)
+		}
+	}()
+	root, err := r.root()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to parse the registered root")
+	}
+	return m.check(r.Subject, root, r.Options)
+}
+
+func (m *Monitor) persist(r *Registration) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(m.store.PutRegistration(r.Subject, raw), "failed to save monitor registration")
+}
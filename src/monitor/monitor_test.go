@@ -0,0 +1,290 @@
+package monitor
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/notify"
+	"github.com/christopher-henderson/CACop/revocation/ocsp"
+	"github.com/christopher-henderson/CACop/store"
+)
+
+func newStore(t *testing.T) (*store.Store, string, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "cacop.db")
+	s, err := store.Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, path, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// answer is a Check whose leaf is always of the given status.
+func answer(valid, expired bool, calls chan string) Check {
+	return func(subject string, _ *x509.Certificate, _ Options) (model.TestWebsiteResult, error) {
+		if calls != nil {
+			calls <- subject
+		}
+		result := model.TestWebsiteResult{SubjectURL: subject}
+		result.Chain.Leaf.Expiration = expiration.ExpirationStatus{Valid: valid, Expired: expired}
+		return result, nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	m, err := New(s, answer(true, false, nil), nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Register("https://valid.example.com", nil, model.Valid, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Register("https://expired.example.com", nil, model.Expired, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.Run("https://valid.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Regressed || r.Verdict != model.Valid || r.LastRun == 0 {
+		t.Errorf("unexpected registration %+v", r)
+	}
+	r, err = m.Run("https://expired.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Regressed || r.Verdict != model.Valid {
+		t.Errorf("expected a regression, got %+v", r)
+	}
+	if _, err := m.Run("https://unknown.example.com"); err == nil {
+		t.Error("expected an error for an unregistered subject")
+	}
+	summaries, err := s.BySubject("https://valid.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 {
+		t.Errorf("expected the run to be stored, got %v", summaries)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	unreachable := func(string, *x509.Certificate, Options) (model.TestWebsiteResult, error) {
+		return model.TestWebsiteResult{}, errors.New("connection refused")
+	}
+	m, err := New(s, unreachable, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://valid.example.com", nil, model.Valid, Options{})
+	r, err := m.Run("https://valid.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Regressed || r.Error != "connection refused" {
+		t.Errorf("expected a regression, got %+v", r)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	m, err := New(s, answer(false, true, nil), nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://expired.example.com", nil, model.Expired, Options{})
+	m.Run("https://expired.example.com")
+	restored, err := New(s, answer(false, true, nil), nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrations := restored.Registrations()
+	if len(registrations) != 1 {
+		t.Fatalf("expected 1 registration, got %d", len(registrations))
+	}
+	if r := registrations[0]; r.Expected != model.Expired || r.Verdict != model.Expired || r.Regressed {
+		t.Errorf("unexpected registration %+v", r)
+	}
+	if err := restored.Unregister("https://expired.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if raws, _ := s.Registrations(); len(raws) != 0 {
+		t.Errorf("expected the registration to be deleted, got %d", len(raws))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	usages := make(chan certutil.Usage, 1)
+	check := func(subject string, _ *x509.Certificate, opts Options) (model.TestWebsiteResult, error) {
+		usages <- opts.Usage
+		return answer(true, false, nil)(subject, nil, opts)
+	}
+	m, err := New(s, check, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://smime.example.com", nil, model.Valid, Options{Usage: certutil.SMIME})
+	// A restored registration is run with the options it was registered with.
+	restored, err := New(s, check, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Run("https://smime.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if usage := <-usages; usage != certutil.SMIME {
+		t.Errorf("expected the check to verify for %s, got %q", certutil.SMIME, usage)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	calls := make(chan string, 10)
+	m, err := New(s, answer(true, false, calls), nil, time.Millisecond*10, time.Millisecond*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://valid.example.com", nil, model.Valid, Options{})
+	m.Start()
+	defer m.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case subject := <-calls:
+			if subject != "https://valid.example.com" {
+				t.Errorf("unexpected subject %s", subject)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the registration was never run")
+		}
+	}
+}
+
+func TestScheduleRegistration(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	calls := make(chan string, 10)
+	m, err := New(s, answer(true, false, calls), nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Start()
+	defer m.Stop()
+	// Registered after the monitor started, so it must not wait out the hour.
+	m.Register("https://valid.example.com", nil, model.Valid, Options{})
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("the new registration was not run immediately")
+	}
+}
+
+func TestRunReplaced(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	started, release := make(chan string, 1), make(chan struct{})
+	check := func(subject string, root *x509.Certificate, opts Options) (model.TestWebsiteResult, error) {
+		started <- subject
+		<-release
+		return answer(true, false, nil)(subject, root, opts)
+	}
+	m, err := New(s, check, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://valid.example.com", nil, model.Valid, Options{})
+	done := make(chan struct{})
+	go func() {
+		m.Run("https://valid.example.com")
+		close(done)
+	}()
+	<-started
+	m.Register("https://valid.example.com", nil, model.Expired, Options{})
+	close(release)
+	<-done
+	registrations := m.Registrations()
+	if len(registrations) != 1 {
+		t.Fatalf("expected 1 registration, got %d", len(registrations))
+	}
+	if r := registrations[0]; r.Expected != model.Expired || !r.LastChecked.IsZero() {
+		t.Errorf("expected the run of the replaced registration to be discarded, got %+v", r)
+	}
+}
+
+type notifier chan notify.Event
+
+func (n notifier) Notify(e notify.Event) error {
+	n <- e
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	s, _, cleanup := newStore(t)
+	defer cleanup()
+	events := make(notifier, 10)
+	valid, responderDown := true, false
+	check := func(subject string, _ *x509.Certificate, _ Options) (model.TestWebsiteResult, error) {
+		result := model.TestWebsiteResult{SubjectURL: subject}
+		result.Chain.Leaf.Fingerprint = "leaf"
+		result.Chain.Leaf.Expiration = expiration.ExpirationStatus{Valid: valid, Expired: !valid}
+		response := ocsp.OCSP{Responder: "http://ocsp.example.com", Good: !responderDown}
+		if responderDown {
+			response.Error = errors.New("connection refused")
+		}
+		result.Chain.Leaf.OCSP = []ocsp.OCSP{response}
+		return result, nil
+	}
+	m, err := New(s, check, events, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("https://valid.example.com", nil, model.Valid, Options{})
+	next := func() notify.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("expected a notification")
+		}
+		return notify.Event{}
+	}
+	m.Run("https://valid.example.com")
+	m.Run("https://valid.example.com")
+	responderDown = true
+	m.Run("https://valid.example.com")
+	if e := next(); e.Kind != notify.EndpointFailing || len(e.Failing) != 1 || e.Failing[0].Endpoint != "http://ocsp.example.com" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	valid = false
+	m.Run("https://valid.example.com")
+	if e := next(); e.Kind != notify.VerdictChanged || e.Previous != model.Valid || e.Current != model.Expired || !e.Regressed {
+		t.Errorf("unexpected event %+v", e)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/monitor"
+	"github.com/christopher-henderson/CACop/notify"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var monitors *monitor.Monitor
+
+func startMonitor(interval, jitter time.Duration, notifier notify.Notifier) (err error) {
+	check := func(subject string, root *x509.Certificate, opts monitor.Options) (model.TestWebsiteResult, error) {
+		ctx := logging.NewContext()
+		logging.FromContext(ctx).WithField("subject", subject).Info("running monitored test website")
+		usage := opts.Usage
+		if usage == "" {
+			// Registered before the options were kept with the subject.
+			usage = certutil.TLSServer
+		}
+		return testWebsite(ctx, subject, root, options{Usage: usage})
+	}
+	if monitors, err = monitor.New(results, check, notifier, interval, jitter); err != nil {
+		return err
+	}
+	monitors.Start()
+	return nil
+}
+
+// notifier builds the notifiers of regressions that were asked for on the
+// command line, or nil if there were none.
+func notifier(webhooks, secret, spool, from, to string) (notify.Notifier, error) {
+	var notifiers notify.Multi
+	for _, url := range strings.Split(webhooks, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			notifiers = append(notifiers, notify.NewWebhook(url, []byte(secret)))
+		}
+	}
+	if spool != "" {
+		var recipients []string
+		for _, recipient := range strings.Split(to, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				recipients = append(recipients, recipient)
+			}
+		}
+		s, err := notify.NewSpool(spool, from, recipients)
+		if err != nil {
+			return nil, fmt.Errorf("-spool %s", err)
+		}
+		notifiers = append(notifiers, s)
+	}
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	return notifiers, nil
+}
+
+// monitoring manages the test websites that are periodically verified.
+//
+//	GET    /monitor
+//	POST   /monitor?subject=https://example.com&expect=revoked  (body: optional root PEM)
+//	POST   /monitor?subject=https://example.com&expect=valid&usage=smime
+//	POST   /monitor?subject=https://example.com&run=true
+//	DELETE /monitor?subject=https://example.com
+func monitoring(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	query := req.URL.Query()
+	subject := query.Get("subject")
+	switch {
+	case req.Method == http.MethodGet:
+		encode(resp, monitors.Registrations())
+		return
+	case subject == "":
+		resp.WriteHeader(400)
+		resp.Write([]byte("'subject' query parameter is required\n"))
+		return
+	case req.Method == http.MethodDelete:
+		if err := monitors.Unregister(subject); err != nil {
+			resp.WriteHeader(404)
+			resp.Write([]byte(err.Error() + "\n"))
+		}
+		return
+	case req.Method != http.MethodPost:
+		resp.WriteHeader(405)
+		return
+	case query.Get("run") == "true":
+		registration, err := monitors.Run(subject)
+		if err != nil {
+			resp.WriteHeader(404)
+			resp.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		encode(resp, registration)
+		return
+	}
+	expected, err := model.ParseVerdict(query.Get("expect"))
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("'expect' query parameter: " + err.Error() + "\n"))
+		return
+	}
+	// Every scheduled run verifies for the usage given here, so that
+	// successive runs in the history are comparable.
+	usage, err := certutil.ParseUsage(query.Get("usage"))
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("'usage' query parameter: " + err.Error() + "\n"))
+		return
+	}
+	raw, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("Error reading body: " + err.Error()))
+		return
+	}
+	var root *x509.Certificate
+	if len(raw) != 0 {
+		block, _ := pem.Decode(NormalizePEM(raw))
+		if block == nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Bad PEM\n"))
+			return
+		}
+		if root, err = x509.ParseCertificate(block.Bytes); err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Bad PEM: " + err.Error()))
+			return
+		}
+	}
+	registration, err := monitors.Register(subject, root, expected, monitor.Options{Usage: usage})
+	if err != nil {
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+		return
+	}
+	encode(resp, registration)
+}
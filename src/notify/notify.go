@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/christopher-henderson/CACop/diff"
+	"github.com/christopher-henderson/CACop/model"
+)
+
+type Kind string
+
+const (
+	// VerdictChanged is raised when a monitored subject's verdict, or whether
+	// it meets its expectation, differs from the previous run.
+	VerdictChanged Kind = "verdict changed"
+	// EndpointFailing is raised when an OCSP responder or CRL distribution
+	// point that previously answered starts failing.
+	EndpointFailing Kind = "endpoint failing"
+)
+
+type Event struct {
+	Kind        Kind
+	Subject     string
+	Time        time.Time
+	Expected    model.Verdict
+	Previous    model.Verdict
+	Current     model.Verdict
+	Regressed   bool
+	Error       string `json:",omitempty"`
+	PreviousRun uint64
+	Run         uint64
+	Failing     []diff.Transition `json:",omitempty"`
+	Diff        *diff.Diff        `json:",omitempty"`
+}
+
+// Summary is a single line description of the event.
+func (e Event) Summary() string {
+	switch e.Kind {
+	case EndpointFailing:
+		endpoints := make([]string, len(e.Failing))
+		for i, t := range e.Failing {
+			endpoints[i] = t.Endpoint
+		}
+		return fmt.Sprintf("%s: %s started failing", e.Subject, strings.Join(endpoints, ", "))
+	default:
+		if e.Error != "" {
+			return fmt.Sprintf("%s: could not be verified (expected %s): %s", e.Subject, e.Expected, e.Error)
+		}
+		return fmt.Sprintf("%s: verdict changed from %s to %s (expected %s)", e.Subject, verdictOf(e.Previous), verdictOf(e.Current), e.Expected)
+	}
+}
+
+func verdictOf(v model.Verdict) model.Verdict {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
+
+type Notifier interface {
+	Notify(Event) error
+}
+
+// Multi delivers every event to each of its notifiers, returning the first
+// error encountered after having attempted them all.
+type Multi []Notifier
+
+func (m Multi) Notify(e Event) error {
+	var first error
+	for _, n := range m {
+		if err := n.Notify(e); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
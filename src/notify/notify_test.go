@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/diff"
+	"github.com/christopher-henderson/CACop/model"
+)
+
+var event = Event{
+	Kind:     VerdictChanged,
+	Subject:  "https://revoked.example.com",
+	Time:     time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	Expected: model.Revoked,
+	Previous: model.Revoked,
+	Current:  model.Valid,
+	Diff:     &diff.Diff{Subject: "https://revoked.example.com"},
+}
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if got := r.Header.Get(SignatureHeader); got != Sign(secret, body) {
+			t.Errorf("bad signature %q", got)
+		}
+		var got Event
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		if got.Subject != event.Subject || got.Current != model.Valid || got.Diff == nil {
+			t.Errorf("unexpected payload %s", body)
+		}
+	}))
+	defer server.Close()
+	w := NewWebhook(server.URL, secret)
+	w.Backoff = time.Millisecond
+	if err := w.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	w := NewWebhook(server.URL, nil)
+	w.Backoff = time.Millisecond
+	if err := w.Notify(event); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("a client error should not be retried, got %d attempts", attempts)
+	}
+}
+
+func TestWebhookVerifiesReceiver(t *testing.T) {
+	insecure := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() { http.DefaultTransport.(*http.Transport).TLSClientConfig = insecure }()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivered to a receiver with an untrusted certificate")
+	}))
+	defer server.Close()
+	w := NewWebhook(server.URL, nil)
+	w.Attempts = 1
+	if err := w.Notify(event); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := (Spool{Dir: dir, To: []string{"not an address"}}).Notify(event); err == nil {
+		t.Error("expected an error from a bad recipient")
+	}
+	for _, s := range []struct {
+		from string
+		to   []string
+	}{
+		{"cacop@example.com", nil},
+		{"not an address", []string{"ops@example.com"}},
+		{"cacop@example.com", []string{"not an address"}},
+	} {
+		if _, err := NewSpool(dir, s.from, s.to); err == nil {
+			t.Errorf("expected an error for a spool from %q to %q", s.from, s.to)
+		}
+	}
+	s, err := NewSpool(dir, "cacop@example.com", []string{"ops@example.com", "Security Team <security@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".eml") {
+		t.Fatalf("expected a single message, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	message, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := message.Header["To"]; len(to) != 1 {
+		t.Errorf("expected a single To field, got %q", to)
+	}
+	to, err := message.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[0].Address != "ops@example.com" || to[1].Name != "Security Team" {
+		t.Errorf("unexpected recipients %v, %v", to, err)
+	}
+	date, err := message.Header.Date()
+	if err != nil || !date.Equal(event.Time) {
+		t.Errorf("unexpected date %v, %v", date, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || !strings.Contains(subject, "verdict changed from revoked to valid") {
+		t.Errorf("unexpected subject %q, %v", subject, err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	e := Event{
+		Kind:    EndpointFailing,
+		Subject: "https://valid.example.com",
+		Failing: []diff.Transition{{Endpoint: "http://ocsp.example.com", From: "good", To: "error"}},
+	}
+	if got, want := e.Summary(), "https://valid.example.com: http://ocsp.example.com started failing"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Spool writes each event as an RFC 5322 message into a directory for a
+// local mailer to pick up and deliver.
+type Spool struct {
+	Dir  string
+	From string
+	To   []string
+}
+
+// NewSpool checks the sender and recipients up front, so that a mistake on
+// the command line is not first noticed when a regression goes unreported.
+func NewSpool(dir, from string, to []string) (Spool, error) {
+	s := Spool{Dir: dir, From: from, To: to}
+	if len(to) == 0 {
+		return s, errors.New("a spool requires at least one recipient")
+	}
+	if _, err := sender(from); err != nil {
+		return s, err
+	}
+	if _, err := recipients(to); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Notify writes the message to a temporary file before renaming it into the
+// spool so that a mailer never observes a partially written message.
+func (s Spool) Notify(e Event) error {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s", e.Time.UnixNano(), hex.EncodeToString(id))
+	message, err := s.message(e, name)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.Dir, "."+name+".tmp")
+	if err := ioutil.WriteFile(tmp, message, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write to spool %v", s.Dir)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.Dir, name+".eml")); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "failed to write to spool %v", s.Dir)
+	}
+	return nil
+}
+
+func (s Spool) message(e Event, id string) ([]byte, error) {
+	payload, err := json.MarshalIndent(e, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode event")
+	}
+	from, err := sender(s.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := recipients(s.To)
+	if err != nil {
+		return nil, err
+	}
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", "[CACop] "+e.Summary()))
+	header("Date", at.Format(time.RFC1123Z))
+	header("Message-ID", "<"+id+"@cacop>")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(e.Summary() + "\r\n\r\n")
+	b.Write(bytes.Replace(payload, []byte("\n"), []byte("\r\n"), -1))
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
+
+func sender(from string) (string, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return "", errors.Wrapf(err, "bad sender %q", from)
+	}
+	return address.String(), nil
+}
+
+// recipients is the single To field of the message. RFC 5322 permits the
+// field only once, with the addresses separated by commas.
+func recipients(to []string) (string, error) {
+	addresses := make([]string, 0, len(to))
+	for _, t := range to {
+		address, err := mail.ParseAddress(t)
+		if err != nil {
+			return "", errors.Wrapf(err, "bad recipient %q", t)
+		}
+		addresses = append(addresses, address.String())
+	}
+	return strings.Join(addresses, ", "), nil
+}
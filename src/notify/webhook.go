@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body,
+// keyed with the webhook's secret, so that receivers may authenticate us.
+const SignatureHeader = "X-CACop-Signature"
+
+type Webhook struct {
+	URL    string
+	Secret []byte
+	// Attempts is the number of deliveries attempted before giving up.
+	Attempts int
+	// Backoff is the delay before the first retry, doubling on every retry after.
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+func NewWebhook(url string, secret []byte) *Webhook {
+	return &Webhook{
+		URL:      url,
+		Secret:   secret,
+		Attempts: 5,
+		Backoff:  time.Second,
+		// Not the default transport, as the server has that skip certificate
+		// verification in order to inspect broken test websites. Events are
+		// only ever delivered to a receiver that can prove who it is.
+		Client: &http.Client{
+			Timeout:   time.Second * 30,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+	}
+}
+
+// Sign returns the value of the SignatureHeader for the given body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify posts the event as JSON, retrying with exponential backoff for as
+// long as the receiver is unreachable or answers with a 5xx or 429.
+func (w *Webhook) Notify(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook payload")
+	}
+	backoff := w.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.deliver(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.Attempts {
+			return errors.Wrapf(err, "failed to deliver webhook to %v after %d attempts", w.URL, attempt)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) deliver(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("received %s", resp.Status)
+	default:
+		return false, fmt.Errorf("received %s", resp.Status)
+	}
+}
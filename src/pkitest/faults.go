@@ -0,0 +1,47 @@
+package pkitest
+
+import "time"
+
+// Faults are misbehaviours of the OCSP responders, CRL distribution points and
+// test websites, with which to demonstrate what CACop reports of a CA that exhibits them.
+type Faults struct {
+	// ExpiredOCSP issues OCSP responses whose nextUpdate has already passed.
+	ExpiredOCSP bool
+	// WrongSigner signs OCSP responses with a key other than that of the
+	// issuer, and which is not delegated by the issuer.
+	WrongSigner bool
+	// NoNextUpdate omits the nextUpdate from OCSP responses. CRLs are always
+	// issued with a nextUpdate as RFC 5280 requires it.
+	NoNextUpdate bool
+	// StaleCRL issues CRLs whose nextUpdate has already passed.
+	StaleCRL bool
+	// EndEntityCRL limits every CRL to end entity certificates, so that the
+	// revocation of intermediates cannot be determined from their parent's CRL.
+	EndEntityCRL bool
+	// ServerError answers every OCSP request and CRL download with a 500.
+	ServerError bool
+	// NoStaple serves test websites without a stapled OCSP response.
+	NoStaple bool
+	// StaleStaple staples OCSP responses whose nextUpdate has already passed.
+	StaleStaple bool
+	// GoodStaple staples OCSP responses that say the leaf is good, even once
+	// the responder says otherwise.
+	GoodStaple bool
+	// Delay is how long to wait before answering each OCSP request and CRL download.
+	Delay time.Duration
+}
+
+// SetFaults changes how every subsequent OCSP request, CRL download and
+// handshake is answered.
+func (p *PKI) SetFaults(faults Faults) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.faults = faults
+}
+
+// Faults are those most recently set, or none.
+func (p *PKI) Faults() Faults {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.faults
+}
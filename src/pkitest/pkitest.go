@@ -0,0 +1,381 @@
+// Package pkitest is an in-memory PKI for tests: a root, an intermediate and
+// the valid, expired and revoked leaves that Mozilla expects of every CA, whose
+// CRLs and OCSP responses are served from a local HTTP server and which may be
+// hosted by local TLS test websites.
+package pkitest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Authority is a CA certificate along with its key and the certificates that it has revoked.
+type Authority struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// OCSPServer and CRLDistributionPoint are where the status of the
+	// certificates issued by this authority is published.
+	OCSPServer           string
+	CRLDistributionPoint string
+	// Chain is the authority followed by its issuers up to the root.
+	Chain []*x509.Certificate
+
+	lock    sync.Mutex
+	issued  map[string]bool
+	revoked map[string]time.Time
+}
+
+// Leaf is an end entity certificate along with its key and the rest of its chain.
+type Leaf struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	Issuer      *Authority
+	// Chain is the leaf followed by the intermediates and then the root.
+	Chain []*x509.Certificate
+}
+
+// TLSCertificate is the leaf and intermediates as presented by a TLS server.
+func (l *Leaf) TLSCertificate() tls.Certificate {
+	var chain [][]byte
+	for _, cert := range l.Chain[:len(l.Chain)-1] {
+		chain = append(chain, cert.Raw)
+	}
+	return tls.Certificate{Certificate: chain, PrivateKey: l.Key, Leaf: l.Certificate}
+}
+
+// PKI is a root and an intermediate, along with a leaf of each of the kinds
+// that a CA's test websites must serve.
+type PKI struct {
+	Root         *Authority
+	Intermediate *Authority
+	Valid        *Leaf
+	Expired      *Leaf
+	Revoked      *Leaf
+	// Now is the moment around which every validity period is chosen.
+	Now time.Time
+
+	server      *httptest.Server
+	serial      int64
+	lock        sync.Mutex
+	authorities map[string]*Authority
+	requests    map[string]int
+	faults      Faults
+	// impostor signs OCSP responses when the WrongSigner fault is set.
+	impostor *Authority
+}
+
+// New creates a PKI whose CRLs and OCSP responses are served from a local
+// HTTP server until Close is called.
+func New() (*PKI, error) {
+	p := &PKI{
+		Now:         time.Now().UTC().Truncate(time.Second),
+		authorities: make(map[string]*Authority),
+		requests:    make(map[string]int),
+	}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serve))
+	var err error
+	if p.Root, err = p.NewRoot("CACop Test Root"); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if p.Intermediate, err = p.NewIntermediate(p.Root, "CACop Test Intermediate"); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if p.impostor, err = p.NewRoot("CACop Impostor"); err != nil {
+		p.Close()
+		return nil, err
+	}
+	year := time.Hour * 24 * 365
+	leaves := []struct {
+		leaf      **Leaf
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+	}{
+		{&p.Valid, "valid.example.com", p.Now.Add(-year), p.Now.Add(year)},
+		{&p.Expired, "expired.example.com", p.Now.Add(-2 * year), p.Now.Add(-year)},
+		{&p.Revoked, "revoked.example.com", p.Now.Add(-year), p.Now.Add(year)},
+	}
+	for _, l := range leaves {
+		if *l.leaf, err = p.NewLeaf(p.Intermediate, l.name, l.notBefore, l.notAfter); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	p.Intermediate.Revoke(p.Revoked.Certificate, p.Now.Add(-time.Hour))
+	return p, nil
+}
+
+// NewT creates a PKI for the test, failing it if the PKI cannot be created,
+// and closes the PKI once the test is done.
+func NewT(t testing.TB) *PKI {
+	t.Helper()
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Close shuts down the server of CRLs and OCSP responses.
+func (p *PKI) Close() {
+	p.server.Close()
+}
+
+// URL is the base URL of the server of CRLs and OCSP responses.
+func (p *PKI) URL() string {
+	return p.server.URL
+}
+
+// Requests is the number of requests that have been made for the given path,
+// eg. the path of a CRL distribution point.
+func (p *PKI) Requests(path string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.requests[path]
+}
+
+func (p *PKI) nextSerial() *big.Int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.serial++
+	return big.NewInt(p.serial)
+}
+
+func newKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// subjectKeyID is the method (1) of RFC 5280 section 4.2.1.2.
+func subjectKeyID(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	id := sha1.Sum(info.PublicKey.Bytes)
+	return id[:], nil
+}
+
+func (p *PKI) newAuthority() *Authority {
+	a := &Authority{issued: make(map[string]bool), revoked: make(map[string]time.Time)}
+	id := p.nextSerial().String()
+	a.OCSPServer = p.server.URL + "/ocsp/" + id
+	a.CRLDistributionPoint = p.server.URL + "/crl/" + id + ".crl"
+	p.lock.Lock()
+	p.authorities[id] = a
+	p.lock.Unlock()
+	return a
+}
+
+// Issue signs the template with the issuer's key. The template's serial
+// number, key identifiers and revocation endpoints are filled in unless it
+// already has them.
+func (p *PKI) Issue(issuer *Authority, template *x509.Certificate, key crypto.PublicKey) (*x509.Certificate, error) {
+	if err := p.fill(template, key); err != nil {
+		return nil, err
+	}
+	if template.OCSPServer == nil {
+		template.OCSPServer = []string{issuer.OCSPServer}
+	}
+	if template.CRLDistributionPoints == nil {
+		template.CRLDistributionPoints = []string{issuer.CRLDistributionPoint}
+	}
+	cert, err := sign(template, issuer.Certificate, key, issuer.Key)
+	if err != nil {
+		return nil, err
+	}
+	issuer.lock.Lock()
+	issuer.issued[cert.SerialNumber.String()] = true
+	issuer.lock.Unlock()
+	return cert, nil
+}
+
+// fill completes the template with what every certificate needs. Certificate
+// policies are written from the PolicyIdentifiers, as whether the Policies
+// are written instead depends upon the x509usepolicies setting.
+func (p *PKI) fill(template *x509.Certificate, key crypto.PublicKey) error {
+	var err error
+	if template.SerialNumber == nil {
+		template.SerialNumber = p.nextSerial()
+	}
+	if template.SubjectKeyId == nil {
+		if template.SubjectKeyId, err = subjectKeyID(key); err != nil {
+			return errors.Wrap(err, "failed to compute the subject key identifier")
+		}
+	}
+	if template.Policies == nil {
+		for _, id := range template.PolicyIdentifiers {
+			ints := make([]uint64, len(id))
+			for i, n := range id {
+				ints[i] = uint64(n)
+			}
+			policy, err := x509.OIDFromInts(ints)
+			if err != nil {
+				return errors.Wrapf(err, "bad policy %s", id)
+			}
+			template.Policies = append(template.Policies, policy)
+		}
+	}
+	return nil
+}
+
+func sign(template, parent *x509.Certificate, key crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key, signer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign %s", template.Subject.CommonName)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// NewRoot creates a self signed root.
+func (p *PKI) NewRoot(name string) (*Authority, error) {
+	return p.NewAuthority(nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"CACop"}},
+		NotBefore:             p.Now.AddDate(-5, 0, 0),
+		NotAfter:              p.Now.AddDate(20, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	})
+}
+
+// NewIntermediate creates an intermediate issued by the given authority.
+func (p *PKI) NewIntermediate(issuer *Authority, name string) (*Authority, error) {
+	return p.NewAuthority(issuer, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"CACop"}},
+		NotBefore:             p.Now.AddDate(-5, 0, 0),
+		NotAfter:              p.Now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// NewAuthority creates an authority from the template, for tests that need a
+// CA with particular policies, constraints or extensions. It is issued by the
+// given authority or, if that is nil, is a self signed root.
+func (p *PKI) NewAuthority(issuer *Authority, template *x509.Certificate) (*Authority, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	a := p.newAuthority()
+	a.Key = key
+	if issuer != nil {
+		if a.Certificate, err = p.Issue(issuer, template, key.Public()); err != nil {
+			return nil, err
+		}
+		a.Chain = append([]*x509.Certificate{a.Certificate}, issuer.Chain...)
+		return a, nil
+	}
+	if err := p.fill(template, key.Public()); err != nil {
+		return nil, err
+	}
+	if a.Certificate, err = sign(template, template, key.Public(), key); err != nil {
+		return nil, err
+	}
+	a.Chain = []*x509.Certificate{a.Certificate}
+	return a, nil
+}
+
+// NewLeaf creates a TLS server certificate for the name, and for the loopback
+// addresses so that it may be served by a local test website.
+func (p *PKI) NewLeaf(issuer *Authority, name string, notBefore, notAfter time.Time) (*Leaf, error) {
+	return p.newLeaf(issuer, leafTemplate(name, notBefore, notAfter))
+}
+
+// NewMustStapleLeaf creates a leaf as NewLeaf does, but with the TLS Feature
+// extension of RFC 7633 demanding that a valid OCSP response be stapled.
+func (p *PKI) NewMustStapleLeaf(issuer *Authority, name string, notBefore, notAfter time.Time) (*Leaf, error) {
+	template := leafTemplate(name, notBefore, notAfter)
+	template.ExtraExtensions = []pkix.Extension{{Id: tlsFeature, Value: statusRequest}}
+	return p.newLeaf(issuer, template)
+}
+
+var (
+	tlsFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	// statusRequest is the DER of a TLS Feature of just status_request (5).
+	statusRequest = []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+)
+
+func leafTemplate(name string, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func (p *PKI) newLeaf(issuer *Authority, template *x509.Certificate) (*Leaf, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := p.Issue(issuer, template, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Leaf{Certificate: cert, Key: key, Issuer: issuer, Chain: append([]*x509.Certificate{cert}, issuer.Chain...)}, nil
+}
+
+// Revoke marks the certificate, which must have been issued by this authority, as revoked at the given time.
+func (a *Authority) Revoke(cert *x509.Certificate, at time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.revoked[cert.SerialNumber.String()] = at
+}
+
+// Site serves the leaf, along with its intermediates and a freshly stapled
+// OCSP response, from a local TLS test website until the returned server is closed.
+func (p *PKI) Site(leaf *Leaf) *httptest.Server {
+	site := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(resp, "%s\n", leaf.Certificate.Subject.CommonName)
+	}))
+	// The staple is chosen per handshake rather than via GetCertificate, which
+	// httptest's own certificate would preempt whenever no SNI is sent.
+	site.TLS = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert := leaf.TLSCertificate()
+		if !p.Faults().NoStaple {
+			staple, err := p.Staple(leaf, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			cert.OCSPStaple = staple
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}}
+	site.StartTLS()
+	return site
+}
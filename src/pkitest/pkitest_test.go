@@ -0,0 +1,184 @@
+package pkitest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestPKI(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(p.Root.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(p.Intermediate.Certificate)
+	verify := func(leaf *Leaf) error {
+		_, err := leaf.Certificate.Verify(x509.VerifyOptions{
+			DNSName:       leaf.Certificate.DNSNames[0],
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   p.Now,
+		})
+		return err
+	}
+	if err := verify(p.Valid); err != nil {
+		t.Error(err)
+	}
+	if err := verify(p.Revoked); err != nil {
+		t.Error(err)
+	}
+	if err := verify(p.Expired); err == nil {
+		t.Error("expected the expired leaf to fail verification")
+	}
+	if len(p.Valid.Chain) != 3 || p.Valid.Chain[2] != p.Root.Certificate {
+		t.Errorf("expected a chain of leaf, intermediate and root, got %d certificates", len(p.Valid.Chain))
+	}
+}
+
+func TestNewAuthority(t *testing.T) {
+	p := NewT(t)
+	policy := asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	template := func(name string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             p.Now.AddDate(-1, 0, 0),
+			NotAfter:              p.Now.AddDate(1, 0, 0),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+			PolicyIdentifiers:     []asn1.ObjectIdentifier{policy},
+		}
+	}
+	root, err := p.NewAuthority(nil, template("Root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := p.NewAuthority(root, template("Intermediate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Certificate.CheckSignatureFrom(root.Certificate); err != nil {
+		t.Errorf("expected the root to be self signed: %v", err)
+	}
+	if err := intermediate.Certificate.CheckSignatureFrom(root.Certificate); err != nil {
+		t.Errorf("expected the intermediate to be issued by the root: %v", err)
+	}
+	if len(intermediate.Chain) != 2 || intermediate.Chain[1] != root.Certificate {
+		t.Errorf("expected a chain of intermediate and root, got %d certificates", len(intermediate.Chain))
+	}
+	for _, a := range []*Authority{root, intermediate} {
+		if ids := a.Certificate.PolicyIdentifiers; len(ids) != 1 || !ids[0].Equal(policy) {
+			t.Errorf("expected %s to assert %s, got %v", a.Certificate.Subject.CommonName, policy, ids)
+		}
+	}
+}
+
+func TestOCSP(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for leaf, status := range map[*Leaf]int{p.Valid: ocsp.Good, p.Revoked: ocsp.Revoked} {
+		req, err := ocsp.CreateRequest(leaf.Certificate, p.Intermediate.Certificate, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(leaf.Certificate.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		parsed, err := ocsp.ParseResponse(body, p.Intermediate.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Status != status {
+			t.Errorf("%s: expected status %d, got %d", leaf.Certificate.Subject.CommonName, status, parsed.Status)
+		}
+	}
+	responder, err := url.Parse(p.Intermediate.OCSPServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Requests(responder.Path); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestCRL(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	dp := p.Revoked.Certificate.CRLDistributionPoints[0]
+	resp, err := http.Get(dp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	crl, err := x509.ParseCRL(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Intermediate.Certificate.CheckCRLSignature(crl); err != nil {
+		t.Error(err)
+	}
+	revoked := crl.TBSCertList.RevokedCertificates
+	if len(revoked) != 1 || revoked[0].SerialNumber.Cmp(p.Revoked.Certificate.SerialNumber) != 0 {
+		t.Errorf("expected only the revoked leaf to be listed, got %v", revoked)
+	}
+	if n := p.Requests(resp.Request.URL.Path); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestSite(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	site := p.Site(p.Valid)
+	defer site.Close()
+	conn, err := tls.Dial("tcp", site.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	presented := conn.ConnectionState().PeerCertificates
+	if len(presented) != 2 || !presented[0].Equal(p.Valid.Certificate) || !presented[1].Equal(p.Intermediate.Certificate) {
+		t.Errorf("expected the leaf and intermediate to be presented, got %d certificates", len(presented))
+	}
+	staple, err := ocsp.ParseResponse(conn.ConnectionState().OCSPResponse, p.Intermediate.Certificate)
+	if err != nil {
+		t.Fatalf("expected a stapled OCSP response: %v", err)
+	}
+	if staple.Status != ocsp.Good || staple.SerialNumber.Cmp(p.Valid.Certificate.SerialNumber) != 0 {
+		t.Errorf("unexpected staple %+v", staple)
+	}
+	p.SetFaults(Faults{NoStaple: true})
+	unstapled, err := tls.Dial("tcp", site.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unstapled.Close()
+	if len(unstapled.ConnectionState().OCSPResponse) != 0 {
+		t.Error("expected no staple")
+	}
+}
@@ -0,0 +1,215 @@
+package pkitest
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ResponseLifetime is the period between the thisUpdate and nextUpdate of
+// every OCSP response and CRL.
+const ResponseLifetime = time.Hour * 24
+
+// serve answers OCSP requests on /ocsp/{authority} and CRL downloads on
+// /crl/{authority}.crl, exhibiting whichever faults have been set.
+func (p *PKI) serve(resp http.ResponseWriter, req *http.Request) {
+	p.lock.Lock()
+	p.requests[req.URL.Path]++
+	faults := p.faults
+	p.lock.Unlock()
+	time.Sleep(faults.Delay)
+	if faults.ServerError {
+		http.Error(resp, "simulated failure", http.StatusInternalServerError)
+		return
+	}
+	// Responses are issued as of the request, rather than as of p.Now, so
+	// that a long running simulation does not go stale.
+	now := time.Now()
+	dir, file := path.Split(req.URL.Path)
+	var (
+		body []byte
+		err  error
+	)
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/ocsp/"):
+		a := p.authority(strings.SplitN(strings.TrimPrefix(req.URL.Path, "/ocsp/"), "/", 2)[0])
+		if a == nil {
+			http.NotFound(resp, req)
+			return
+		}
+		var request []byte
+		if request, err = readOCSPRequest(req); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err = p.ocspResponse(a, request, now, faults)
+		resp.Header().Set("Content-Type", "application/ocsp-response")
+	default:
+		// Everything that is not an OCSP request must be a CRL.
+		a := p.authority(strings.TrimSuffix(file, ".crl"))
+		if dir != "/crl/" || a == nil {
+			http.NotFound(resp, req)
+			return
+		}
+		thisUpdate, nextUpdate := now, now.Add(ResponseLifetime)
+		if faults.StaleCRL {
+			thisUpdate, nextUpdate = now.Add(-2*ResponseLifetime), now.Add(-ResponseLifetime)
+		}
+		var extensions []pkix.Extension
+		if faults.EndEntityCRL {
+			extensions = append(extensions, EndEntitiesOnly)
+		}
+		body, err = a.SignCRL(thisUpdate, nextUpdate, extensions...)
+		resp.Header().Set("Content-Type", "application/pkix-crl")
+	}
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Write(body)
+}
+
+func (p *PKI) authority(id string) *Authority {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.authorities[id]
+}
+
+// readOCSPRequest decodes the DER request from either a POST body or a GET
+// path as described by RFC 6960 appendix A.1.
+func readOCSPRequest(req *http.Request) ([]byte, error) {
+	switch req.Method {
+	case http.MethodPost:
+		return ioutil.ReadAll(req.Body)
+	case http.MethodGet:
+		_, encoded := path.Split(req.URL.EscapedPath())
+		unescaped, err := url.PathUnescape(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(unescaped)
+	}
+	return nil, errors.Errorf("unsupported method %s", req.Method)
+}
+
+// ocspResponse answers the DER encoded OCSP request with a response signed
+// directly by the authority, valid from the given time, unless faults say otherwise.
+func (p *PKI) ocspResponse(a *Authority, request []byte, now time.Time, faults Faults) ([]byte, error) {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse OCSP request")
+	}
+	return p.signOCSP(a, a.Template(req.SerialNumber, now), faults)
+}
+
+// Staple is the OCSP response that a test website serving the leaf staples
+// to its handshakes, issued at the given time.
+func (p *PKI) Staple(leaf *Leaf, now time.Time) ([]byte, error) {
+	faults := p.Faults()
+	if faults.StaleStaple {
+		now = now.Add(-2 * ResponseLifetime)
+	}
+	template := leaf.Issuer.Template(leaf.Certificate.SerialNumber, now)
+	if faults.GoodStaple {
+		template.Status = ocsp.Good
+		template.RevokedAt = time.Time{}
+	}
+	return p.signOCSP(leaf.Issuer, template, faults)
+}
+
+// signOCSP signs the template, which is valid from its thisUpdate, as the
+// OCSP faults dictate.
+func (p *PKI) signOCSP(a *Authority, template ocsp.Response, faults Faults) ([]byte, error) {
+	now := template.ThisUpdate
+	if faults.ExpiredOCSP {
+		template.ThisUpdate = now.Add(-2 * ResponseLifetime)
+		template.NextUpdate = now.Add(-ResponseLifetime)
+	}
+	if faults.NoNextUpdate {
+		template.NextUpdate = time.Time{}
+	}
+	if faults.WrongSigner {
+		// The impostor's certificate is embedded, as a delegated responder's
+		// would be, but it was never issued by the authority.
+		template.Certificate = p.impostor.Certificate
+		return ocsp.CreateResponse(a.Certificate, p.impostor.Certificate, template, p.impostor.Key)
+	}
+	return ocsp.CreateResponse(a.Certificate, a.Certificate, template, a.Key)
+}
+
+// Template is the OCSP response that the authority gives for the serial
+// number, for those who wish to alter it before signing.
+func (a *Authority) Template(serial *big.Int, now time.Time) ocsp.Response {
+	response := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serial,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(ResponseLifetime),
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if revokedAt, ok := a.revoked[serial.String()]; ok {
+		response.Status = ocsp.Revoked
+		response.RevokedAt = revokedAt
+	} else if !a.issued[serial.String()] {
+		response.Status = ocsp.Unknown
+	}
+	return response
+}
+
+// CRL is the authority's DER encoded CRL, issued at the given time.
+func (a *Authority) CRL(now time.Time) ([]byte, error) {
+	return a.SignCRL(now, now.Add(ResponseLifetime))
+}
+
+// Issuing distribution points with which to limit the scope of a CRL.
+var (
+	// EndEntitiesOnly limits the CRL to end entity certificates.
+	EndEntitiesOnly = issuingDistributionPoint(0x81)
+	// AuthoritiesOnly makes the CRL an ARL, limited to CA certificates.
+	AuthoritiesOnly = issuingDistributionPoint(0x82)
+)
+
+// issuingDistributionPoint is a critical issuing distribution point extension
+// that sets only the boolean of the given implicit tag.
+func issuingDistributionPoint(tag byte) pkix.Extension {
+	return pkix.Extension{
+		Id:       asn1.ObjectIdentifier{2, 5, 29, 28},
+		Critical: true,
+		Value:    []byte{0x30, 0x03, tag, 0x01, 0xff},
+	}
+}
+
+// SignCRL issues a CRL of every certificate revoked by the authority with the
+// given thisUpdate, nextUpdate and extensions.
+func (a *Authority) SignCRL(thisUpdate, nextUpdate time.Time, extensions ...pkix.Extension) ([]byte, error) {
+	a.lock.Lock()
+	template := &x509.RevocationList{
+		Number:          big.NewInt(thisUpdate.Unix()),
+		ThisUpdate:      thisUpdate,
+		NextUpdate:      nextUpdate,
+		ExtraExtensions: extensions,
+	}
+	for serial, at := range a.revoked {
+		n, _ := new(big.Int).SetString(serial, 10)
+		template.RevokedCertificates = append(template.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   n,
+			RevocationTime: at,
+		})
+	}
+	a.lock.Unlock()
+	crl, err := x509.CreateRevocationList(rand.Reader, template, a.Certificate, a.Key)
+	return crl, errors.Wrapf(err, "failed to sign the CRL of %s", a.Certificate.Subject.CommonName)
+}
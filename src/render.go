@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/report"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatJSON     = "json"
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+	formatText     = "text"
+)
+
+var mediaTypes = map[string]string{
+	"application/json": formatJSON,
+	"text/html":        formatHTML,
+	"text/markdown":    formatMarkdown,
+	"text/plain":       formatText,
+}
+
+var contentTypes = map[string]string{
+	formatJSON:     "application/json",
+	formatHTML:     "text/html; charset=utf-8",
+	formatMarkdown: "text/markdown; charset=utf-8",
+	formatText:     "text/plain; charset=utf-8",
+}
+
+// format is the representation that the client asked for, either by the
+// 'format' query parameter or, failing that, by the most preferred media type
+// in the Accept header that the endpoint can render. A client that accepts
+// only representations that we know of yet cannot render here is told so by
+// negotiate, while anything else, including */*, gets JSON.
+func format(req *http.Request, formats []string) string {
+	if f := req.URL.Query().Get("format"); f != "" {
+		f = strings.ToLower(f)
+		if f == "md" {
+			return formatMarkdown
+		}
+		return f
+	}
+	unsupported := ""
+	for _, mediaType := range accepted(req.Header.Get("Accept")) {
+		if mediaType == "*/*" {
+			return formatJSON
+		}
+		f, ok := mediaTypes[mediaType]
+		switch {
+		case !ok:
+		case supports(formats, f):
+			return f
+		case unsupported == "":
+			unsupported = f
+		}
+	}
+	if unsupported != "" {
+		return unsupported
+	}
+	return formatJSON
+}
+
+// RFC 7231
+//
+// 5.3.2.  Accept
+//
+//	Accept = #( media-range [ accept-params ] )
+//	media-range    = ( "*/*"
+//	                 / ( type "/" "*" )
+//	                 / ( type "/" subtype )
+//	                 ) *( OWS ";" OWS parameter )
+//	accept-params  = weight *( accept-ext )
+//
+// accepted are the media types of the Accept header from the most to the least
+// preferred, as given by their quality values. Those with a quality of zero
+// are not acceptable at all and are left out.
+func accepted(header string) []string {
+	type preference struct {
+		mediaType string
+		quality   float64
+	}
+	var preferences []preference
+	for _, accept := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		preferences = append(preferences, preference{mediaType, quality})
+	}
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+	mediaTypes := make([]string, len(preferences))
+	for i, p := range preferences {
+		mediaTypes[i] = p.mediaType
+	}
+	return mediaTypes
+}
+
+var (
+	resultFormats = []string{formatJSON, formatHTML, formatMarkdown, formatText}
+	checkFormats  = []string{formatJSON, formatMarkdown, formatText}
+)
+
+// negotiate settles upon the format of the response before any verification
+// is done, answering with 406 if the client asked for one that we cannot render.
+func negotiate(resp http.ResponseWriter, req *http.Request, formats []string) (string, bool) {
+	f := format(req, formats)
+	if supports(formats, f) {
+		return f, true
+	}
+	resp.WriteHeader(406)
+	fmt.Fprintf(resp, "unknown format %q, expected one of %s\n", f, strings.Join(formats, ", "))
+	return f, false
+}
+
+func supports(formats []string, f string) bool {
+	for _, supported := range formats {
+		if f == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// respond writes the result in the format settled upon by negotiate.
+func respond(resp http.ResponseWriter, f string, result model.TestWebsiteResult) {
+	resp.Header().Set("Content-Type", contentTypes[f])
+	if err := render(resp, f, result); err != nil {
+		resp.WriteHeader(500)
+		fmt.Fprintf(resp, "internal error: %s", err)
+	}
+}
+
+func render(w io.Writer, f string, result model.TestWebsiteResult) error {
+	switch f {
+	case formatHTML:
+		return report.HTML(w, result)
+	case formatMarkdown:
+		return report.Markdown(w, result)
+	case formatText:
+		return report.Text(w, result)
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(result)
+	}
+}
+
+func renderChecks(w io.Writer, f string, checks []report.Check) error {
+	switch f {
+	case formatMarkdown:
+		return report.ChecksMarkdown(w, checks)
+	case formatText:
+		return report.ChecksText(w, checks)
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(checks)
+	}
+}
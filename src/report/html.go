@@ -0,0 +1,211 @@
+package report
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/revocation/crl"
+	"github.com/christopher-henderson/CACop/revocation/ocsp"
+	"github.com/pkg/errors"
+)
+
+// node is a certificate within the tree that the HTML report draws, from
+// the root down to the leaf.
+type node struct {
+	Role  string
+	Cert  model.CertificateResult
+	Child *node
+}
+
+type page struct {
+	Result  model.TestWebsiteResult
+	Verdict model.Verdict
+	Tree    *node
+}
+
+// tree orders the chain as it is drawn, the root being the outermost node.
+func tree(chain model.ChainResult) *node {
+	n := &node{Role: "Leaf", Cert: chain.Leaf}
+	for i := 0; i < len(chain.Intermediates); i++ {
+		n = &node{Role: "Intermediate", Cert: chain.Intermediates[i], Child: n}
+	}
+	return &node{Role: "Root", Cert: chain.Root, Child: n}
+}
+
+// HTML writes a self contained report, that is with neither scripts nor
+// external stylesheets, of the result.
+func HTML(w io.Writer, result model.TestWebsiteResult) error {
+	p := page{Result: result, Verdict: result.Verdict(), Tree: tree(result.Chain)}
+	return errors.Wrap(htmlReport.Execute(w, p), "failed to render HTML report")
+}
+
+// PEM encodes the certificate, or returns the empty string if the result
+// no longer holds the certificate, as is the case for a result that was decoded
+// from JSON.
+func PEM(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// The classes by which outcomes are colored.
+const (
+	good = "good"
+	bad  = "bad"
+	warn = "warn"
+)
+
+func verdictClass(v model.Verdict) string {
+	if v == model.Valid {
+		return good
+	}
+	return bad
+}
+
+func expirationClass(e expiration.ExpirationStatus) string {
+	switch {
+	case e.Valid:
+		return good
+	case e.Expired:
+		return bad
+	}
+	return warn
+}
+
+func ocspClass(o ocsp.OCSP) string {
+	switch {
+	case o.Error != nil || o.Unknown:
+		return warn
+	case o.Revoked:
+		return bad
+	case !o.Fresh && !o.FreshnessUnknown:
+		return warn
+	}
+	return good
+}
+
+func ocspOutcome(o ocsp.OCSP) string {
+	switch {
+	case o.Error != nil:
+		return "error"
+	case o.Good:
+		return "good"
+	case o.Revoked:
+		return "revoked"
+	case o.Unknown:
+		return "unknown"
+	}
+	return "none"
+}
+
+func crlClass(c crl.CRL) string {
+	switch {
+	case c.Error != nil:
+		return warn
+	case c.Revoked:
+		return bad
+	case !c.Fresh && !c.FreshnessUnknown:
+		return warn
+	}
+	return good
+}
+
+func crlOutcome(c crl.CRL) string {
+	switch {
+	case c.Error != nil:
+		return "error"
+	case c.Revoked:
+		return "revoked"
+	}
+	return "not revoked"
+}
+
+var funcs = template.FuncMap{
+	"verdictClass":    verdictClass,
+	"expirationClass": expirationClass,
+	"ocspClass":       ocspClass,
+	"ocspOutcome":     ocspOutcome,
+	"crlClass":        crlClass,
+	"crlOutcome":      crlOutcome,
+	"determinable": func(c model.CertificateResult) bool {
+		return c.RevocationDeterminable != nil && *c.RevocationDeterminable
+	},
+	"pemURL": func(cert *x509.Certificate) template.URL {
+		return template.URL("data:application/x-pem-file;base64," + base64.StdEncoding.EncodeToString([]byte(PEM(cert))))
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>CACop report for {{.Result.SubjectURL}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+ul.tree, ul.tree ul { list-style: none; padding-left: 1.5em; border-left: 2px solid #ccc; }
+.certificate { margin: 0.5em 0; padding: 0.5em 1em; border: 1px solid #ccc; border-radius: 4px; }
+.good { color: #1a7f37; }
+.bad { color: #cf222e; }
+.warn { color: #9a6700; }
+.badge { font-weight: bold; text-transform: uppercase; }
+table { border-collapse: collapse; }
+td, th { text-align: left; padding: 0.1em 1em 0.1em 0; vertical-align: top; }
+code, pre { font-family: monospace; font-size: 0.9em; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Result.SubjectURL}}</h1>
+<p>Verdict: <span class="badge {{verdictClass .Verdict}}">{{.Verdict}}</span></p>
+<table>
+<tr><th>Verified at</th><td>{{.Result.Chain.VerificationTime.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{with .Result.Chain.Usage}}<tr><th>Usage</th><td>{{.}}</td></tr>{{end}}
+{{with .Result.Hostname}}<tr><th>Hostname</th><td>{{if .Matched}}<span class="{{if .CommonNameFallback}}warn{{else}}good{{end}}">matches</span> <code>{{.Name}}</code>{{if .CommonNameFallback}} (common name fallback, deprecated){{end}}{{else}}<span class="bad">mismatch</span>: {{.Reason}}{{end}}</td></tr>{{end}}
+{{if and .Result.MustStapleViolated (not .Result.Staple)}}<tr><th>Stapled OCSP</th><td><span class="bad">none</span>, though the leaf is Must-Staple</td></tr>{{end}}
+{{with .Result.Staple}}<tr><th>Stapled OCSP</th><td><span class="{{ocspClass .OCSP}}">{{ocspOutcome .OCSP}}</span>{{if .Error}}{{else if .FreshnessUnknown}} (freshness not evaluable at a past time){{else if not .Fresh}} (stale){{end}}{{with .Error}}: {{.}}{{end}}{{with .Mismatched}}, unlike <code>{{join . ", "}}</code>{{end}}</td></tr>{{end}}
+<tr><th>Valid policies</th><td>{{with .Result.Chain.Constraints.ValidPolicies}}<code>{{join . ", "}}</code>{{else}}<span class="{{if .Result.Chain.Constraints.ExplicitPolicyRequired}}bad{{else}}warn{{end}}">none</span>{{end}}{{if .Result.Chain.Constraints.ExplicitPolicyRequired}} (explicit policy required){{end}}</td></tr>
+{{with .Result.Chain.Precertificate}}<tr><th>Precertificate</th><td><code>{{.Fingerprint}}</code> {{if .Matches}}<span class="good">matches the leaf</span>{{else}}<span class="bad">does not match the leaf</span>: {{join .Inconsistencies "; "}}{{end}}</td></tr>{{end}}
+{{with .Result.Chain.EV}}{{if .Enabled}}<tr><th>EV treatment</th><td>{{if .Treatment}}<span class="good">yes</span> under <code>{{.Policy}}</code>{{else}}<span class="bad">no</span>, though the root is enabled for <code>{{join .Enabled ", "}}</code>{{end}}</td></tr>{{end}}{{end}}
+<tr><th>Root inclusion</th><td>{{.Result.Chain.Inclusion.Status}}{{with .Result.Chain.Inclusion.Label}} ({{.}}){{end}}</td></tr>
+{{with .Result.Chain.PathValidation}}<tr><th>Path validation (vfychain)</th><td><span class="{{if .Good}}good{{else}}bad{{end}}">{{.Status}}</span>{{with .NSSError}} <code>{{.}}</code>{{end}}{{with .Revocation}} with {{join . ", "}} checking{{end}}</td></tr>{{end}}
+{{with .Result.Chain.GoValidation}}<tr><th>Path validation (Go)</th><td><span class="{{if .Valid}}good{{else}}bad{{end}}">{{if .Valid}}valid{{else}}invalid{{end}}</span>{{with .Reason}} {{.}}{{end}}</td></tr>{{end}}
+{{with .Result.CorrelationID}}<tr><th>Correlation ID</th><td><code>{{.}}</code></td></tr>{{end}}
+</table>
+{{with .Result.Chain.PathValidation.Raw}}<details><summary>vfychain output</summary><pre>{{.}}</pre></details>{{end}}
+<h2>Chain</h2>
+<ul class="tree">{{template "node" .Tree}}</ul>
+</body>
+</html>
+{{define "node"}}<li>
+<div class="certificate" id="{{lower .Role}}-{{.Cert.Fingerprint}}">
+<h3>{{.Role}}: {{with .Cert.CommonName}}{{.}}{{else}}<em>no common name</em>{{end}}</h3>
+<table>
+<tr><th>SHA-256</th><td><code>{{.Cert.Fingerprint}}</code></td></tr>
+{{with .Cert.Certificate}}<tr><th>Subject</th><td>{{.Subject}}</td></tr>
+<tr><th>Issuer</th><td>{{.Issuer}}</td></tr>
+<tr><th>Serial</th><td><code>{{printf "%X" .SerialNumber}}</code></td></tr>
+<tr><th>Validity</th><td>{{.NotBefore.UTC.Format "2006-01-02"}} to {{.NotAfter.UTC.Format "2006-01-02"}}</td></tr>
+{{with .DNSNames}}<tr><th>DNS names</th><td>{{join . ", "}}</td></tr>{{end}}
+<tr><th>Signature</th><td>{{.SignatureAlgorithm}}</td></tr>{{end}}
+{{range .Cert.Findings}}<tr><th>Finding</th><td><span class="bad">{{.}}</span></td></tr>{{end}}
+{{if .Cert.MustStaple}}<tr><th>TLS Feature</th><td>Must-Staple</td></tr>{{end}}
+{{with .Cert.Expiration}}<tr><th>certutil</th><td><span class="{{expirationClass .}}">{{.Status}}</span>{{with .NSSError}} <code>{{.}}</code>{{end}} (trust <code>{{.Trust}}</code>)</td></tr>{{end}}
+{{range .Cert.OCSP}}<tr><th>OCSP</th><td><span class="{{ocspClass .}}">{{ocspOutcome .}}</span> from <code>{{.Responder}}</code>{{if .Error}}{{else if .FreshnessUnknown}} (freshness not evaluable at a past time){{else if not .Fresh}} (stale){{end}}{{with .Error}}: {{.}}{{end}}</td></tr>{{end}}
+{{range .Cert.CRL}}<tr><th>CRL</th><td><span class="{{crlClass .}}">{{crlOutcome .}}</span> per <code>{{.Endpoint}}</code>{{if .Inherited}} (its issuer's){{end}}{{if eq .Scope "ca"}} (ARL){{end}}{{if .Partial}} (some reasons only){{end}}{{if .Error}}{{else if .FreshnessUnknown}} (freshness not evaluable at a past time){{else if not .Fresh}} (stale){{end}}{{with .Error}}: {{.}}{{end}}</td></tr>{{end}}
+{{if eq .Role "Intermediate"}}<tr><th>Revocation</th><td>{{if determinable .Cert}}<span class="good">determinable</span>{{else}}<span class="bad">not determinable</span>{{end}}</td></tr>{{end}}
+</table>
+{{with .Cert.Expiration.Raw}}<details><summary>certutil output</summary><pre>{{.}}</pre></details>{{end}}
+{{with .Cert.Certificate}}<p><a download="{{lower $.Role}}.pem" href="{{pemURL .}}">Download PEM</a></p>{{end}}
+</div>
+{{with .Child}}<ul>{{template "node" .}}</ul>{{end}}
+</li>{{end}}
+`))
@@ -0,0 +1,388 @@
+package report
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/ct"
+	"github.com/christopher-henderson/CACop/ev"
+	"github.com/christopher-henderson/CACop/expiration"
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/hostname"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/revocation/crl"
+	"github.com/christopher-henderson/CACop/revocation/ocsp"
+)
+
+func selfSigned(t *testing.T, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// revokedResult is a result whose leaf was revoked according to its CRL
+// while its OCSP responder could not be reached. The intermediate is not
+// revoked according to its root's ARL.
+func revokedResult(t *testing.T) model.TestWebsiteResult {
+	leaf := model.NewCeritifcateResult(selfSigned(t, "revoked.example.com"),
+		[]ocsp.OCSP{{Responder: "http://ocsp.example.com", Error: errors.New("connection refused")}},
+		[]crl.CRL{{Endpoint: "http://crl.example.com/ca.crl", Revoked: true, Fresh: true}},
+		expiration.ExpirationStatus{Valid: true, Status: certutil.StatusValid, Raw: "certutil: certificate is valid"})
+	intermediate := model.NewCeritifcateResult(selfSigned(t, "Example Intermediate <CA>"), nil,
+		[]crl.CRL{{Endpoint: "http://crl.example.com/root.crl", Scope: crl.Authorities, Fresh: true}},
+		expiration.ExpirationStatus{Valid: true, Status: certutil.StatusValid})
+	root := model.NewCeritifcateResult(selfSigned(t, "Example Root"), nil, nil,
+		expiration.ExpirationStatus{Valid: true, Status: certutil.StatusValid, Trust: certutil.TrustedRoot})
+	return model.TestWebsiteResult{
+		SubjectURL: "https://revoked.example.com",
+		Chain: model.ChainResult{
+			Leaf:             leaf,
+			Intermediates:    []model.CertificateResult{intermediate},
+			Root:             root,
+			VerificationTime: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		CorrelationID: "abc123",
+	}
+}
+
+func TestHTML(t *testing.T) {
+	result := revokedResult(t)
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	html := b.String()
+	for _, want := range []string{
+		`<span class="badge bad">revoked</span>`,
+		`<span class="bad">revoked</span> per <code>http://crl.example.com/ca.crl</code>`,
+		`<span class="warn">error</span> from <code>http://ocsp.example.com</code>`,
+		`<details><summary>certutil output</summary><pre>certutil: certificate is valid</pre></details>`,
+		`download="leaf.pem" href="data:application/x-pem-file;base64,`,
+		"Example Intermediate &lt;CA&gt;",
+		"abc123",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q within the report", want)
+		}
+	}
+	// The root is drawn first, with the leaf nested the deepest.
+	root := strings.Index(html, "Root: Example Root")
+	intermediate := strings.Index(html, "Intermediate: Example Intermediate")
+	leaf := strings.Index(html, "Leaf: revoked.example.com")
+	if !(root < intermediate && intermediate < leaf) {
+		t.Errorf("expected the chain to be drawn root first, got %d, %d, %d", root, intermediate, leaf)
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "<link") {
+		t.Error("the report ought to be self contained")
+	}
+}
+
+func TestHTMLWithoutCertificates(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.Leaf.Certificate = nil
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), `download="leaf.pem"`) {
+		t.Error("there is no PEM to download without the certificate")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	result := revokedResult(t)
+	var b bytes.Buffer
+	if err := Markdown(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	md := b.String()
+	for _, want := range []string{
+		"## https://revoked.example.com: revoked\n",
+		"| Leaf | revoked.example.com | `" + result.Chain.Leaf.Fingerprint + "` |\n",
+		"| Intermediate | Example Intermediate <CA> |",
+		"- Leaf revoked.example.com: OCSP responder http://ocsp.example.com failed: connection refused\n",
+		"- Leaf revoked.example.com: revoked according to CRL http://crl.example.com/ca.crl\n",
+		"Correlation ID `abc123`.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q within\n%s", want, md)
+		}
+	}
+}
+
+func TestIncompatibleUsage(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.Usage = certutil.SMIME
+	intermediate := result.Chain.Intermediates[0]
+	result.Chain.GoValidation.IncompatibleUsage = []certutil.Fingerprint{intermediate.Fingerprint}
+	var b bytes.Buffer
+	if err := Markdown(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	md := b.String()
+	for _, want := range []string{
+		"Verified at 2019-01-02T03:04:05Z for smime against",
+		"- Intermediate Example Intermediate <CA>: extended key usage does not permit smime\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q within\n%s", want, md)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	result := revokedResult(t)
+	var b bytes.Buffer
+	if err := Text(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	text := b.String()
+	if strings.ContainsAny(text, "`|#") {
+		t.Errorf("unexpected markup within\n%s", text)
+	}
+	for _, want := range []string{
+		"https://revoked.example.com: revoked\n=====",
+		"  * Root Example Root\n    SHA-256 " + result.Chain.Root.Fingerprint + "\n",
+		"  * Leaf revoked.example.com: revoked according to CRL http://crl.example.com/ca.crl\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q within\n%s", want, text)
+		}
+	}
+}
+
+func TestChecks(t *testing.T) {
+	valid := revokedResult(t)
+	valid.SubjectURL = "https://valid.example.com"
+	valid.Chain.Leaf.OCSP = nil
+	valid.Chain.Leaf.CRL = nil
+	checks := []Check{
+		{Expected: model.Valid, Result: valid},
+		{Expected: model.Expired, Result: model.TestWebsiteResult{SubjectURL: "https://expired.example.com"}, Error: errors.New("connection refused")},
+		{Expected: model.Revoked, Result: revokedResult(t)},
+	}
+	var b bytes.Buffer
+	if err := ChecksMarkdown(&b, checks); err != nil {
+		t.Fatal(err)
+	}
+	md := b.String()
+	for _, want := range []string{
+		"2 of 3 test websites had the expected outcome.",
+		"| https://valid.example.com | valid | valid | PASS |\n",
+		"| https://expired.example.com | expired | unreachable | FAIL |\n",
+		"| https://revoked.example.com | revoked | revoked | PASS |\n",
+		"### https://valid.example.com: valid\n",
+		"Every check passed.\n",
+		"### https://expired.example.com\n\nconnection refused\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q within\n%s", want, md)
+		}
+	}
+	b.Reset()
+	if err := ChecksText(&b, checks); err != nil {
+		t.Fatal(err)
+	}
+	if want := "  * FAIL https://expired.example.com: expected expired, got unreachable\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within\n%s", want, b.String())
+	}
+}
+
+func TestStaple(t *testing.T) {
+	result := revokedResult(t)
+	result.Staple = &ocsp.Staple{OCSP: ocsp.OCSP{Good: true, Fresh: true}, Mismatched: []string{"http://ocsp.example.com"}}
+	findings := strings.Join(Findings(result), "\n")
+	want := "Leaf revoked.example.com: stapled OCSP response says good whereas OCSP responder http://ocsp.example.com does not"
+	if !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<th>Stapled OCSP</th><td><span class="good">good</span>, unlike <code>http://ocsp.example.com</code>`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestPastTime(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.Leaf.CRL = []crl.CRL{{Endpoint: "http://crl.example.com/ca.crl", FreshnessUnknown: true}}
+	findings := strings.Join(Findings(result), "\n")
+	if strings.Contains(findings, "stale") {
+		t.Errorf("expected a CRL issued after the verification time not to be stale, got\n%s", findings)
+	}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<code>http://crl.example.com/ca.crl</code> (freshness not evaluable at a past time)`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestMustStapleViolated(t *testing.T) {
+	result := revokedResult(t)
+	result.Handshake.Version = "TLS 1.3"
+	result.Chain.Leaf.MustStaple = true
+	findings := strings.Join(Findings(result), "\n")
+	if want := "Leaf revoked.example.com: Must-Staple requires a valid stapled OCSP response"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<span class="bad">none</span>, though the leaf is Must-Staple`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestHostname(t *testing.T) {
+	result := revokedResult(t)
+	result.Hostname = &hostname.Result{Host: "revoked.example.com", Reason: "revoked.example.com is not among the DNS names of the leaf"}
+	findings := strings.Join(Findings(result), "\n")
+	if want := "Leaf revoked.example.com: hostname mismatch: revoked.example.com is not among the DNS names of the leaf"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	result.Hostname = &hostname.Result{Host: "revoked.example.com", Matched: true, Name: "revoked.example.com", CommonNameFallback: true}
+	findings = strings.Join(Findings(result), "\n")
+	if want := "matches revoked.example.com only by its common name"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<span class="warn">matches</span> <code>revoked.example.com</code> (common name fallback, deprecated)`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestConstraintFindings(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.Leaf.Findings = []string{"dns revoked.example.org is not permitted by the name constraints of Example Intermediate <CA>"}
+	findings := strings.Join(Findings(result), "\n")
+	if want := "Leaf revoked.example.com: dns revoked.example.org is not permitted"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<tr><th>Finding</th><td><span class="bad">dns revoked.example.org is not permitted`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestEV(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.EV = ev.Result{Enabled: []string{"2.23.140.1.1"}, Policy: "2.23.140.1.1", Treatment: true}
+	var b bytes.Buffer
+	if err := Markdown(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := "It receives EV treatment under `2.23.140.1.1`."; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within\n%s", want, b.String())
+	}
+	result.Chain.EV.Treatment = false
+	b.Reset()
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<span class="bad">no</span>, though the root is enabled for <code>2.23.140.1.1</code>`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestPrecertificate(t *testing.T) {
+	result := revokedResult(t)
+	result.Chain.Precertificate = &ct.Comparison{Fingerprint: "AB:CD", Inconsistencies: []string{"the validity period differs"}}
+	findings := strings.Join(Findings(result), "\n")
+	if want := "Leaf revoked.example.com: does not match precertificate AB:CD: the validity period differs"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	result.Chain.Precertificate = &ct.Comparison{Fingerprint: "AB:CD", Matches: true}
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<code>AB:CD</code> <span class="good">matches the leaf</span>`; !strings.Contains(b.String(), want) {
+		t.Errorf("expected %q within the report", want)
+	}
+}
+
+func TestRevocationDeterminable(t *testing.T) {
+	result := revokedResult(t)
+	var b bytes.Buffer
+	if err := HTML(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`per <code>http://crl.example.com/root.crl</code> (ARL)`,
+		`<tr><th>Revocation</th><td><span class="good">determinable</span>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %q within the report", want)
+		}
+	}
+	result.Chain.Intermediates[0] = model.NewCeritifcateResult(result.Chain.Intermediates[0].Certificate, nil,
+		[]crl.CRL{{Endpoint: "http://crl.example.com/root.crl", Error: errors.New("the CRL only covers end entity certificates, so it says nothing of this CA")}},
+		expiration.ExpirationStatus{Valid: true, Status: certutil.StatusValid})
+	findings := strings.Join(Findings(result), "\n")
+	if want := "Intermediate Example Intermediate <CA>: revocation status cannot be determined"; !strings.Contains(findings, want) {
+		t.Errorf("expected %q within\n%s", want, findings)
+	}
+	if strings.Contains(findings, "no CRL distribution point") {
+		t.Errorf("unexpected complaint of a missing distribution point within\n%s", findings)
+	}
+}
+
+func TestMarkdownEscaping(t *testing.T) {
+	result := revokedResult(t)
+	result.SubjectURL = "https://revoked.example.com/?a|b"
+	result.Chain.Leaf.CommonName = "[click](https://evil.example.com)\n# heading"
+	checks := []Check{{Expected: model.Revoked, Result: result}}
+	var b bytes.Buffer
+	if err := ChecksMarkdown(&b, checks); err != nil {
+		t.Fatal(err)
+	}
+	md := b.String()
+	for _, want := range []string{
+		"| https://revoked.example.com/?a\\|b | revoked | revoked | PASS |\n",
+		"| Leaf | \\[click\\](https://evil.example.com) # heading | `",
+		"- Leaf \\[click\\](https://evil.example.com) # heading: revoked according to CRL",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q within\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "\n# heading") {
+		t.Errorf("a newline within a name broke the markup\n%s", md)
+	}
+}
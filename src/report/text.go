@@ -0,0 +1,321 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/truststore"
+)
+
+// Check is the outcome of one of the test websites that Mozilla requires a CA
+// to host, judged against the verdict that the website ought to have.
+type Check struct {
+	Expected model.Verdict
+	Result   model.TestWebsiteResult
+	// Error is set when the website could not be verified at all.
+	Error error
+}
+
+func (c Check) MarshalJSON() ([]byte, error) {
+	var err string
+	if c.Error != nil {
+		err = c.Error.Error()
+	}
+	return json.Marshal(struct {
+		Expected model.Verdict
+		Verdict  model.Verdict
+		Passed   bool
+		Result   model.TestWebsiteResult
+		Error    string `json:",omitempty"`
+	}{c.Expected, c.Verdict(), c.Passed(), c.Result, err})
+}
+
+func (c Check) Verdict() model.Verdict {
+	if c.Error != nil {
+		return ""
+	}
+	return c.Result.Verdict()
+}
+
+func (c Check) Passed() bool {
+	return c.Error == nil && c.Verdict() == c.Expected
+}
+
+// style is the markup that differs between the Markdown and plain text reports.
+type style struct {
+	heading func(level int, s string) string
+	code    func(s string) string
+	// escape keeps text from the subject and its certificates, such as
+	// names and findings, from being taken as markup or breaking the line.
+	escape func(s string) string
+	bullet string
+	table  bool
+}
+
+var markdown = style{
+	heading: func(level int, s string) string {
+		return strings.Repeat("#", level+1) + " " + s
+	},
+	code: func(s string) string {
+		return "`" + s + "`"
+	},
+	escape: strings.NewReplacer(`\`, `\\`, "|", `\|`, "[", `\[`, "]", `\]`, "\r\n", " ", "\n", " ", "\r", " ").Replace,
+	bullet: "- ",
+	table:  true,
+}
+
+var plain = style{
+	heading: func(level int, s string) string {
+		underline := "="
+		if level > 1 {
+			underline = "-"
+		}
+		return s + "\n" + strings.Repeat(underline, len(s))
+	},
+	code: func(s string) string {
+		return s
+	},
+	escape: strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace,
+	bullet: "  * ",
+}
+
+// Markdown writes a summary of the result suited to a Bugzilla comment.
+func Markdown(w io.Writer, result model.TestWebsiteResult) error {
+	return markdown.result(w, result, 1)
+}
+
+// Text writes a plain text summary of the result.
+func Text(w io.Writer, result model.TestWebsiteResult) error {
+	return plain.result(w, result, 1)
+}
+
+// ChecksMarkdown writes a summary of the checks suited to a Bugzilla comment.
+func ChecksMarkdown(w io.Writer, checks []Check) error {
+	return markdown.checks(w, checks)
+}
+
+// ChecksText writes a plain text summary of the checks.
+func ChecksText(w io.Writer, checks []Check) error {
+	return plain.checks(w, checks)
+}
+
+func (s style) checks(w io.Writer, checks []Check) error {
+	b := bufio.NewWriter(w)
+	passed := 0
+	for _, c := range checks {
+		if c.Passed() {
+			passed++
+		}
+	}
+	fmt.Fprintf(b, "%s\n\n", s.heading(1, "Test websites"))
+	fmt.Fprintf(b, "%d of %d test websites had the expected outcome.\n\n", passed, len(checks))
+	if s.table {
+		b.WriteString("| Website | Expected | Actual | |\n|---|---|---|---|\n")
+	}
+	for _, c := range checks {
+		outcome := "FAIL"
+		if c.Passed() {
+			outcome = "PASS"
+		}
+		actual := string(c.Verdict())
+		if c.Error != nil {
+			actual = "unreachable"
+		}
+		if s.table {
+			fmt.Fprintf(b, "| %s | %s | %s | %s |\n", s.escape(c.Result.SubjectURL), c.Expected, actual, outcome)
+		} else {
+			fmt.Fprintf(b, "%s%s %s: expected %s, got %s\n", s.bullet, outcome, s.escape(c.Result.SubjectURL), c.Expected, actual)
+		}
+	}
+	for _, c := range checks {
+		b.WriteString("\n")
+		if c.Error != nil {
+			fmt.Fprintf(b, "%s\n\n%s\n", s.heading(2, s.escape(c.Result.SubjectURL)), s.escape(c.Error.Error()))
+			continue
+		}
+		if err := s.result(b, c.Result, 2); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+func (s style) result(w io.Writer, result model.TestWebsiteResult, level int) error {
+	b := bufio.NewWriter(w)
+	chain := result.Chain
+	fmt.Fprintf(b, "%s\n\n", s.heading(level, fmt.Sprintf("%s: %s", s.escape(result.SubjectURL), result.Verdict())))
+	fmt.Fprintf(b, "Verified at %s", chain.VerificationTime.UTC().Format(time.RFC3339))
+	if chain.Usage != "" {
+		fmt.Fprintf(b, " for %s", chain.Usage)
+	}
+	fmt.Fprintf(b, " against a root that is %s", chain.Inclusion.Status)
+	if chain.Inclusion.Label != "" {
+		fmt.Fprintf(b, " (%s)", s.escape(chain.Inclusion.Label))
+	}
+	b.WriteString(".")
+	switch ev := chain.EV; {
+	case ev.Treatment:
+		fmt.Fprintf(b, " It receives EV treatment under %s.", s.code(ev.Policy))
+	case len(ev.Enabled) != 0:
+		b.WriteString(" The root is enabled for EV, yet the chain does not receive EV treatment.")
+	}
+	if result.CorrelationID != "" {
+		fmt.Fprintf(b, " Correlation ID %s.", s.code(result.CorrelationID))
+	}
+	b.WriteString("\n\n")
+	certs := certificates(chain)
+	if s.table {
+		b.WriteString("| Certificate | Common name | SHA-256 fingerprint |\n|---|---|---|\n")
+		for _, c := range certs {
+			fmt.Fprintf(b, "| %s | %s | %s |\n", c.role, s.escape(c.CommonName), s.code(c.Fingerprint))
+		}
+	} else {
+		for _, c := range certs {
+			fmt.Fprintf(b, "%s%s %s\n%sSHA-256 %s\n", s.bullet, c.role, s.escape(c.CommonName), strings.Repeat(" ", len(s.bullet)), c.Fingerprint)
+		}
+	}
+	findings := Findings(result)
+	b.WriteString("\n")
+	if len(findings) == 0 {
+		b.WriteString("Every check passed.\n")
+		return b.Flush()
+	}
+	b.WriteString("Failing checks:\n\n")
+	for _, f := range findings {
+		fmt.Fprintf(b, "%s%s\n", s.bullet, s.escape(f))
+	}
+	return b.Flush()
+}
+
+type roleCertificate struct {
+	model.CertificateResult
+	role string
+}
+
+func certificates(chain model.ChainResult) []roleCertificate {
+	certs := []roleCertificate{{chain.Leaf, "Leaf"}}
+	for _, intermediate := range chain.Intermediates {
+		certs = append(certs, roleCertificate{intermediate, "Intermediate"})
+	}
+	return append(certs, roleCertificate{chain.Root, "Root"})
+}
+
+// Findings lists every check of the result that did not pass. For a test
+// website that is meant to be expired or revoked these are to be expected.
+func Findings(result model.TestWebsiteResult) []string {
+	var findings []string
+	chain := result.Chain
+	if chain.Inclusion.Status == truststore.Distrusted {
+		findings = append(findings, "Root: distrusted for certificates issued after its distrust date")
+	}
+	for _, c := range certificates(chain) {
+		name := c.role
+		if c.CommonName != "" {
+			name += " " + c.CommonName
+		}
+		for _, finding := range c.Findings {
+			findings = append(findings, fmt.Sprintf("%s: %s", name, finding))
+		}
+		for _, fingerprint := range chain.GoValidation.IncompatibleUsage {
+			if fingerprint == c.Fingerprint {
+				findings = append(findings, fmt.Sprintf("%s: extended key usage does not permit %s", name, chain.Usage))
+			}
+		}
+		if e := c.Expiration; !e.Valid && e.Status != certutil.StatusUnrecognized {
+			finding := fmt.Sprintf("%s: certutil reports %s", name, e.Status)
+			if e.NSSError != "" {
+				finding += " (" + e.NSSError + ")"
+			}
+			findings = append(findings, finding)
+		}
+		for _, o := range c.OCSP {
+			switch {
+			case o.Error != nil:
+				findings = append(findings, fmt.Sprintf("%s: OCSP responder %s failed: %s", name, o.Responder, firstLine(o.Error.Error())))
+			case o.Revoked:
+				findings = append(findings, fmt.Sprintf("%s: revoked according to OCSP responder %s", name, o.Responder))
+			case o.Unknown:
+				findings = append(findings, fmt.Sprintf("%s: OCSP responder %s does not know of the certificate", name, o.Responder))
+			case !o.Fresh && !o.FreshnessUnknown:
+				findings = append(findings, fmt.Sprintf("%s: stale response from OCSP responder %s", name, o.Responder))
+			}
+		}
+		for _, crl := range c.CRL {
+			switch {
+			case crl.Error != nil:
+				findings = append(findings, fmt.Sprintf("%s: CRL %s failed: %s", name, crl.Endpoint, firstLine(crl.Error.Error())))
+			case crl.Revoked:
+				findings = append(findings, fmt.Sprintf("%s: revoked according to CRL %s", name, crl.Endpoint))
+			case !crl.Fresh && !crl.FreshnessUnknown:
+				findings = append(findings, fmt.Sprintf("%s: stale CRL %s", name, crl.Endpoint))
+			case crl.Partial:
+				findings = append(findings, fmt.Sprintf("%s: CRL %s covers only some revocation reasons", name, crl.Endpoint))
+			}
+		}
+		if d := c.RevocationDeterminable; c.role == "Intermediate" && d != nil && !*d {
+			finding := fmt.Sprintf("%s: revocation status cannot be determined, as neither its issuer's CRL nor any OCSP responder gives it", name)
+			if len(c.CRL) == 0 {
+				finding += "; neither it nor its issuer names a CRL distribution point"
+			}
+			findings = append(findings, finding)
+		}
+	}
+	leaf := "Leaf"
+	if chain.Leaf.CommonName != "" {
+		leaf += " " + chain.Leaf.CommonName
+	}
+	if h := result.Hostname; h != nil && !h.Matched {
+		findings = append(findings, fmt.Sprintf("%s: hostname mismatch: %s", leaf, h.Reason))
+	}
+	if h := result.Hostname; h != nil && h.CommonNameFallback {
+		findings = append(findings, fmt.Sprintf("%s: matches %s only by its common name, a deprecated fallback that browsers no longer honour", leaf, h.Host))
+	}
+	if result.MustStapleViolated() {
+		findings = append(findings, fmt.Sprintf("%s: Must-Staple requires a valid stapled OCSP response, without which Firefox refuses the connection", leaf))
+	}
+	if staple := result.Staple; staple != nil {
+		name := leaf
+		switch {
+		case staple.Error != nil:
+			findings = append(findings, fmt.Sprintf("%s: stapled OCSP response is invalid: %s", name, firstLine(staple.Error.Error())))
+		case staple.Revoked:
+			findings = append(findings, fmt.Sprintf("%s: revoked according to the stapled OCSP response", name))
+		case staple.Unknown:
+			findings = append(findings, fmt.Sprintf("%s: stapled OCSP response does not know of the certificate", name))
+		case !staple.Fresh && !staple.FreshnessUnknown:
+			findings = append(findings, fmt.Sprintf("%s: stale stapled OCSP response", name))
+		}
+		for _, responder := range staple.Mismatched {
+			findings = append(findings, fmt.Sprintf("%s: stapled OCSP response says %s whereas OCSP responder %s does not", name, staple.Status(), responder))
+		}
+	}
+	if p := chain.Precertificate; p != nil {
+		for _, inconsistency := range p.Inconsistencies {
+			findings = append(findings, fmt.Sprintf("%s: does not match precertificate %s: %s", leaf, p.Fingerprint, inconsistency))
+		}
+	}
+	if p := chain.PathValidation; !p.Good && (p.Status != certutil.StatusUnrecognized || p.Error != nil) {
+		finding := fmt.Sprintf("vfychain reports %s", p.Status)
+		if p.NSSError != "" {
+			finding += " (" + p.NSSError + ")"
+		}
+		findings = append(findings, finding)
+	}
+	if g := chain.GoValidation; !g.Valid && g.Reason != "" {
+		findings = append(findings, "Go reports "+firstLine(g.Reason))
+	}
+	return findings
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package crl
+
+import (
+	"crypto/x509/pkix"
+	"sync"
+	"time"
+)
+
+// CacheLifetime is the longest that a CRL is reused before being fetched
+// again. A CRL is never reused beyond its nextUpdate. It is kept short, as a
+// certificate revoked since the CRL was fetched goes unnoticed for as long.
+var CacheLifetime = 5 * time.Minute
+
+type cached struct {
+	list    *pkix.CertificateList
+	expires time.Time
+}
+
+// cache holds recently fetched CRLs by distribution point, as the same CRL is
+// usually shared by every certificate that a CA issues.
+type cache struct {
+	lock    sync.Mutex
+	entries map[string]cached
+}
+
+var crls = &cache{entries: make(map[string]cached)}
+
+func (c *cache) get(distributionPoint string, now time.Time) (*pkix.CertificateList, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[distributionPoint]
+	if !ok {
+		cacheRequests.With("crl", "miss").Inc()
+		return nil, false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, distributionPoint)
+		cacheRequests.With("crl", "miss").Inc()
+		return nil, false
+	}
+	cacheRequests.With("crl", "hit").Inc()
+	return entry.list, true
+}
+
+// put keeps the CRL until whichever comes first of its nextUpdate and
+// CacheLifetime from now.
+func (c *cache) put(distributionPoint string, list *pkix.CertificateList, now time.Time) {
+	expires := now.Add(CacheLifetime)
+	if next := list.TBSCertList.NextUpdate; !next.IsZero() && next.Before(expires) {
+		expires = next
+	}
+	if !now.Before(expires) {
+		// Already stale, so every query ought to see whether it has since been refreshed.
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[distributionPoint] = cached{list, expires}
+}
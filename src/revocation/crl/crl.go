@@ -1,61 +1,185 @@
 package crl
 
 import (
+	"bytes"
+	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/metrics"
+	"github.com/christopher-henderson/CACop/revocation"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"io/ioutil"
-	"math/big"
 	"net/http"
+	"time"
 )
 
 type CRL struct {
 	Endpoint string
-	Revoked  bool
-	Error    error
+	// Scope is which certificates the CRL covers, one of all, end-entity,
+	// ca or attribute, as given by its issuing distribution point.
+	Scope string `json:",omitempty"`
+	// Partial is set when the CRL covers only some revocation reasons.
+	Partial bool `json:",omitempty"`
+	// Inherited is set when the certificate names no distribution point of
+	// its own and the CRL was found at one of its issuer's instead.
+	Inherited  bool `json:",omitempty"`
+	Revoked    bool
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	Fresh      bool
+	// FreshnessUnknown is set when verifying at a time before the CRL was
+	// issued, at which its freshness cannot be evaluated.
+	FreshnessUnknown bool `json:",omitempty"`
+	Error            error
 }
 
-func VerifyChain(chain []*x509.Certificate) [][]CRL {
+// Determines reports whether the CRL gives the status of the certificate,
+// that is whether it was retrieved, is signed by the certificate's issuer,
+// covers the certificate and is fresh, or cannot be judged stale.
+func (c CRL) Determines() bool {
+	return c.Error == nil && (c.Fresh || c.FreshnessUnknown) && !c.Partial
+}
+
+var (
+	fetches = metrics.NewCounterVec("cacop_crl_fetches_total",
+		"CRL downloads by distribution point host and result.",
+		"host", "result")
+	fetchDuration = metrics.NewHistogramVec("cacop_crl_fetch_duration_seconds",
+		"Time taken to download CRLs, by distribution point host.",
+		metrics.DurationBuckets, "host")
+	size = metrics.NewHistogramVec("cacop_crl_size_bytes",
+		"Size of downloaded CRLs, by distribution point host.",
+		metrics.SizeBuckets, "host")
+	cacheRequests = metrics.NewCounterVec("cacop_cache_requests_total",
+		"Lookups of cached revocation information by cache and whether they hit or missed.",
+		"cache", "result")
+)
+
+// VerifyChain checks every certificate in the chain against its CRL distribution
+// points, which for an intermediate are those of its parent's CRL or ARL. Each
+// CRL must be signed by the certificate's issuer, the next in the chain, and
+// cover the certificate. The freshness of each CRL is evaluated at the given
+// time, or now if the time is zero.
+func VerifyChain(ctx context.Context, chain []*x509.Certificate, at time.Time) [][]CRL {
 	crls := make([][]CRL, len(chain))
 	for i, cert := range chain {
-		crls[i] = queryCRLs(cert)
+		issuer := cert
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		}
+		crls[i] = queryCRLs(ctx, cert, issuer, at)
 	}
 	return crls
 }
 
-func queryCRLs(certificate *x509.Certificate) []CRL {
-	statuses := make([]CRL, len(certificate.CRLDistributionPoints))
-	for i, url := range certificate.CRLDistributionPoints {
-		statuses[i] = newCRL(certificate.SerialNumber, url)
+// queryCRLs checks the certificate against each of its distribution points.
+// An intermediate that names none falls back to those of a root that issued
+// it, as a root may name the ARL that it publishes for every CA it has issued.
+// Those of any other issuer lead to its parent's CRL, which says nothing of
+// the intermediate, so they are not tried.
+func queryCRLs(ctx context.Context, certificate, issuer *x509.Certificate, at time.Time) []CRL {
+	distributionPoints := certificate.CRLDistributionPoints
+	inherited := len(distributionPoints) == 0 && certificate.IsCA && issuer != certificate && selfSigned(issuer)
+	if inherited {
+		distributionPoints = issuer.CRLDistributionPoints
+	}
+	statuses := make([]CRL, len(distributionPoints))
+	for i, url := range distributionPoints {
+		statuses[i] = newCRL(ctx, certificate, issuer, url, at)
+		statuses[i].Inherited = inherited
 	}
 	return statuses
 }
 
-func newCRL(serialNumber *big.Int, distributionPoint string) (crl CRL) {
-	raw, err := http.Get(distributionPoint)
+func newCRL(ctx context.Context, certificate, issuer *x509.Certificate, distributionPoint string, at time.Time) (crl CRL) {
 	crl.Endpoint = distributionPoint
+	c, err := fetch(ctx, distributionPoint)
 	if err != nil {
-		crl.Error = errors.Wrapf(err, "failed to retrieve CRL from distribution point %v", distributionPoint)
+		crl.Error = err
 		return
 	}
-	defer raw.Body.Close()
-	b, err := ioutil.ReadAll(raw.Body)
-	if err != nil {
-		crl.Error = errors.Wrapf(err, "failed to read response from CRL distribution point %v", distributionPoint)
+	if err := issuer.CheckCRLSignature(c); err != nil {
+		crl.Error = errors.Wrapf(err, "the CRL is not signed by %s", issuer.Subject.CommonName)
+		return
 	}
-	c, err := x509.ParseCRL(b)
+	s, err := scopeOf(c)
 	if err != nil {
-		crl.Error = errors.Wrapf(err, "failed to parse provided CRL\n%v", raw)
+		crl.Error = err
 		return
 	}
+	crl.Scope = s.certificates
+	crl.Partial = s.partial
+	if err := s.covers(certificate, distributionPoint); err != nil {
+		crl.Error = err
+		return
+	}
+	serialNumber := certificate.SerialNumber
+	crl.ThisUpdate = c.TBSCertList.ThisUpdate
+	crl.NextUpdate = c.TBSCertList.NextUpdate
+	crl.Fresh = revocation.Fresh(crl.ThisUpdate, crl.NextUpdate, at)
+	crl.FreshnessUnknown = !revocation.Evaluable(crl.ThisUpdate, at)
 	if c.TBSCertList.RevokedCertificates == nil {
 		crl.Revoked = false
 		return
 	}
 	for _, revoked := range c.TBSCertList.RevokedCertificates {
 		if revoked.SerialNumber.Cmp(serialNumber) == 0 {
-			crl.Revoked = true
+			// A revocation after the time of verification had yet to happen.
+			crl.Revoked = revocation.Effective(revoked.RevocationTime, at)
 			break
 		}
 	}
 	return
 }
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// fetch retrieves the CRL from the distribution point, unless it was recently
+// retrieved and is yet to reach its nextUpdate.
+func fetch(ctx context.Context, distributionPoint string) (c *pkix.CertificateList, err error) {
+	log := logging.FromContext(ctx).WithField("endpoint", distributionPoint)
+	now := time.Now()
+	if c, ok := crls.get(distributionPoint, now); ok {
+		log.Debug("CRL found in cache")
+		return c, nil
+	}
+	host := metrics.Host(distributionPoint)
+	var length int
+	defer func() {
+		fetchDuration.With(host).ObserveSince(now)
+		log = log.WithFields(logrus.Fields{"duration": time.Since(now).Seconds(), "size": length})
+		result := "ok"
+		if err != nil {
+			result = "error"
+			log.WithError(err).Warn("CRL download failed")
+		} else {
+			log.Debug("CRL downloaded")
+		}
+		fetches.With(host, result).Inc()
+	}()
+	req, err := http.NewRequest(http.MethodGet, distributionPoint, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a request for distribution point %v", distributionPoint)
+	}
+	raw, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to retrieve CRL from distribution point %v", distributionPoint)
+	}
+	defer raw.Body.Close()
+	b, err := ioutil.ReadAll(raw.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read response from CRL distribution point %v", distributionPoint)
+	}
+	length = len(b)
+	size.With(host).Observe(float64(length))
+	c, err = x509.ParseCRL(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse provided CRL\n%v", raw)
+	}
+	crls.put(distributionPoint, c, now)
+	return c, nil
+}
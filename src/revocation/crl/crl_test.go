@@ -1,42 +1,283 @@
 package crl
 
 import (
-	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
-	"encoding/pem"
-	"io/ioutil"
-	"os"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/url"
 	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/pkitest"
 )
 
-var revoked = `/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/AffirmTrust Premium/revoked`
+func TestVerifyChain(t *testing.T) {
+	p := pkitest.NewT(t)
+	for leaf, revoked := range map[*pkitest.Leaf]bool{p.Valid: false, p.Expired: false, p.Revoked: true} {
+		crls := VerifyChain(context.Background(), leaf.Chain, time.Time{})
+		if len(crls) != 3 {
+			t.Fatalf("expected a status for each of the 3 certificates, got %d", len(crls))
+		}
+		if len(crls[0]) != 1 {
+			t.Fatalf("expected 1 CRL for the leaf, got %d", len(crls[0]))
+		}
+		crl := crls[0][0]
+		if crl.Error != nil {
+			t.Fatal(crl.Error)
+		}
+		if crl.Revoked != revoked || !crl.Fresh {
+			t.Errorf("%s: unexpected CRL %+v", leaf.Certificate.Subject.CommonName, crl)
+		}
+		if len(crls[1]) != 1 || crls[1][0].Revoked || crls[1][0].Error != nil {
+			t.Errorf("unexpected CRL for the intermediate %+v", crls[1])
+		}
+		if len(crls[2]) != 0 {
+			t.Errorf("expected no CRL for the root, got %+v", crls[2])
+		}
+	}
+}
+
+func TestPastTime(t *testing.T) {
+	p := pkitest.NewT(t)
+	// The leaf was revoked an hour before now, and the CRL issued now.
+	before := p.Now.Add(-2 * time.Hour)
+	crl := VerifyChain(context.Background(), p.Revoked.Chain, before)[0][0]
+	if crl.Error != nil {
+		t.Fatal(crl.Error)
+	}
+	if crl.Revoked || crl.Fresh || !crl.FreshnessUnknown || !crl.Determines() {
+		t.Errorf("expected the leaf not to be revoked yet, by a CRL of unknown freshness, got %+v", crl)
+	}
+	if crl := VerifyChain(context.Background(), p.Revoked.Chain, p.Now.Add(time.Minute))[0][0]; !crl.Revoked || crl.FreshnessUnknown {
+		t.Errorf("expected the leaf to be revoked once the revocation took effect, got %+v", crl)
+	}
+}
+
+func TestStale(t *testing.T) {
+	p := pkitest.NewT(t)
+	crl := VerifyChain(context.Background(), p.Valid.Chain, p.Now.Add(pkitest.ResponseLifetime*2))[0][0]
+	if crl.Error != nil {
+		t.Fatal(crl.Error)
+	}
+	if crl.Fresh {
+		t.Errorf("expected the CRL to be stale, got %+v", crl)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	p := pkitest.NewT(t)
+	chain := p.Valid.Chain
+	p.Close()
+	crl := VerifyChain(context.Background(), chain, time.Time{})[0][0]
+	if crl.Error == nil {
+		t.Errorf("expected an error from an unreachable distribution point, got %+v", crl)
+	}
+}
+
+func TestCache(t *testing.T) {
+	p := pkitest.NewT(t)
+	dp, err := url.Parse(p.Intermediate.CRLDistributionPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range []*pkitest.Leaf{p.Valid, p.Expired, p.Revoked} {
+		VerifyChain(context.Background(), []*x509.Certificate{leaf.Certificate}, time.Time{})
+	}
+	if n := p.Requests(dp.Path); n != 1 {
+		t.Errorf("expected the CRL to be downloaded once and then cached, got %d downloads", n)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := &cache{entries: make(map[string]cached)}
+	now := time.Now()
+	list := func(nextUpdate time.Time) *pkix.CertificateList {
+		l := &pkix.CertificateList{}
+		l.TBSCertList.NextUpdate = nextUpdate
+		return l
+	}
+	c.put("soon", list(now.Add(time.Minute)), now)
+	c.put("later", list(now.Add(pkitest.ResponseLifetime)), now)
+	c.put("stale", list(now.Add(-time.Minute)), now)
+	if _, ok := c.get("soon", now.Add(2*time.Minute)); ok {
+		t.Error("expected a CRL not to be reused beyond its nextUpdate")
+	}
+	if _, ok := c.get("later", now.Add(CacheLifetime/2)); !ok {
+		t.Error("expected a CRL to be reused within the cache lifetime")
+	}
+	if _, ok := c.get("later", now.Add(CacheLifetime)); ok {
+		t.Error("expected a CRL not to be reused beyond the cache lifetime")
+	}
+	if _, ok := c.get("stale", now); ok {
+		t.Error("expected a stale CRL not to be cached")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	p := pkitest.NewT(t)
+	p.SetFaults(pkitest.Faults{ServerError: true})
+	if crl := VerifyChain(context.Background(), p.Valid.Chain, time.Time{})[0][0]; crl.Error == nil {
+		t.Errorf("expected an error from a failing distribution point, got %+v", crl)
+	}
+	p.SetFaults(pkitest.Faults{StaleCRL: true})
+	crl := VerifyChain(context.Background(), p.Revoked.Chain, time.Time{})[0][0]
+	if crl.Error != nil {
+		t.Fatal(crl.Error)
+	}
+	if crl.Fresh || !crl.Revoked {
+		t.Errorf("expected a stale CRL listing the leaf, got %+v", crl)
+	}
+}
+
+func TestWrongIssuer(t *testing.T) {
+	p := pkitest.NewT(t)
+	// The leaf's CRL is the intermediate's, which the root did not sign.
+	crl := VerifyChain(context.Background(), []*x509.Certificate{p.Valid.Certificate, p.Root.Certificate}, time.Time{})[0][0]
+	if crl.Error == nil || crl.Determines() {
+		t.Errorf("expected a CRL signed by another CA to be rejected, got %+v", crl)
+	}
+}
+
+func TestEndEntityCRL(t *testing.T) {
+	p := pkitest.NewT(t)
+	p.SetFaults(pkitest.Faults{EndEntityCRL: true})
+	crls := VerifyChain(context.Background(), p.Valid.Chain, time.Time{})
+	if leaf := crls[0][0]; !leaf.Determines() || leaf.Scope != EndEntities {
+		t.Errorf("expected the leaf to be covered, got %+v", leaf)
+	}
+	if intermediate := crls[1][0]; intermediate.Error == nil || intermediate.Determines() {
+		t.Errorf("expected the intermediate to be outside the scope of its parent's CRL, got %+v", intermediate)
+	}
+}
 
-func parseChain(path string) (certs []*x509.Certificate) {
-	f, err := os.Open(path)
+func TestInheritedDistributionPoint(t *testing.T) {
+	p := pkitest.NewT(t)
+	// A root that names the distribution point of its own ARL, and an
+	// intermediate beneath it that names none.
+	template := *p.Root.Certificate
+	template.CRLDistributionPoints = []string{p.Root.CRLDistributionPoint}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, p.Root.Key.Public(), p.Root.Key)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	raw, err := ioutil.ReadAll(f)
+	root, err := x509.ParseCertificate(der)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	for _, b := range bytes.SplitAfter(raw, []byte("-----END CERTIFICATE-----")) {
-		block, rest := pem.Decode(b)
-		if len(rest) != 0 {
-			continue
-		}
-		cert, err := x509.ParseCertificate(block.Bytes)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := p.Issue(p.Root, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "CACop Test Intermediate Without CRL"},
+		NotBefore:             p.Now.AddDate(-1, 0, 0),
+		NotAfter:              p.Now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		CRLDistributionPoints: []string{},
+	}, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intermediate.CRLDistributionPoints) != 0 {
+		t.Fatal("expected an intermediate without a CRL distribution point")
+	}
+	crls := VerifyChain(context.Background(), []*x509.Certificate{intermediate, root}, time.Time{})
+	if len(crls[0]) != 1 {
+		t.Fatalf("expected the root's CRL to be tried for the intermediate, got %+v", crls[0])
+	}
+	if crl := crls[0][0]; !crl.Determines() || !crl.Inherited || crl.Endpoint != p.Root.CRLDistributionPoint {
+		t.Errorf("expected the intermediate to be covered by its parent's CRL, got %+v", crl)
+	}
+	// The root is its own issuer, so it inherits nothing.
+	if crl := crls[1][0]; crl.Inherited {
+		t.Errorf("expected the root's own distribution point, got %+v", crl)
+	}
+	// Beneath another intermediate, whose distribution point leads to the
+	// root's CRL, there is nothing to inherit.
+	sub, err := p.Issue(p.Intermediate, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "CACop Test Sub-Intermediate Without CRL"},
+		NotBefore:             p.Now.AddDate(-1, 0, 0),
+		NotAfter:              p.Now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		CRLDistributionPoints: []string{},
+	}, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crls = VerifyChain(context.Background(), append([]*x509.Certificate{sub}, p.Intermediate.Chain...), time.Time{})
+	if len(crls[0]) != 0 {
+		t.Errorf("expected no CRL to be tried for the sub-intermediate, got %+v", crls[0])
+	}
+}
+
+func TestScope(t *testing.T) {
+	p := pkitest.NewT(t)
+	const dp = "http://crl.example.com/root.crl"
+	uri := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(dp)}
+	fullName, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(t, uri)})
+	distributionPoint, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: fullName})
+	named, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: append(distributionPoint, 0x82, 0x01, 0xff)})
+	partial, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: []byte{0x83, 0x02, 0x07, 0x80}})
+	idp := func(value []byte) pkix.Extension {
+		return pkix.Extension{Id: idIssuingDistributionPoint, Critical: true, Value: value}
+	}
+	tests := []struct {
+		name        string
+		extensions  []pkix.Extension
+		certificate *x509.Certificate
+		scope       string
+		partial     bool
+		covers      bool
+	}{
+		{"no IDP", nil, p.Valid.Certificate, AllCertificates, false, true},
+		{"ARL of an intermediate", []pkix.Extension{pkitest.AuthoritiesOnly}, p.Intermediate.Certificate, Authorities, false, true},
+		{"ARL of a leaf", []pkix.Extension{pkitest.AuthoritiesOnly}, p.Valid.Certificate, Authorities, false, false},
+		{"end entity CRL of an intermediate", []pkix.Extension{pkitest.EndEntitiesOnly}, p.Intermediate.Certificate, EndEntities, false, false},
+		{"named ARL", []pkix.Extension{idp(named)}, p.Intermediate.Certificate, Authorities, false, true},
+		{"some reasons", []pkix.Extension{idp(partial)}, p.Valid.Certificate, AllCertificates, true, true},
+	}
+	for _, test := range tests {
+		s, err := scopeOf(mustParseCRL(t, p, test.extensions...))
 		if err != nil {
-			panic(err)
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if s.certificates != test.scope || s.partial != test.partial {
+			t.Errorf("%s: unexpected scope %+v", test.name, s)
 		}
-		certs = append(certs, cert)
+		if err := s.covers(test.certificate, dp); (err == nil) != test.covers {
+			t.Errorf("%s: expected the CRL to cover the certificate: %v, got %v", test.name, test.covers, err)
+		}
+	}
+	s, _ := scopeOf(mustParseCRL(t, p, idp(named)))
+	if err := s.covers(p.Intermediate.Certificate, "http://elsewhere.example.com/root.crl"); err == nil {
+		t.Errorf("expected a CRL named for another distribution point to be rejected")
 	}
-	return
 }
 
-func TestCRL(t *testing.T) {
-	for _, cert := range parseChain(revoked) {
-		crl := QueryCRLs(cert)
-		t.Log(crl)
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func mustParseCRL(t *testing.T, p *pkitest.PKI, extensions ...pkix.Extension) *pkix.CertificateList {
+	der, err := p.Root.SignCRL(p.Now, p.Now.Add(pkitest.ResponseLifetime), extensions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
 	}
+	return list
 }
@@ -0,0 +1,139 @@
+package crl
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// RFC 5280
+//
+// 5.2.5.  Issuing Distribution Point
+//
+// The issuing distribution point is a critical CRL extension that
+// identifies the CRL distribution point and scope for a particular CRL,
+// and it indicates whether the CRL covers revocation for end entity
+// certificates only, CA certificates only, attribute certificates only,
+// or a limited set of reason codes.
+//
+// issuingDistributionPoint ::= SEQUENCE {
+//	distributionPoint          [0] DistributionPointName OPTIONAL,
+//	onlyContainsUserCerts      [1] BOOLEAN DEFAULT FALSE,
+//	onlyContainsCACerts        [2] BOOLEAN DEFAULT FALSE,
+//	onlySomeReasons            [3] ReasonFlags OPTIONAL,
+//	indirectCRL                [4] BOOLEAN DEFAULT FALSE,
+//	onlyContainsAttributeCerts [5] BOOLEAN DEFAULT FALSE }
+//
+// A CRL that only contains CA certificates is an authority revocation list,
+// or ARL, and is what the CAs above an intermediate are expected to publish.
+
+var idIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+
+const (
+	// AllCertificates is the scope of a CRL without an issuing distribution point.
+	AllCertificates = "all"
+	EndEntities     = "end-entity"
+	// Authorities is the scope of an ARL.
+	Authorities = "ca"
+	Attributes  = "attribute"
+)
+
+type issuingDistributionPoint struct {
+	DistributionPoint          asn1.RawValue  `asn1:"optional,explicit,tag:0"`
+	OnlyContainsUserCerts      bool           `asn1:"optional,tag:1"`
+	OnlyContainsCACerts        bool           `asn1:"optional,tag:2"`
+	OnlySomeReasons            asn1.BitString `asn1:"optional,tag:3"`
+	IndirectCRL                bool           `asn1:"optional,tag:4"`
+	OnlyContainsAttributeCerts bool           `asn1:"optional,tag:5"`
+}
+
+// scope is what the CRL covers according to its issuing distribution point.
+type scope struct {
+	certificates string
+	// names are the URIs of the distribution point, if it is named.
+	names    []string
+	partial  bool
+	indirect bool
+}
+
+func scopeOf(c *pkix.CertificateList) (scope, error) {
+	s := scope{certificates: AllCertificates}
+	for _, e := range c.TBSCertList.Extensions {
+		if !e.Id.Equal(idIssuingDistributionPoint) {
+			continue
+		}
+		var idp issuingDistributionPoint
+		if rest, err := asn1.Unmarshal(e.Value, &idp); err != nil || len(rest) != 0 {
+			return s, errors.New("malformed issuing distribution point")
+		}
+		switch {
+		case idp.OnlyContainsUserCerts:
+			s.certificates = EndEntities
+		case idp.OnlyContainsCACerts:
+			s.certificates = Authorities
+		case idp.OnlyContainsAttributeCerts:
+			s.certificates = Attributes
+		}
+		s.partial = idp.OnlySomeReasons.BitLength != 0
+		s.indirect = idp.IndirectCRL
+		s.names = fullNameURIs(idp.DistributionPoint)
+	}
+	return s, nil
+}
+
+// fullNameURIs are the URIs among the fullName [0] GeneralNames of the
+// explicitly tagged DistributionPointName. A nameRelativeToCRLIssuer [1] has
+// none.
+func fullNameURIs(distributionPoint asn1.RawValue) []string {
+	var fullName asn1.RawValue
+	if _, err := asn1.Unmarshal(distributionPoint.Bytes, &fullName); err != nil {
+		return nil
+	}
+	if fullName.Class != asn1.ClassContextSpecific || fullName.Tag != 0 {
+		return nil
+	}
+	var uris []string
+	for rest := fullName.Bytes; len(rest) != 0; {
+		var generalName asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &generalName); err != nil {
+			return uris
+		}
+		// uniformResourceIdentifier [6] IA5String
+		if generalName.Class == asn1.ClassContextSpecific && generalName.Tag == 6 {
+			uris = append(uris, string(generalName.Bytes))
+		}
+	}
+	return uris
+}
+
+// covers decides whether the CRL may speak for the certificate that was
+// found to point to it at the given distribution point.
+func (s scope) covers(certificate *x509.Certificate, distributionPoint string) error {
+	switch {
+	case s.indirect:
+		return errors.New("the CRL is an indirect CRL, which is not supported")
+	case s.certificates == Attributes:
+		return errors.New("the CRL only covers attribute certificates")
+	case s.certificates == EndEntities && certificate.IsCA:
+		return errors.New("the CRL only covers end entity certificates, so it says nothing of this CA")
+	case s.certificates == Authorities && !certificate.IsCA:
+		return errors.New("the CRL is an authority revocation list, so it says nothing of this end entity certificate")
+	}
+	if len(s.names) != 0 && !contains(s.names, distributionPoint) {
+		return fmt.Errorf("the CRL's issuing distribution point is %v rather than %s", s.names, distributionPoint)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package revocation
+
+import "time"
+
+// DefaultLifetime is how long a response without a nextUpdate is considered
+// fresh after its thisUpdate.
+const DefaultLifetime = time.Hour * 24
+
+// Fresh reports whether revocation information produced at thisUpdate, and
+// superseded at nextUpdate, may be relied upon at the given time. A zero
+// time means now.
+func Fresh(thisUpdate, nextUpdate, at time.Time) bool {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if at.Before(thisUpdate) {
+		return false
+	}
+	if nextUpdate.IsZero() {
+		nextUpdate = thisUpdate.Add(DefaultLifetime)
+	}
+	return !at.After(nextUpdate)
+}
+
+// Evaluable reports whether the freshness of revocation information produced
+// at thisUpdate can be judged at the given time. Information retrieved today
+// says nothing of whether fresh information was available at an earlier time,
+// so when verifying in the past it is neither fresh nor stale. A zero time
+// means now.
+func Evaluable(thisUpdate, at time.Time) bool {
+	return at.IsZero() || !at.Before(thisUpdate)
+}
+
+// Effective reports whether a revocation at revokedAt had taken effect by the
+// given time. A zero time means now.
+func Effective(revokedAt, at time.Time) bool {
+	return at.IsZero() || !revokedAt.After(at)
+}
@@ -0,0 +1,48 @@
+package revocation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFresh(t *testing.T) {
+	thisUpdate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	nextUpdate := thisUpdate.AddDate(0, 0, 7)
+	tests := []struct {
+		nextUpdate time.Time
+		at         time.Time
+		fresh      bool
+	}{
+		{nextUpdate, thisUpdate.AddDate(0, 0, 1), true},
+		{nextUpdate, nextUpdate, true},
+		{nextUpdate, nextUpdate.Add(time.Second), false},
+		{nextUpdate, thisUpdate.Add(-time.Second), false},
+		{time.Time{}, thisUpdate.Add(DefaultLifetime / 2), true},
+		{time.Time{}, thisUpdate.Add(DefaultLifetime * 2), false},
+	}
+	for _, test := range tests {
+		if fresh := Fresh(thisUpdate, test.nextUpdate, test.at); fresh != test.fresh {
+			t.Errorf("nextUpdate %v at %v: expected %v, got %v", test.nextUpdate, test.at, test.fresh, fresh)
+		}
+	}
+}
+
+func TestEvaluable(t *testing.T) {
+	thisUpdate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !Evaluable(thisUpdate, time.Time{}) || !Evaluable(thisUpdate, thisUpdate) {
+		t.Error("expected the freshness to be evaluable now and at thisUpdate")
+	}
+	if Evaluable(thisUpdate, thisUpdate.Add(-time.Second)) {
+		t.Error("expected the freshness not to be evaluable before thisUpdate")
+	}
+}
+
+func TestEffective(t *testing.T) {
+	revokedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !Effective(revokedAt, time.Time{}) || !Effective(revokedAt, revokedAt) {
+		t.Error("expected the revocation to be in effect now and when it was made")
+	}
+	if Effective(revokedAt, revokedAt.Add(-time.Second)) {
+		t.Error("expected the revocation not to be in effect before it was made")
+	}
+}
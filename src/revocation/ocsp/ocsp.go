@@ -2,11 +2,17 @@ package ocsp
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/metrics"
+	"github.com/christopher-henderson/CACop/revocation"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ocsp"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // RFC 6960
@@ -47,43 +53,107 @@ import (
 //	unknown     [2]     IMPLICIT UnknownInfo }
 
 type OCSP struct {
-	Responder string
-	Good      bool
-	Revoked   bool
-	Unknown   bool
-	Error     error
+	Responder  string
+	Good       bool
+	Revoked    bool
+	Unknown    bool
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	Fresh      bool
+	// FreshnessUnknown is set when verifying at a time before the response
+	// was produced, at which its freshness cannot be evaluated.
+	FreshnessUnknown bool `json:",omitempty"`
+	Error            error
 }
 
 const OCSPContentType = "application/ocsp-request"
 
-func VerifyChain(chain []*x509.Certificate) [][]OCSP {
+var (
+	queries = metrics.NewCounterVec("cacop_ocsp_queries_total",
+		"OCSP queries by responder host and the status returned, or error.",
+		"host", "status")
+	queryDuration = metrics.NewHistogramVec("cacop_ocsp_query_duration_seconds",
+		"Time taken for OCSP responders to answer, by responder host.",
+		metrics.DurationBuckets, "host")
+)
+
+// Status is one of good, revoked, unknown or error, or none for a response
+// that was never completed.
+func (o OCSP) Status() string {
+	switch {
+	case o.Error != nil:
+		return "error"
+	case o.Good:
+		return "good"
+	case o.Revoked:
+		return "revoked"
+	case o.Unknown:
+		return "unknown"
+	}
+	return "none"
+}
+
+// Determines reports whether the response gives the status of the
+// certificate, that is whether it is valid, fresh or cannot be judged stale,
+// and either good or revoked.
+func (o OCSP) Determines() bool {
+	return o.Error == nil && (o.Fresh || o.FreshnessUnknown) && (o.Good || o.Revoked)
+}
+
+// VerifyChain queries the OCSP responders of every certificate in the chain
+// save for the root. The freshness of each response is evaluated at the given
+// time, or now if the time is zero.
+func VerifyChain(ctx context.Context, chain []*x509.Certificate, at time.Time) [][]OCSP {
 	ocsps := make([][]OCSP, len(chain))
 	if len(chain) == 1 {
 		return ocsps
 	}
 	for i, cert := range chain[:len(chain)-1] {
-		ocsps[i] = queryOCSP(cert, chain[i+1])
+		ocsps[i] = queryOCSP(ctx, cert, chain[i+1], at)
 	}
 	ocsps[len(ocsps)-1] = make([]OCSP, 0)
 	return ocsps
 }
 
-func queryOCSP(certificate, issuer *x509.Certificate) []OCSP {
+func queryOCSP(ctx context.Context, certificate, issuer *x509.Certificate, at time.Time) []OCSP {
 	responses := make([]OCSP, len(certificate.OCSPServer))
 	for i, responder := range certificate.OCSPServer {
-		responses[i] = newOCSPResponse(certificate, issuer, responder)
+		responses[i] = newOCSPResponse(ctx, certificate, issuer, responder, at)
 	}
 	return responses
 }
 
-func newOCSPResponse(certificate, issuer *x509.Certificate, responder string) (response OCSP) {
+func newOCSPResponse(ctx context.Context, certificate, issuer *x509.Certificate, responder string, at time.Time) (response OCSP) {
 	response.Responder = responder
+	host := metrics.Host(responder)
+	start := time.Now()
+	defer func() {
+		queryDuration.With(host).ObserveSince(start)
+		queries.With(host, response.Status()).Inc()
+		log := logging.FromContext(ctx).WithFields(logrus.Fields{
+			"responder": responder,
+			"serial":    certificate.SerialNumber.String(),
+			"status":    response.Status(),
+			"duration":  time.Since(start).Seconds(),
+		})
+		if response.Error != nil {
+			log.WithError(response.Error).Warn("OCSP query failed")
+			return
+		}
+		log.Debug("OCSP query completed")
+	}()
 	req, err := ocsp.CreateRequest(certificate, issuer, nil)
 	if err != nil {
 		response.Error = errors.Wrap(err, "failed to create DER encoded OCSP request")
 		return
 	}
-	ret, err := http.Post(responder, OCSPContentType, bytes.NewReader(req))
+	httpReq, err := http.NewRequest(http.MethodPost, responder, bytes.NewReader(req))
+	if err != nil {
+		response.Error = errors.Wrapf(err, "failed to create HTTP POST request to %v", responder)
+		return
+	}
+	httpReq.Header.Set("Content-Type", OCSPContentType)
+	ret, err := http.DefaultClient.Do(httpReq.WithContext(ctx))
 	if err != nil {
 		response.Error = errors.Wrapf(err, "failed to retrieve HTTP POST response from %v", responder)
 		return
@@ -94,13 +164,42 @@ func newOCSPResponse(certificate, issuer *x509.Certificate, responder string) (r
 		response.Error = errors.Wrap(err, "failed to read the body of the OCSP response")
 		return
 	}
-	serverResponse, err := ocsp.ParseResponse(httpResp, issuer)
+	response.Error = response.parse(httpResp, certificate, issuer, at)
+	return
+}
+
+// parse fills in the status from the DER encoded response, which must be
+// about the certificate and be signed either by its issuer or by a responder
+// to which the issuer delegated.
+func (o *OCSP) parse(raw []byte, certificate, issuer *x509.Certificate, at time.Time) error {
+	serverResponse, err := ocsp.ParseResponseForCert(raw, certificate, issuer)
 	if err != nil {
-		response.Error = errors.Wrapf(err, "failed to parse the OCSP response")
-		return
+		return errors.Wrapf(err, "failed to parse the OCSP response")
 	}
-	response.Good = serverResponse.Status == ocsp.Good
-	response.Revoked = serverResponse.Status == ocsp.Revoked
-	response.Unknown = serverResponse.Status == ocsp.Unknown
-	return
+	if responder := serverResponse.Certificate; responder != nil && !bytes.Equal(responder.Raw, issuer.Raw) && !delegated(responder) {
+		return errors.Errorf("OCSP response was signed by %s, which lacks the OCSP signing extended key usage", responder.Subject.CommonName)
+	}
+	o.Good = serverResponse.Status == ocsp.Good
+	o.Revoked = serverResponse.Status == ocsp.Revoked
+	o.Unknown = serverResponse.Status == ocsp.Unknown
+	if o.Revoked && !revocation.Effective(serverResponse.RevokedAt, at) {
+		// The certificate was still good at the time of verification.
+		o.Good, o.Revoked = true, false
+	}
+	o.ThisUpdate = serverResponse.ThisUpdate
+	o.NextUpdate = serverResponse.NextUpdate
+	o.Fresh = revocation.Fresh(o.ThisUpdate, o.NextUpdate, at)
+	o.FreshnessUnknown = !revocation.Evaluable(o.ThisUpdate, at)
+	return nil
+}
+
+// delegated reports whether the issuer authorized the responder to sign
+// OCSP responses on its behalf, as per RFC 6960 section 4.2.2.2.
+func delegated(responder *x509.Certificate) bool {
+	for _, usage := range responder.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
 }
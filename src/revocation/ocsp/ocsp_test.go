@@ -1,42 +1,183 @@
 package ocsp
 
 import (
-	"bytes"
+	"context"
 	"crypto/x509"
-	"encoding/pem"
-	"io/ioutil"
-	"os"
 	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/pkitest"
 )
 
-func parseChain(path string) (certs []*x509.Certificate) {
-	f, err := os.Open(path)
-	if err != nil {
-		panic(err)
+func TestVerifyChain(t *testing.T) {
+	p := pkitest.NewT(t)
+	for leaf, revoked := range map[*pkitest.Leaf]bool{p.Valid: false, p.Expired: false, p.Revoked: true} {
+		ocsps := VerifyChain(context.Background(), leaf.Chain, time.Time{})
+		if len(ocsps) != 3 {
+			t.Fatalf("expected a status for each of the 3 certificates, got %d", len(ocsps))
+		}
+		if len(ocsps[0]) != 1 {
+			t.Fatalf("expected 1 OCSP response for the leaf, got %d", len(ocsps[0]))
+		}
+		response := ocsps[0][0]
+		if response.Error != nil {
+			t.Fatal(response.Error)
+		}
+		if response.Revoked != revoked || response.Good == revoked || !response.Fresh {
+			t.Errorf("%s: unexpected OCSP response %+v", leaf.Certificate.Subject.CommonName, response)
+		}
+		if len(ocsps[1]) != 1 || !ocsps[1][0].Good {
+			t.Errorf("unexpected OCSP response for the intermediate %+v", ocsps[1])
+		}
+		if len(ocsps[2]) != 0 {
+			t.Errorf("expected no OCSP response for the root, got %+v", ocsps[2])
+		}
 	}
-	raw, err := ioutil.ReadAll(f)
-	if err != nil {
-		panic(err)
+}
+
+func TestPastTime(t *testing.T) {
+	p := pkitest.NewT(t)
+	// The leaf was revoked an hour before now, and the response produced now.
+	before := p.Now.Add(-2 * time.Hour)
+	response := VerifyChain(context.Background(), p.Revoked.Chain, before)[0][0]
+	if response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if response.Revoked || !response.Good || response.Fresh || !response.FreshnessUnknown || !response.Determines() {
+		t.Errorf("expected the leaf to be good yet, by a response of unknown freshness, got %+v", response)
+	}
+	if response := VerifyChain(context.Background(), p.Revoked.Chain, p.Now.Add(time.Minute))[0][0]; !response.Revoked || response.FreshnessUnknown {
+		t.Errorf("expected the leaf to be revoked once the revocation took effect, got %+v", response)
+	}
+}
+
+func TestStale(t *testing.T) {
+	p := pkitest.NewT(t)
+	response := VerifyChain(context.Background(), p.Valid.Chain, p.Now.Add(pkitest.ResponseLifetime*2))[0][0]
+	if response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if response.Fresh {
+		t.Errorf("expected the response to be stale, got %+v", response)
+	}
+}
+
+func TestWrongIssuer(t *testing.T) {
+	p := pkitest.NewT(t)
+	// The root did not sign the response, so its signature cannot be verified.
+	chain := []*x509.Certificate{p.Valid.Certificate, p.Root.Certificate}
+	if response := VerifyChain(context.Background(), chain, time.Time{})[0][0]; response.Error == nil {
+		t.Errorf("expected an error, got %+v", response)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	p := pkitest.NewT(t)
+	chain := p.Valid.Chain
+	p.Close()
+	response := VerifyChain(context.Background(), chain, time.Time{})[0][0]
+	if response.Error == nil || response.Status() != "error" {
+		t.Errorf("expected an error from an unreachable responder, got %+v", response)
 	}
-	for _, b := range bytes.SplitAfter(raw, []byte("-----END CERTIFICATE-----")) {
-		block, rest := pem.Decode(b)
-		if len(rest) != 0 {
-			continue
+}
+
+func TestSingleCertificate(t *testing.T) {
+	p := pkitest.NewT(t)
+	ocsps := VerifyChain(context.Background(), p.Root.Chain, time.Time{})
+	if len(ocsps) != 1 || len(ocsps[0]) != 0 {
+		t.Errorf("expected no responses for a lone root, got %+v", ocsps)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults pkitest.Faults
+		check  func(OCSP) bool
+	}{
+		{"expired response", pkitest.Faults{ExpiredOCSP: true}, func(o OCSP) bool { return o.Error == nil && !o.Fresh }},
+		{"wrong signer", pkitest.Faults{WrongSigner: true}, func(o OCSP) bool { return o.Error != nil }},
+		{"missing nextUpdate", pkitest.Faults{NoNextUpdate: true}, func(o OCSP) bool { return o.Good && o.NextUpdate.IsZero() }},
+		{"server error", pkitest.Faults{ServerError: true}, func(o OCSP) bool { return o.Error != nil }},
+	}
+	for _, test := range tests {
+		p := pkitest.NewT(t)
+		p.SetFaults(test.faults)
+		response := VerifyChain(context.Background(), p.Valid.Chain, time.Time{})[0][0]
+		if !test.check(response) {
+			t.Errorf("%s: unexpected response %+v", test.name, response)
 		}
-		cert, err := x509.ParseCertificate(block.Bytes)
+		p.Close()
+	}
+}
+
+func TestSlowResponder(t *testing.T) {
+	p := pkitest.NewT(t)
+	p.SetFaults(pkitest.Faults{Delay: time.Millisecond * 200})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if response := VerifyChain(ctx, p.Valid.Chain, time.Time{})[0][0]; response.Error == nil {
+		t.Errorf("expected the query to time out, got %+v", response)
+	}
+}
+
+func TestVerifyStaple(t *testing.T) {
+	p := pkitest.NewT(t)
+	staple := func(leaf *pkitest.Leaf, faults pkitest.Faults) []byte {
+		p.SetFaults(faults)
+		defer p.SetFaults(pkitest.Faults{})
+		raw, err := p.Staple(leaf, time.Now())
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
+		}
+		return raw
+	}
+	live := func(leaf *pkitest.Leaf) []OCSP {
+		return VerifyChain(context.Background(), leaf.Chain, time.Time{})[0]
+	}
+	if s := VerifyStaple(context.Background(), nil, p.Valid.Certificate, p.Intermediate.Certificate, live(p.Valid), time.Time{}); s != nil {
+		t.Errorf("expected no staple, got %+v", s)
+	}
+	tests := []struct {
+		name       string
+		leaf       *pkitest.Leaf
+		raw        []byte
+		status     string
+		fresh      bool
+		mismatched int
+	}{
+		{"valid", p.Valid, staple(p.Valid, pkitest.Faults{}), "good", true, 0},
+		{"revoked", p.Revoked, staple(p.Revoked, pkitest.Faults{}), "revoked", true, 0},
+		{"good staple of a revoked leaf", p.Revoked, staple(p.Revoked, pkitest.Faults{GoodStaple: true}), "good", true, 1},
+		{"stale", p.Valid, staple(p.Valid, pkitest.Faults{StaleStaple: true}), "good", false, 0},
+		{"wrong signer", p.Valid, staple(p.Valid, pkitest.Faults{WrongSigner: true}), "error", false, 0},
+		{"another leaf", p.Valid, staple(p.Expired, pkitest.Faults{}), "error", false, 0},
+	}
+	for _, test := range tests {
+		s := VerifyStaple(context.Background(), test.raw, test.leaf.Certificate, p.Intermediate.Certificate, live(test.leaf), time.Time{})
+		if s == nil {
+			t.Fatalf("%s: expected a staple", test.name)
+		}
+		if s.Status() != test.status || s.Fresh != test.fresh || len(s.Mismatched) != test.mismatched {
+			t.Errorf("%s: unexpected staple %+v", test.name, s)
 		}
-		certs = append(certs, cert)
 	}
-	return
 }
 
-var revoked = `/Users/chris/Documents/Contracting/mozilla/CACop/src/testdata/data/AffirmTrust Premium/revoked`
-
-func TestOCSP(t *testing.T) {
-	chain := parseChain(revoked)
-	for i, cert := range chain[:len(chain)-1] {
-		t.Log(QueryOCSP(cert, chain[i+1]))
+func TestMustStaple(t *testing.T) {
+	p := pkitest.NewT(t)
+	leaf, err := p.NewMustStapleLeaf(p.Intermediate, "must-staple.example.com", p.Now.Add(-time.Hour), p.Now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !MustStaple(leaf.Certificate) {
+		t.Error("expected the TLS Feature extension to demand a staple")
+	}
+	if MustStaple(p.Valid.Certificate) {
+		t.Error("expected an ordinary leaf not to demand a staple")
+	}
+	var missing *Staple
+	if missing.Valid() {
+		t.Error("expected a missing staple to be invalid")
 	}
 }
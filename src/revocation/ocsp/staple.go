@@ -0,0 +1,104 @@
+package ocsp
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// RFC 6066
+//
+// 8.  Certificate Status Request
+//
+// Constrained clients may wish to use a certificate-status protocol
+// such as OCSP [RFC2560] to check the validity of server certificates,
+// in order to avoid transmission of CRLs and therefore save bandwidth
+// on constrained networks.  This extension allows for such information
+// to be sent in the TLS handshake, saving roundtrips and resources.
+//
+// Go's TLS client always sends the status_request extension, so whatever
+// the subject stapled is found in tls.ConnectionState.OCSPResponse.
+
+// Staple is the OCSP response that the subject stapled to its handshake,
+// validated as though it had been fetched from a responder.
+type Staple struct {
+	OCSP
+	// Mismatched are the responders of the leaf whose live answer differs
+	// from the staple. Responders that could not be reached are not compared.
+	Mismatched []string
+}
+
+// VerifyStaple validates the raw stapled response for the certificate and
+// compares it with the answers already given by the live responders. Nil is
+// returned if nothing was stapled.
+func VerifyStaple(ctx context.Context, raw []byte, certificate, issuer *x509.Certificate, live []OCSP, at time.Time) *Staple {
+	if len(raw) == 0 {
+		return nil
+	}
+	staple := &Staple{}
+	staple.Error = staple.parse(raw, certificate, issuer, at)
+	if staple.Error == nil {
+		for _, response := range live {
+			if response.Error == nil && response.Status() != staple.Status() {
+				staple.Mismatched = append(staple.Mismatched, response.Responder)
+			}
+		}
+	}
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"serial":     certificate.SerialNumber.String(),
+		"status":     staple.Status(),
+		"mismatched": len(staple.Mismatched),
+	})
+	if staple.Error != nil {
+		log.WithError(staple.Error).Warn("stapled OCSP response is invalid")
+	} else {
+		log.Debug("verified stapled OCSP response")
+	}
+	return staple
+}
+
+// RFC 7633
+//
+// 4.2.3.  TLS Feature
+//
+// The TLS feature extension has the following format:
+//
+// id-pe-tlsfeature OBJECT IDENTIFIER ::=  { id-pe 24 }
+//
+// Features ::= SEQUENCE OF INTEGER
+//
+// A server that presents a certificate with status_request (5) among its
+// features must staple a valid OCSP response, or Firefox refuses to connect.
+var tlsFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+const statusRequest = 5
+
+// MustStaple reports whether the certificate has the TLS Feature extension
+// with status_request among its features.
+func MustStaple(cert *x509.Certificate) bool {
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(tlsFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(extension.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == statusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Valid reports whether the staple satisfies Must-Staple, that is whether it
+// parsed, was signed correctly, is fresh and knew of the certificate.
+func (s *Staple) Valid() bool {
+	return s != nil && s.Error == nil && (s.Fresh || s.FreshnessUnknown) && !s.Unknown
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/christopher-henderson/CACop/pkitest"
+	"github.com/sirupsen/logrus"
+)
+
+// simulate runs a fake CA, with test websites for each expected verdict and
+// an OCSP responder and CRL distribution point that may be told to misbehave,
+// until interrupted. It demonstrates to CAs exactly what CACop flags.
+//
+//	cacop simulate [-root root.pem] [-expired-ocsp] [-wrong-signer] [-no-next-update] [-stale-crl] [-http-500] [-slow 10s]
+//		[-end-entity-crl] [-no-staple] [-stale-staple] [-good-staple]
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	rootFile := flags.String("root", "simulated-root.pem", "file to which the PEM of the simulated root is written")
+	var faults pkitest.Faults
+	flags.BoolVar(&faults.ExpiredOCSP, "expired-ocsp", false, "serve OCSP responses whose nextUpdate has passed")
+	flags.BoolVar(&faults.WrongSigner, "wrong-signer", false, "sign OCSP responses with a key that the issuer never delegated to")
+	flags.BoolVar(&faults.NoNextUpdate, "no-next-update", false, "omit the nextUpdate from OCSP responses")
+	flags.BoolVar(&faults.StaleCRL, "stale-crl", false, "serve CRLs whose nextUpdate has passed")
+	flags.BoolVar(&faults.EndEntityCRL, "end-entity-crl", false, "serve CRLs that cover end entity certificates only, and so not the intermediate")
+	flags.BoolVar(&faults.ServerError, "http-500", false, "answer every OCSP request and CRL download with a 500")
+	flags.BoolVar(&faults.NoStaple, "no-staple", false, "serve the test websites without a stapled OCSP response")
+	flags.BoolVar(&faults.StaleStaple, "stale-staple", false, "staple OCSP responses whose nextUpdate has passed")
+	flags.BoolVar(&faults.GoodStaple, "good-staple", false, "staple OCSP responses that say every leaf is good")
+	flags.DurationVar(&faults.Delay, "slow", 0, "delay every OCSP response and CRL download by this long")
+	flags.Parse(args)
+	pki, err := pkitest.New()
+	if err != nil {
+		return err
+	}
+	defer pki.Close()
+	pki.SetFaults(faults)
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.Root.Certificate.Raw})
+	if err := ioutil.WriteFile(*rootFile, root, 0644); err != nil {
+		return err
+	}
+	leaves := map[model.Verdict]*pkitest.Leaf{
+		model.Valid:   pki.Valid,
+		model.Expired: pki.Expired,
+		model.Revoked: pki.Revoked,
+	}
+	sites := make(map[model.Verdict]string)
+	for _, expected := range expectations {
+		site := pki.Site(leaves[expected])
+		defer site.Close()
+		sites[expected] = site.URL
+	}
+	logging.Logger.WithFields(logrus.Fields{
+		"root":    *rootFile,
+		"ocsp":    pki.Intermediate.OCSPServer,
+		"crl":     pki.Intermediate.CRLDistributionPoint,
+		"valid":   sites[model.Valid],
+		"expired": sites[model.Expired],
+		"revoked": sites[model.Revoked],
+		"faults":  fmt.Sprintf("%+v", faults),
+	}).Info("simulating a CA")
+	fmt.Printf("cacop check -valid %s -expired %s -revoked %s -root %s\n",
+		sites[model.Valid], sites[model.Expired], sites[model.Revoked], *rootFile)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	return nil
+}
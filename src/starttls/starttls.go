@@ -0,0 +1,342 @@
+// Package starttls upgrades plaintext mail, directory and messaging protocols
+// to TLS so that the chains of non-HTTPS test endpoints may be gathered.
+package starttls
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// upgrade negotiates STARTTLS over the plaintext connection, after which the
+// TLS handshake may begin. The host is the name by which the server was reached.
+type upgrade func(conn net.Conn, host string) error
+
+var protocols = map[string]struct {
+	port    string
+	upgrade upgrade
+}{
+	"smtp": {"25", smtp},
+	"imap": {"143", imap},
+	"pop3": {"110", pop3},
+	"ldap": {"389", ldap},
+	"xmpp": {"5222", xmpp},
+}
+
+// Timeout bounds the whole of the upgrade and handshake when the context has no deadline.
+var Timeout = time.Second * 30
+
+// Supported reports whether the URL scheme is one that is upgraded via STARTTLS.
+func Supported(scheme string) bool {
+	_, ok := protocols[strings.ToLower(scheme)]
+	return ok
+}
+
+// Handshake connects to the subject, upgrades the connection with the STARTTLS
+// of the subject's scheme and completes a TLS handshake. The port defaults to
+// the well known port of the protocol.
+func Handshake(ctx context.Context, subject *url.URL, config *tls.Config) (tls.ConnectionState, error) {
+	var state tls.ConnectionState
+	protocol, ok := protocols[strings.ToLower(subject.Scheme)]
+	if !ok {
+		return state, errors.Errorf("STARTTLS is not supported for %q", subject.Scheme)
+	}
+	host, port := subject.Hostname(), subject.Port()
+	if port == "" {
+		port = protocol.port
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(Timeout)
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return state, errors.Wrapf(err, "failed to connect to %s", subject)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return state, err
+	}
+	if err := protocol.upgrade(conn, host); err != nil {
+		return state, errors.Wrapf(err, "STARTTLS with %s failed", subject)
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" && net.ParseIP(host) == nil {
+		config.ServerName = host
+	}
+	client := tls.Client(conn, config)
+	if err := client.Handshake(); err != nil {
+		return state, errors.Wrapf(err, "TLS handshake with %s failed", subject)
+	}
+	return client.ConnectionState(), nil
+}
+
+// readLine reads a single CRLF terminated line. Servers say nothing further
+// until the client begins the TLS handshake, so nothing is lost to buffering.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// smtp is RFC 3207.
+func smtp(conn net.Conn, _ string) error {
+	r := bufio.NewReader(conn)
+	if _, err := smtpReply(r, "220"); err != nil {
+		return errors.Wrap(err, "bad greeting")
+	}
+	if _, err := conn.Write([]byte("EHLO cacop.invalid\r\n")); err != nil {
+		return err
+	}
+	extensions, err := smtpReply(r, "250")
+	if err != nil {
+		return errors.Wrap(err, "EHLO refused")
+	}
+	advertised := false
+	for _, extension := range extensions {
+		if strings.EqualFold(strings.TrimSpace(extension), "STARTTLS") {
+			advertised = true
+		}
+	}
+	if !advertised {
+		return errors.New("the server does not advertise STARTTLS")
+	}
+	if _, err := conn.Write([]byte("STARTTLS\r\n")); err != nil {
+		return err
+	}
+	_, err = smtpReply(r, "220")
+	return errors.Wrap(err, "STARTTLS refused")
+}
+
+// smtpReply reads a possibly multiline reply, returning the text of each line.
+func smtpReply(r *bufio.Reader, code string) ([]string, error) {
+	var lines []string
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return lines, err
+		}
+		if len(line) < 3 || line[:3] != code {
+			return lines, errors.Errorf("expected %s, got %q", code, line)
+		}
+		if len(line) > 3 {
+			lines = append(lines, line[4:])
+		}
+		if len(line) == 3 || line[3] == ' ' {
+			return lines, nil
+		}
+	}
+}
+
+// imap is RFC 2595 section 3.1.
+func imap(conn net.Conn, _ string) error {
+	r := bufio.NewReader(conn)
+	greeting, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return errors.Errorf("bad greeting %q", greeting)
+	}
+	if _, err := conn.Write([]byte("a001 STARTTLS\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		// Untagged responses may precede the tagged completion.
+		if !strings.HasPrefix(line, "a001 ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "a001 OK") {
+			return errors.Errorf("STARTTLS refused: %q", line)
+		}
+		return nil
+	}
+}
+
+// pop3 is RFC 2595 section 4.
+func pop3(conn net.Conn, _ string) error {
+	r := bufio.NewReader(conn)
+	greeting, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return errors.Errorf("bad greeting %q", greeting)
+	}
+	if _, err := conn.Write([]byte("STLS\r\n")); err != nil {
+		return err
+	}
+	reply, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "+OK") {
+		return errors.Errorf("STLS refused: %q", reply)
+	}
+	return nil
+}
+
+// startTLSOID is the name of the LDAP StartTLS extended operation.
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ldap is RFC 4511 section 4.14. Servers are free to use the long form of BER
+// lengths, which encoding/asn1 rejects, so messages are taken apart by hand.
+func ldap(conn net.Conn, _ string) error {
+	request := tlv(0x30, append(
+		tlv(0x02, []byte{1}),                         // messageID
+		tlv(0x77, tlv(0x80, []byte(startTLSOID)))..., // [APPLICATION 23] ExtendedRequest
+	))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	tag, message, err := readTLV(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	if tag != 0x30 {
+		return errors.Errorf("expected an LDAPMessage, got tag %#x", tag)
+	}
+	if _, _, message, err = parseTLV(message); err != nil { // messageID
+		return err
+	}
+	tag, response, _, err := parseTLV(message)
+	if err != nil {
+		return err
+	}
+	if tag != 0x78 {
+		return errors.Errorf("expected an ExtendedResponse, got tag %#x", tag)
+	}
+	tag, code, rest, err := parseTLV(response)
+	if err != nil {
+		return err
+	}
+	if tag != 0x0a || len(code) != 1 {
+		return errors.New("malformed ExtendedResponse resultCode")
+	}
+	if code[0] != 0 {
+		var diagnostic []byte
+		if _, _, rest, err = parseTLV(rest); err == nil { // matchedDN
+			_, diagnostic, _, _ = parseTLV(rest)
+		}
+		return errors.Errorf("StartTLS refused with result code %d: %s", code[0], diagnostic)
+	}
+	return nil
+}
+
+// tlv encodes a BER element, the value of which must be shorter than 128 bytes.
+func tlv(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+// maxLDAPMessage is far beyond any ExtendedResponse, and guards against a
+// server claiming an absurd length.
+const maxLDAPMessage = 1 << 16
+
+func readTLV(r *bufio.Reader) (tag byte, value []byte, err error) {
+	if tag, err = r.ReadByte(); err != nil {
+		return
+	}
+	length, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	n := int(length)
+	if length&0x80 != 0 {
+		n = 0
+		for i := 0; i < int(length&0x7f); i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return tag, nil, err
+			}
+			n = n<<8 | int(b)
+			if n > maxLDAPMessage {
+				return tag, nil, errors.Errorf("LDAP message of %d bytes is too long", n)
+			}
+		}
+	}
+	value = make([]byte, n)
+	_, err = io.ReadFull(r, value)
+	return
+}
+
+func parseTLV(b []byte) (tag byte, value, rest []byte, err error) {
+	r := bufio.NewReader(bytes.NewReader(b))
+	if tag, value, err = readTLV(r); err != nil {
+		return tag, nil, nil, errors.Wrap(err, "malformed LDAP message")
+	}
+	rest, _ = ioutil.ReadAll(r)
+	return
+}
+
+const (
+	streamNamespace = "http://etherx.jabber.org/streams"
+	tlsNamespace    = "urn:ietf:params:xml:ns:xmpp-tls"
+)
+
+// xmpp is RFC 6120 section 5.4.
+func xmpp(conn net.Conn, host string) error {
+	var to bytes.Buffer
+	xml.EscapeText(&to, []byte(host))
+	if _, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' version='1.0' xmlns='jabber:client' xmlns:stream='%s'>", to.String(), streamNamespace); err != nil {
+		return err
+	}
+	d := xml.NewDecoder(conn)
+	features, err := nextElement(d)
+	for err == nil && !(features.Name.Space == streamNamespace && features.Name.Local == "features") {
+		// Skip the opening of the server's stream.
+		features, err = nextElement(d)
+	}
+	if err != nil {
+		return err
+	}
+	var advertised struct {
+		StartTLS *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	}
+	if err := d.DecodeElement(&advertised, &features); err != nil {
+		return err
+	}
+	if advertised.StartTLS == nil {
+		return errors.New("the server does not advertise STARTTLS")
+	}
+	if _, err := fmt.Fprintf(conn, "<starttls xmlns='%s'/>", tlsNamespace); err != nil {
+		return err
+	}
+	reply, err := nextElement(d)
+	if err != nil {
+		return err
+	}
+	if reply.Name.Space != tlsNamespace || reply.Name.Local != "proceed" {
+		return errors.Errorf("STARTTLS refused with <%s>", reply.Name.Local)
+	}
+	return nil
+}
+
+func nextElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
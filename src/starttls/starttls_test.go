@@ -0,0 +1,191 @@
+package starttls
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/christopher-henderson/CACop/pkitest"
+)
+
+// server speaks the plaintext part of a protocol to the client.
+type server func(conn net.Conn, r *bufio.Reader) error
+
+// listen accepts a single connection, speaks the protocol and then presents
+// the valid leaf of a fresh PKI. The returned channel yields any error.
+func listen(t *testing.T, scheme string, speak server) (*url.URL, *pkitest.PKI, chan error) {
+	p := pkitest.NewT(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		if err := speak(conn, bufio.NewReader(conn)); err != nil {
+			errs <- err
+			return
+		}
+		errs <- tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{p.Valid.TLSCertificate()}}).Handshake()
+	}()
+	return &url.URL{Scheme: scheme, Host: l.Addr().String()}, p, errs
+}
+
+func expect(r *bufio.Reader, expected string) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if line != expected {
+		return fmt.Errorf("expected %q, got %q", expected, line)
+	}
+	return nil
+}
+
+func smtpServer(conn net.Conn, r *bufio.Reader) error {
+	fmt.Fprint(conn, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+	if err := expect(r, "EHLO cacop.invalid"); err != nil {
+		return err
+	}
+	fmt.Fprint(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+	if err := expect(r, "STARTTLS"); err != nil {
+		return err
+	}
+	fmt.Fprint(conn, "220 go ahead\r\n")
+	return nil
+}
+
+func imapServer(conn net.Conn, r *bufio.Reader) error {
+	fmt.Fprint(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+	if err := expect(r, "a001 STARTTLS"); err != nil {
+		return err
+	}
+	fmt.Fprint(conn, "* BYE not really\r\na001 OK begin TLS negotiation now\r\n")
+	return nil
+}
+
+func pop3Server(conn net.Conn, r *bufio.Reader) error {
+	fmt.Fprint(conn, "+OK POP3 ready\r\n")
+	if err := expect(r, "STLS"); err != nil {
+		return err
+	}
+	fmt.Fprint(conn, "+OK begin TLS negotiation\r\n")
+	return nil
+}
+
+func ldapServer(conn net.Conn, r *bufio.Reader) error {
+	tag, message, err := readTLV(r)
+	if err != nil {
+		return err
+	}
+	if tag != 0x30 || !strings.Contains(string(message), startTLSOID) {
+		return fmt.Errorf("unexpected request %x", message)
+	}
+	// The long form of the outer length, as OpenLDAP is known to send.
+	response := append(tlv(0x02, []byte{1}), tlv(0x78, append(append(tlv(0x0a, []byte{0}), tlv(0x04, nil)...), tlv(0x04, nil)...))...)
+	conn.Write(append([]byte{0x30, 0x84, 0, 0, 0, byte(len(response))}, response...))
+	return nil
+}
+
+func xmppServer(conn net.Conn, r *bufio.Reader) error {
+	header, err := r.ReadString('>')
+	if err != nil {
+		return err
+	}
+	if header, err = r.ReadString('>'); err != nil || !strings.Contains(header, "stream:stream") {
+		return fmt.Errorf("unexpected stream header %q: %v", header, err)
+	}
+	fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream from='example.com' id='1' version='1.0' xmlns='jabber:client' xmlns:stream='%s'>", streamNamespace)
+	fmt.Fprintf(conn, "<stream:features><starttls xmlns='%s'><required/></starttls><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'/></stream:features>", tlsNamespace)
+	request, err := r.ReadString('>')
+	if err != nil || !strings.Contains(request, "starttls") {
+		return fmt.Errorf("unexpected request %q: %v", request, err)
+	}
+	fmt.Fprintf(conn, "<proceed xmlns='%s'/>", tlsNamespace)
+	return nil
+}
+
+func TestHandshake(t *testing.T) {
+	servers := map[string]server{
+		"smtp": smtpServer,
+		"imap": imapServer,
+		"pop3": pop3Server,
+		"ldap": ldapServer,
+		"xmpp": xmppServer,
+	}
+	for scheme, speak := range servers {
+		subject, p, errs := listen(t, scheme, speak)
+		state, err := Handshake(context.Background(), subject, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Errorf("%s: %v", scheme, err)
+		} else if len(state.PeerCertificates) != 2 || !state.PeerCertificates[0].Equal(p.Valid.Certificate) {
+			t.Errorf("%s: expected the leaf and intermediate, got %d certificates", scheme, len(state.PeerCertificates))
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("%s server: %v", scheme, err)
+		}
+		p.Close()
+	}
+}
+
+func TestRefused(t *testing.T) {
+	servers := map[string]server{
+		"smtp": func(conn net.Conn, r *bufio.Reader) error {
+			fmt.Fprint(conn, "220 ready\r\n")
+			readLine(r)
+			fmt.Fprint(conn, "250 mail.example.com\r\n")
+			return nil
+		},
+		"imap": func(conn net.Conn, r *bufio.Reader) error {
+			fmt.Fprint(conn, "* OK ready\r\n")
+			readLine(r)
+			fmt.Fprint(conn, "a001 BAD unknown command\r\n")
+			return nil
+		},
+		"pop3": func(conn net.Conn, r *bufio.Reader) error {
+			fmt.Fprint(conn, "+OK ready\r\n")
+			readLine(r)
+			fmt.Fprint(conn, "-ERR unknown command\r\n")
+			return nil
+		},
+		"ldap": func(conn net.Conn, r *bufio.Reader) error {
+			readTLV(r)
+			diagnostic := []byte("unsupported extended operation")
+			conn.Write(tlv(0x30, append(tlv(0x02, []byte{1}), tlv(0x78, append(append(tlv(0x0a, []byte{2}), tlv(0x04, nil)...), tlv(0x04, diagnostic)...))...)))
+			return nil
+		},
+	}
+	for scheme, speak := range servers {
+		subject, p, errs := listen(t, scheme, speak)
+		if _, err := Handshake(context.Background(), subject, &tls.Config{InsecureSkipVerify: true}); err == nil {
+			t.Errorf("%s: expected STARTTLS to be refused", scheme)
+		}
+		<-errs
+		p.Close()
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for _, scheme := range []string{"smtp", "IMAP", "pop3", "ldap", "xmpp"} {
+		if !Supported(scheme) {
+			t.Errorf("expected %s to be supported", scheme)
+		}
+	}
+	if Supported("https") {
+		t.Error("https is not upgraded via STARTTLS")
+	}
+	if _, err := Handshake(context.Background(), &url.URL{Scheme: "ftp", Host: "127.0.0.1:21"}, nil); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/christopher-henderson/CACop/model"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The store is a single bolt database with the following buckets.
+//
+//	runs      -> id -> Record
+//	subjects  -> subject -> id -> nil
+//	roots     -> root fingerprint -> id -> nil
+//	monitors  -> subject -> registration
+//
+// Ids are monotonically increasing, and keys are big endian, so iterating
+// an index bucket in reverse yields the most recent runs first.
+var (
+	runs     = []byte("runs")
+	subjects = []byte("subjects")
+	roots    = []byte("roots")
+	monitors = []byte("monitors")
+)
+
+var ErrNotFound = errors.New("no such run")
+
+// Summary identifies a stored run without carrying its full result.
+type Summary struct {
+	ID              uint64
+	Timestamp       time.Time
+	Subject         string
+	RootFingerprint string
+}
+
+// Record is a stored run. The result is kept as the JSON that was served to
+// the client so that a past run is reproduced exactly as it was first seen.
+type Record struct {
+	Summary
+	Result json.RawMessage
+}
+
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open result store %v", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{runs, subjects, roots, monitors} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to initialize result store")
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save records the result of a verification that completed at the given time.
+func (s *Store) Save(result model.TestWebsiteResult, at time.Time) (Record, error) {
+	var record Record
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return record, errors.Wrap(err, "failed to encode result")
+	}
+	record.Timestamp = at
+	record.Subject = result.SubjectURL
+	record.RootFingerprint = result.Chain.Root.Fingerprint
+	record.Result = raw
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runs)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		record.ID = id
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := itob(id)
+		if err := b.Put(key, encoded); err != nil {
+			return err
+		}
+		if err := index(tx, subjects, record.Subject, key); err != nil {
+			return err
+		}
+		return index(tx, roots, record.RootFingerprint, key)
+	})
+	return record, errors.Wrap(err, "failed to save result")
+}
+
+// Get returns the run with the given id, or ErrNotFound.
+func (s *Store) Get(id uint64) (record Record, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(runs).Get(itob(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &record)
+	})
+	return
+}
+
+// BySubject lists the runs for the given subject, most recent first.
+func (s *Store) BySubject(subject string) ([]Summary, error) {
+	return s.list(subjects, subject)
+}
+
+// ByRoot lists the runs whose chain ended in the root with the given fingerprint, most recent first.
+func (s *Store) ByRoot(fingerprint string) ([]Summary, error) {
+	return s.list(roots, fingerprint)
+}
+
+func (s *Store) list(bucket []byte, key string) ([]Summary, error) {
+	summaries := make([]Summary, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(bucket).Bucket([]byte(key))
+		if idx == nil {
+			return nil
+		}
+		all := tx.Bucket(runs)
+		c := idx.Cursor()
+		for id, _ := c.Last(); id != nil; id, _ = c.Prev() {
+			var record Record
+			if err := json.Unmarshal(all.Get(id), &record); err != nil {
+				return err
+			}
+			summaries = append(summaries, record.Summary)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// PutRegistration keeps the given monitor registration for the subject,
+// replacing any that already exists. The store treats registrations as opaque.
+func (s *Store) PutRegistration(subject string, registration []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(monitors).Put([]byte(subject), registration)
+	})
+}
+
+func (s *Store) DeleteRegistration(subject string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(monitors).Delete([]byte(subject))
+	})
+}
+
+// Registrations returns every monitor registration.
+func (s *Store) Registrations() ([][]byte, error) {
+	var registrations [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(monitors).ForEach(func(_, registration []byte) error {
+			// Values are only valid for the life of the transaction.
+			registrations = append(registrations, append([]byte{}, registration...))
+			return nil
+		})
+	})
+	return registrations, err
+}
+
+func index(tx *bolt.Tx, bucket []byte, key string, id []byte) error {
+	if key == "" {
+		return nil
+	}
+	b, err := tx.Bucket(bucket).CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+	return b.Put(id, []byte{})
+}
+
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/christopher-henderson/CACop/model"
+)
+
+func newStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(filepath.Join(dir, "cacop.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func result(subject, root string) model.TestWebsiteResult {
+	r := model.TestWebsiteResult{SubjectURL: subject}
+	r.Chain.Root.Fingerprint = root
+	return r
+}
+
+func TestSaveAndList(t *testing.T) {
+	s, cleanup := newStore(t)
+	defer cleanup()
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	runs := []model.TestWebsiteResult{
+		result("https://valid.example.com", "aaaa"),
+		result("https://revoked.example.com", "aaaa"),
+		result("https://valid.example.com", "aaaa"),
+		result("https://valid.example.com", "bbbb"),
+	}
+	for i, r := range runs {
+		if _, err := s.Save(r, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid, err := s.BySubject("https://valid.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(valid) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(valid))
+	}
+	if valid[0].ID != 4 || valid[1].ID != 3 || valid[2].ID != 1 {
+		t.Errorf("expected the most recent runs first, got %v", valid)
+	}
+	root, err := s.ByRoot("aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root) != 3 {
+		t.Errorf("expected 3 runs, got %d", len(root))
+	}
+	none, err := s.BySubject("https://unknown.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 0 {
+		t.Errorf("expected no runs, got %v", none)
+	}
+}
+
+func TestGet(t *testing.T) {
+	s, cleanup := newStore(t)
+	defer cleanup()
+	at := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	saved, err := s.Save(result("https://valid.example.com", "aaaa"), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := s.Get(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Timestamp.Equal(at) || record.Subject != "https://valid.example.com" || record.RootFingerprint != "aaaa" {
+		t.Errorf("unexpected record %+v", record.Summary)
+	}
+	var decoded struct{ SubjectURL string }
+	if err := json.Unmarshal(record.Result, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SubjectURL != "https://valid.example.com" {
+		t.Errorf("unexpected result %s", record.Result)
+	}
+	if _, err := s.Get(saved.ID + 1); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,221 @@
+package truststore
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+	"github.com/pkg/errors"
+)
+
+// certdata.txt is the source of the NSS builtin root module. It is a series of
+// PKCS#11 objects, each being a list of attributes of the form
+//
+//	CKA_NAME TYPE VALUE
+//
+// MULTILINE_OCTAL values span several lines of escaped octal bytes and are
+// terminated by a line containing only "END". For example,
+//
+//	CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE
+//	CKA_LABEL UTF8 "Example Root CA"
+//	CKA_VALUE MULTILINE_OCTAL
+//	\060\202\003\165...
+//	END
+//	CKA_NSS_SERVER_DISTRUST_AFTER CK_BBOOL CK_FALSE
+//
+// Trust is expressed by a separate CKO_NSS_TRUST object that references its
+// certificate by the SHA1 hash of the certificate's DER.
+//
+// https://hg.mozilla.org/projects/nss/file/tip/lib/ckfw/builtins/certdata.txt
+
+const (
+	CKO_CERTIFICATE = "CKO_CERTIFICATE"
+	CKO_NSS_TRUST   = "CKO_NSS_TRUST"
+
+	CKT_NSS_TRUSTED_DELEGATOR = "CKT_NSS_TRUSTED_DELEGATOR"
+	CKT_NSS_MUST_VERIFY_TRUST = "CKT_NSS_MUST_VERIFY_TRUST"
+	CKT_NSS_NOT_TRUSTED       = "CKT_NSS_NOT_TRUSTED"
+
+	// The distrust-after attributes are encoded as the raw bytes of a UTCTime.
+	distrustAfterLayout = "060102150405Z"
+)
+
+type attribute struct {
+	kind  string
+	value string
+	octal []byte
+}
+
+type object map[string]attribute
+
+func (o object) class() string {
+	return o["CKA_CLASS"].value
+}
+
+// LoadCertdata parses the certdata.txt at the given path and adds every
+// certificate found within it to the trust store.
+func (t *TrustStore) LoadCertdata(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open certdata %v", path)
+	}
+	defer f.Close()
+	entries, err := ParseCertdata(f)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse certdata %v", path)
+	}
+	for _, entry := range entries {
+		t.Add(entry)
+	}
+	return nil
+}
+
+// ParseCertdata reads certdata.txt formatted objects and pairs each
+// certificate with its trust object.
+func ParseCertdata(r io.Reader) ([]Entry, error) {
+	objects, err := parseObjects(r)
+	if err != nil {
+		return nil, err
+	}
+	trusts := make(map[string]object)
+	for _, o := range objects {
+		if o.class() == CKO_NSS_TRUST {
+			trusts[string(o["CKA_CERT_SHA1_HASH"].octal)] = o
+		}
+	}
+	var entries []Entry
+	for _, o := range objects {
+		if o.class() != CKO_CERTIFICATE {
+			continue
+		}
+		entry, err := newEntry(o, trusts)
+		if err != nil {
+			return entries, errors.Wrapf(err, "failed to read certificate %v", o["CKA_LABEL"].value)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func newEntry(o object, trusts map[string]object) (entry Entry, err error) {
+	der := o["CKA_VALUE"].octal
+	entry.Certificate, err = x509.ParseCertificate(der)
+	if err != nil {
+		return
+	}
+	entry.Fingerprint = certutil.FingerprintOf(entry.Certificate)
+	entry.Label = o["CKA_LABEL"].value
+	if entry.ServerDistrustAfter, err = distrustAfter(o["CKA_NSS_SERVER_DISTRUST_AFTER"]); err != nil {
+		return
+	}
+	if entry.EmailDistrustAfter, err = distrustAfter(o["CKA_NSS_EMAIL_DISTRUST_AFTER"]); err != nil {
+		return
+	}
+	hash := sha1.Sum(der)
+	trust, ok := trusts[string(hash[:])]
+	if !ok {
+		// A certificate without a trust object is not a trust anchor. NSS
+		// ships a handful of these in order to explicitly distrust them.
+		entry.Status = Distrusted
+		return
+	}
+	entry.Trust.Websites = trust["CKA_TRUST_SERVER_AUTH"].value == CKT_NSS_TRUSTED_DELEGATOR
+	entry.Trust.Email = trust["CKA_TRUST_EMAIL_PROTECTION"].value == CKT_NSS_TRUSTED_DELEGATOR
+	entry.Trust.CodeSigning = trust["CKA_TRUST_CODE_SIGNING"].value == CKT_NSS_TRUSTED_DELEGATOR
+	switch entry.Trust.Any() {
+	case true:
+		entry.Status = Included
+	case false:
+		entry.Status = Distrusted
+	}
+	return
+}
+
+func distrustAfter(a attribute) (*time.Time, error) {
+	if a.kind != "MULTILINE_OCTAL" {
+		// CK_BBOOL CK_FALSE, or simply absent.
+		return nil, nil
+	}
+	t, err := time.Parse(distrustAfterLayout, string(a.octal))
+	if err != nil {
+		return nil, errors.Wrapf(err, "bad distrust after date %q", string(a.octal))
+	}
+	return &t, nil
+}
+
+func parseObjects(r io.Reader) ([]object, error) {
+	var objects []object
+	var current object
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "BEGINDATA" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			return objects, fmt.Errorf("line %d: malformed attribute %q", lineno, line)
+		}
+		name, kind := fields[0], fields[1]
+		a := attribute{kind: kind}
+		switch kind {
+		case "MULTILINE_OCTAL":
+			var err error
+			a.octal, lineno, err = readOctal(scanner, lineno)
+			if err != nil {
+				return objects, err
+			}
+		case "UTF8":
+			if len(fields) != 3 {
+				return objects, fmt.Errorf("line %d: missing UTF8 value", lineno)
+			}
+			value, err := strconv.Unquote(fields[2])
+			if err != nil {
+				return objects, fmt.Errorf("line %d: bad UTF8 value %q", lineno, fields[2])
+			}
+			a.value = value
+		default:
+			if len(fields) == 3 {
+				a.value = fields[2]
+			}
+		}
+		if name == "CKA_CLASS" {
+			current = make(object)
+			objects = append(objects, current)
+		}
+		if current == nil {
+			// Attributes of the leading CVS_ID and similar preamble.
+			continue
+		}
+		current[name] = a
+	}
+	return objects, scanner.Err()
+}
+
+func readOctal(scanner *bufio.Scanner, lineno int) ([]byte, int, error) {
+	var value []byte
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "END" {
+			return value, lineno, nil
+		}
+		for _, octet := range strings.Split(line, `\`)[1:] {
+			b, err := strconv.ParseUint(octet, 8, 8)
+			if err != nil {
+				return value, lineno, fmt.Errorf("line %d: bad octal %q", lineno, octet)
+			}
+			value = append(value, byte(b))
+		}
+	}
+	return value, lineno, fmt.Errorf("line %d: unterminated MULTILINE_OCTAL", lineno)
+}
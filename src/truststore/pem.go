@@ -0,0 +1,70 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var pemExtensions = map[string]bool{
+	".pem": true,
+	".crt": true,
+	".cer": true,
+}
+
+// LoadPEMDirectory adds every PEM encoded certificate found in the files of the
+// given directory with the provided status. PEM files carry no trust metadata,
+// so the trust bits of these entries are left for the caller to fill in.
+func (t *TrustStore) LoadPEMDirectory(dir string, status Status) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list PEM directory %v", dir)
+	}
+	for _, file := range files {
+		if file.IsDir() || !pemExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %v", path)
+		}
+		certs, err := ParsePEM(raw)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %v", path)
+		}
+		for _, cert := range certs {
+			t.Add(Entry{
+				Certificate: cert,
+				Label:       cert.Subject.CommonName,
+				Status:      status,
+			})
+		}
+	}
+	return nil
+}
+
+// ParsePEM returns every certificate within the given PEM bundle, skipping
+// any blocks that are not certificates.
+func ParsePEM(raw []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return certs, err
+		}
+		certs = append(certs, cert)
+	}
+}
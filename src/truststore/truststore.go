@@ -0,0 +1,154 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/christopher-henderson/CACop/expiration/certutil"
+)
+
+type Fingerprint = string
+
+// Status is where a root stands with regard to the Mozilla root store.
+type Status int
+
+const (
+	NotIncluded Status = iota
+	Included
+	Pending
+	Distrusted
+)
+
+func (s Status) String() string {
+	switch s {
+	case Included:
+		return "included"
+	case Pending:
+		return "pending"
+	case Distrusted:
+		return "distrusted"
+	default:
+		return "not included"
+	}
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// TrustBits are the purposes for which a root is trusted. They correspond to
+// the CKA_TRUST_SERVER_AUTH, CKA_TRUST_EMAIL_PROTECTION and CKA_TRUST_CODE_SIGNING
+// attributes of a CKO_NSS_TRUST object in certdata.txt.
+type TrustBits struct {
+	Websites    bool
+	Email       bool
+	CodeSigning bool
+}
+
+// Purpose is what a root is being relied upon for, and so which of its
+// distrust-after dates applies.
+type Purpose int
+
+const (
+	ServerAuth Purpose = iota
+	EmailProtection
+	CodeSigning
+)
+
+func (t TrustBits) Any() bool {
+	return t.Websites || t.Email || t.CodeSigning
+}
+
+// For reports whether the bit for the purpose is set.
+func (t TrustBits) For(purpose Purpose) bool {
+	switch purpose {
+	case ServerAuth:
+		return t.Websites
+	case EmailProtection:
+		return t.Email
+	default:
+		return t.CodeSigning
+	}
+}
+
+// Entry describes a single root as known by the trust store.
+type Entry struct {
+	Certificate         *x509.Certificate `json:"-"`
+	Fingerprint         Fingerprint
+	Label               string
+	Status              Status
+	Trust               TrustBits
+	ServerDistrustAfter *time.Time
+	EmailDistrustAfter  *time.Time
+}
+
+type TrustStore struct {
+	lock  sync.RWMutex
+	roots map[Fingerprint]Entry
+}
+
+func New() *TrustStore {
+	return &TrustStore{roots: make(map[Fingerprint]Entry)}
+}
+
+// Add records the given entry, replacing any entry that already exists for the same root.
+func (t *TrustStore) Add(entry Entry) {
+	if entry.Fingerprint == "" && entry.Certificate != nil {
+		entry.Fingerprint = certutil.FingerprintOf(entry.Certificate)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.roots[entry.Fingerprint] = entry
+}
+
+func (t *TrustStore) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.roots)
+}
+
+// Lookup reports the standing of the given root for the given purpose. A root
+// that is included, but without the trust bit for the purpose, is not included
+// as far as that purpose goes. If a leaf is provided then the root's
+// distrust-after date for that purpose is evaluated against the leaf's
+// notBefore, which is how NSS decides whether to honor a partially distrusted root.
+func (t *TrustStore) Lookup(root, leaf *x509.Certificate, purpose Purpose) Entry {
+	fingerprint := certutil.FingerprintOf(root)
+	t.lock.RLock()
+	entry, ok := t.roots[fingerprint]
+	t.lock.RUnlock()
+	if !ok {
+		return Entry{
+			Certificate: root,
+			Fingerprint: fingerprint,
+			Label:       root.Subject.CommonName,
+			Status:      NotIncluded,
+		}
+	}
+	// Roots whose trust bits are unknown, such as those loaded from a
+	// directory of PEMs, are taken to be included for every purpose.
+	if entry.Status == Included && entry.Trust.Any() && !entry.Trust.For(purpose) {
+		entry.Status = NotIncluded
+	}
+	if after := entry.distrustAfter(purpose); leaf != nil && entry.Status == Included && after != nil {
+		if leaf.NotBefore.After(*after) {
+			entry.Status = Distrusted
+		}
+	}
+	return entry
+}
+
+// distrustAfter is the CKA_NSS_SERVER_DISTRUST_AFTER or CKA_NSS_EMAIL_DISTRUST_AFTER
+// date of the root, as NSS has neither for code signing.
+func (e Entry) distrustAfter(purpose Purpose) *time.Time {
+	switch purpose {
+	case ServerAuth:
+		return e.ServerDistrustAfter
+	case EmailProtection:
+		return e.EmailDistrustAfter
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,211 @@
+package truststore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRoot(t *testing.T, name string, notBefore time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(time.Hour * 24 * 365),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func octal(b []byte) string {
+	var s strings.Builder
+	for i, octet := range b {
+		if i > 0 && i%16 == 0 {
+			s.WriteString("\n")
+		}
+		fmt.Fprintf(&s, `\%03o`, octet)
+	}
+	return s.String()
+}
+
+func certdataFor(cert *x509.Certificate, serverAuth, email string, distrustAfter string) string {
+	hash := sha1.Sum(cert.Raw)
+	distrust := "CKA_NSS_SERVER_DISTRUST_AFTER CK_BBOOL CK_FALSE"
+	if distrustAfter != "" {
+		distrust = "CKA_NSS_SERVER_DISTRUST_AFTER MULTILINE_OCTAL\n" + octal([]byte(distrustAfter)) + "\nEND"
+	}
+	return fmt.Sprintf(`
+#
+# Certificate "%[1]s"
+#
+CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "%[1]s"
+CKA_CERTIFICATE_TYPE CK_CERTIFICATE_TYPE CKC_X_509
+CKA_VALUE MULTILINE_OCTAL
+%[2]s
+END
+%[3]s
+CKA_NSS_EMAIL_DISTRUST_AFTER CK_BBOOL CK_FALSE
+
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_LABEL UTF8 "%[1]s"
+CKA_CERT_SHA1_HASH MULTILINE_OCTAL
+%[4]s
+END
+CKA_TRUST_SERVER_AUTH CK_TRUST %[5]s
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST %[6]s
+CKA_TRUST_CODE_SIGNING CK_TRUST CKT_NSS_MUST_VERIFY_TRUST
+CKA_TRUST_STEP_UP_APPROVED CK_BBOOL CK_FALSE
+`, cert.Subject.CommonName, octal(cert.Raw), distrust, octal(hash[:]), serverAuth, email)
+}
+
+const preamble = `CVS_ID "@(#) $RCSfile$ $Revision$ $Date$"
+BEGINDATA
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_BUILTIN_ROOT_LIST
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "Mozilla Builtin Roots"
+`
+
+func TestParseCertdata(t *testing.T) {
+	now := time.Now()
+	included := newRoot(t, "Included Root", now.Add(-time.Hour))
+	partial := newRoot(t, "Partially Distrusted Root", now.Add(-time.Hour))
+	distrusted := newRoot(t, "Distrusted Root", now.Add(-time.Hour))
+	certdata := preamble +
+		certdataFor(included, CKT_NSS_TRUSTED_DELEGATOR, CKT_NSS_MUST_VERIFY_TRUST, "") +
+		certdataFor(partial, CKT_NSS_TRUSTED_DELEGATOR, CKT_NSS_TRUSTED_DELEGATOR, "190701000000Z") +
+		certdataFor(distrusted, CKT_NSS_NOT_TRUSTED, CKT_NSS_NOT_TRUSTED, "")
+	entries, err := ParseCertdata(strings.NewReader(certdata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	store := New()
+	for _, entry := range entries {
+		store.Add(entry)
+	}
+
+	entry := store.Lookup(included, nil, ServerAuth)
+	if entry.Status != Included {
+		t.Errorf("expected %v, got %v", Included, entry.Status)
+	}
+	if entry.Label != "Included Root" {
+		t.Errorf("unexpected label %q", entry.Label)
+	}
+	if (entry.Trust != TrustBits{Websites: true}) {
+		t.Errorf("unexpected trust bits %+v", entry.Trust)
+	}
+
+	entry = store.Lookup(partial, nil, ServerAuth)
+	if entry.ServerDistrustAfter == nil {
+		t.Fatal("expected a server distrust after date")
+	}
+	if !entry.ServerDistrustAfter.Equal(time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected distrust after date %v", entry.ServerDistrustAfter)
+	}
+	if entry.Status != Included {
+		t.Errorf("expected %v, got %v", Included, entry.Status)
+	}
+	// The leaf is issued after the distrust after date.
+	if entry := store.Lookup(partial, partial, ServerAuth); entry.Status != Distrusted {
+		t.Errorf("expected %v, got %v", Distrusted, entry.Status)
+	}
+	// Only its server distrust after date is set, so it is still trusted for email.
+	if entry := store.Lookup(partial, partial, EmailProtection); entry.Status != Included {
+		t.Errorf("expected %v, got %v", Included, entry.Status)
+	}
+
+	if entry := store.Lookup(distrusted, nil, ServerAuth); entry.Status != Distrusted {
+		t.Errorf("expected %v, got %v", Distrusted, entry.Status)
+	}
+
+	unknown := newRoot(t, "Unknown Root", now)
+	if entry := store.Lookup(unknown, nil, ServerAuth); entry.Status != NotIncluded {
+		t.Errorf("expected %v, got %v", NotIncluded, entry.Status)
+	}
+}
+
+func TestLookupEmailDistrustAfter(t *testing.T) {
+	root := newRoot(t, "Email Distrusted Root", time.Now().Add(-time.Hour))
+	after := time.Now().Add(-2 * time.Hour)
+	store := New()
+	store.Add(Entry{Certificate: root, Status: Included, Trust: TrustBits{Websites: true, Email: true}, EmailDistrustAfter: &after})
+	if entry := store.Lookup(root, root, EmailProtection); entry.Status != Distrusted {
+		t.Errorf("expected %v for email, got %v", Distrusted, entry.Status)
+	}
+	if entry := store.Lookup(root, root, ServerAuth); entry.Status != Included {
+		t.Errorf("expected %v for websites, got %v", Included, entry.Status)
+	}
+}
+
+func TestLookupTrustBits(t *testing.T) {
+	websites := newRoot(t, "Websites Root", time.Now())
+	unknown := newRoot(t, "Unknown Trust Root", time.Now())
+	store := New()
+	store.Add(Entry{Certificate: websites, Status: Included, Trust: TrustBits{Websites: true}})
+	store.Add(Entry{Certificate: unknown, Status: Included})
+	if entry := store.Lookup(websites, nil, ServerAuth); entry.Status != Included {
+		t.Errorf("expected %v for websites, got %v", Included, entry.Status)
+	}
+	if entry := store.Lookup(websites, nil, EmailProtection); entry.Status != NotIncluded {
+		t.Errorf("expected %v for email, got %v", NotIncluded, entry.Status)
+	}
+	if entry := store.Lookup(unknown, nil, EmailProtection); entry.Status != Included {
+		t.Errorf("expected a root of unknown trust bits to be %v, got %v", Included, entry.Status)
+	}
+}
+
+func TestLoadPEMDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := newRoot(t, "Pending Root", time.Now())
+	raw := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "pending.pem"), raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := New()
+	if err := store.LoadPEMDirectory(dir, Pending); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("expected 1 root, got %d", store.Len())
+	}
+	if entry := store.Lookup(root, nil, ServerAuth); entry.Status != Pending {
+		t.Errorf("expected %v, got %v", Pending, entry.Status)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/christopher-henderson/CACop/bundle"
+	"github.com/christopher-henderson/CACop/ct"
+	"github.com/christopher-henderson/CACop/logging"
+	"github.com/christopher-henderson/CACop/model"
+)
+
+// maxUpload is far larger than any real chain.
+const maxUpload = 1 << 20
+
+// upload verifies a chain that a CA has sent in place of a test website that
+// cannot be reached. The chain is a PEM bundle or PKCS#7, and is either the
+// whole of the body or the 'chain' part of a multipart form, alongside which
+// an optional 'root' part designates the root to verify against and an
+// optional 'precertificate' part the precertificate to compare the leaf with,
+// bundled with its precertificate signing certificate if it has one.
+//
+//	POST /upload?time=2019-01-02T15:04:05Z&usage=smime  (body: PEM bundle or PKCS#7)
+//	POST /upload  (multipart/form-data: chain, root, precertificate)
+func upload(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	f, ok := negotiate(resp, req, resultFormats)
+	if !ok {
+		return
+	}
+	if req.Method != http.MethodPost {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Write([]byte("the chain must be POSTed\n"))
+		return
+	}
+	opts, err := verificationOptions(req)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
+	}
+	req.Body = http.MaxBytesReader(resp, req.Body, maxUpload)
+	var rawChain, rawRoot, rawPrecertificate []byte
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := req.ParseMultipartForm(maxUpload); err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Bad multipart form: " + err.Error()))
+			return
+		}
+		if rawChain, err = formFile(req.MultipartForm, "chain"); err == nil {
+			rawRoot, err = formFile(req.MultipartForm, "root")
+		}
+		if err == nil {
+			rawPrecertificate, err = formFile(req.MultipartForm, "precertificate")
+		}
+	} else {
+		rawChain, err = ioutil.ReadAll(req.Body)
+	}
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte("Error reading upload: " + err.Error()))
+		return
+	}
+	if len(rawChain) == 0 {
+		resp.WriteHeader(400)
+		resp.Write([]byte("a chain is required\n"))
+		return
+	}
+	if opts.Precertificate, opts.PrecertificateSigner, err = parsePrecertificate(rawPrecertificate); err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
+	}
+	result, err := testUpload(req.Context(), rawChain, rawRoot, opts)
+	if err != nil {
+		resp.WriteHeader(400)
+		resp.Write([]byte(err.Error()))
+		return
+	}
+	save(result)
+	respond(resp, f, result)
+}
+
+// formFile is the content of the named part of the form, which may be given
+// either as a file or as a plain field. A missing part is empty.
+func formFile(form *multipart.Form, name string) ([]byte, error) {
+	if files := form.File[name]; len(files) != 0 {
+		file, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ioutil.ReadAll(file)
+	}
+	if values := form.Value[name]; len(values) != 0 {
+		return []byte(values[0]), nil
+	}
+	return nil, nil
+}
+
+// parsePrecertificate parses a PEM or DER precertificate, along with the
+// precertificate signing certificate that may be bundled with it, returning
+// nil if there is no precertificate.
+func parsePrecertificate(raw []byte) (precert, signer *x509.Certificate, err error) {
+	if len(raw) == 0 {
+		return nil, nil, nil
+	}
+	certs, err := bundle.Parse(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad precertificate: %s", err)
+	}
+	for _, cert := range certs {
+		switch {
+		case ct.PrecertificateSigner(cert) && signer == nil:
+			signer = cert
+		case precert == nil:
+			precert = cert
+		}
+	}
+	if precert == nil {
+		return nil, nil, fmt.Errorf("bad precertificate: only a precertificate signing certificate was given")
+	}
+	return precert, signer, nil
+}
+
+// testUpload verifies the uploaded chain just as though it had been offered by
+// a test website, against the given root, or against the chain as uploaded if
+// the root is empty.
+func testUpload(ctx context.Context, rawChain, rawRoot []byte, opts options) (model.TestWebsiteResult, error) {
+	result := model.TestWebsiteResult{}
+	result.SubjectURL = model.Uploaded
+	result.CorrelationID = logging.ID(ctx)
+	certs, err := bundle.Parse(rawChain)
+	if err != nil {
+		return result, fmt.Errorf("bad chain: %s", err)
+	}
+	chain, err := bundle.Order(certs)
+	if err != nil {
+		return result, fmt.Errorf("bad chain: %s", err)
+	}
+	if len(rawRoot) != 0 {
+		roots, err := bundle.Parse(rawRoot)
+		if err != nil {
+			return result, fmt.Errorf("bad root: %s", err)
+		}
+		chain = withRoot(chain, roots[0])
+	}
+	if len(chain) < 2 {
+		return result, fmt.Errorf("bad chain: a lone certificate cannot be verified without the root that issued it")
+	}
+	logging.FromContext(ctx).WithField("certificates", len(chain)).Info("verifying an uploaded chain")
+	result.Chain = VerifyChain(ctx, chain, opts)
+	return result, nil
+}